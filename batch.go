@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wujunwei928/parse-video/config"
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// batchItem /video/batch 的一条解析请求: 分享文本, 或渠道和视频id
+// JSON 格式为字符串 "分享文本", 或对象 {"share_text": "分享文本"}, {"source": "douyin", "video_id": "xxx"}
+type batchItem struct {
+	ShareText string `json:"share_text,omitempty"`
+	Source    string `json:"source,omitempty"`
+	VideoId   string `json:"video_id,omitempty"`
+}
+
+func (item *batchItem) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		*item = batchItem{}
+		return json.Unmarshal(data, &item.ShareText)
+	}
+
+	// 使用不带 UnmarshalJSON 方法的类型, 避免递归
+	type plain batchItem
+	var p plain
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&p); err != nil {
+		return errors.New(`want share text string, {"share_text"} or {"source", "video_id"} object`)
+	}
+	if len(p.ShareText) > 0 && (len(p.Source) > 0 || len(p.VideoId) > 0) {
+		return errors.New("share_text and source/video_id cannot be set at the same time")
+	}
+	*item = batchItem(p)
+	return nil
+}
+
+// batchError 单条解析失败的错误信息
+type batchError struct {
+	Code int    `json:"code"` // 单独解析时对应的http状态码
+	Kind string `json:"kind"` // 错误分类, 见 parseErrorKind
+	Msg  string `json:"msg"`
+}
+
+// batchResult /video/batch 单条解析结果, 与请求的顺序一致
+type batchResult struct {
+	Index int                    `json:"index"`
+	Input batchItem              `json:"input"`
+	Data  *parser.VideoParseInfo `json:"data,omitempty"`
+	Error *batchError            `json:"error,omitempty"`
+}
+
+// parseErrorKind 返回解析错误分类的名称
+func parseErrorKind(err error) string {
+	switch {
+	case errors.Is(err, parser.ErrUnsupportedSource):
+		return "unsupported_source"
+	case errors.Is(err, parser.ErrInvalidInput):
+		return "invalid_input"
+	case errors.Is(err, parser.ErrVideoNotFound):
+		return "not_found"
+	case errors.Is(err, parser.ErrVideoPrivate):
+		return "private"
+	case errors.Is(err, parser.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, parser.ErrLayoutChanged):
+		return "layout_changed"
+	case errors.Is(err, parser.ErrNetwork):
+		return "network"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "unknown"
+	}
+}
+
+// newBatchError 转换单条解析的错误
+func newBatchError(err error) *batchError {
+	return &batchError{
+		Code: parseErrorStatus(err),
+		Kind: parseErrorKind(err),
+		Msg:  err.Error(),
+	}
+}
+
+// parseBatchItem 解析一条, 分享文本和视频id只能设置一个
+func parseBatchItem(ctx context.Context, item batchItem) (*parser.VideoParseInfo, error) {
+	if len(item.ShareText) > 0 {
+		return parser.ParseVideoShareUrlByRegexpContext(ctx, item.ShareText)
+	}
+	return parser.ParseVideoIdContext(ctx, item.Source, item.VideoId)
+}
+
+// 批量解析的进度事件类型
+const (
+	batchEventStarted  = "started"  // 开始解析一条
+	batchEventParsed   = "parsed"   // 一条解析成功
+	batchEventFailed   = "failed"   // 一条解析失败
+	batchEventFinished = "finished" // 全部解析完成
+)
+
+// batchParse 并发解析所有条目, 同时最多解析 concurrency 条, 结果顺序与 items 一致
+// notify 不为 nil 时, 在每条开始和结束时调用, 可能在多个 goroutine 中同时调用
+func batchParse(ctx context.Context, items []batchItem, concurrency int, proxy bool, notify func(eventType string, result batchResult)) []batchResult {
+	if notify == nil {
+		notify = func(string, batchResult) {}
+	}
+	results := make([]batchResult, len(items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		results[i] = batchResult{Index: i, Input: item}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Error = newBatchError(ctx.Err())
+			notify(batchEventFailed, results[i])
+			continue
+		}
+		wg.Add(1)
+		go func(result *batchResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			notify(batchEventStarted, *result)
+			info, err := parseBatchItem(ctx, result.Input)
+			if err != nil {
+				result.Error = newBatchError(err)
+				notify(batchEventFailed, *result)
+				return
+			}
+			if proxy {
+				proxyParseInfo(info)
+			}
+			result.Data = info
+			notify(batchEventParsed, *result)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// batchHandler POST /video/batch, 请求体为 JSON 数组, 每一项为分享文本或 {"source", "video_id"}
+// 单条解析失败不影响其他条目, 错误信息在对应条目的 error 中返回; async=1 时在后台解析, 返回任务id
+// 后台任务最多同时执行 cfg.MaxAsyncJobs 个, 超过时返回 429, 每个任务最多执行 cfg.AsyncTimeout
+func batchHandler(cfg config.BatchConfig) gin.HandlerFunc {
+	maxItems, concurrency := cfg.MaxItems, cfg.Concurrency
+	return func(c *gin.Context) {
+		var raws []json.RawMessage
+		if err := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20)).Decode(&raws); err != nil {
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  "请求格式错误, 需要 JSON 数组: " + err.Error(),
+			})
+			return
+		}
+		if len(raws) <= 0 {
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  "解析列表不能为空",
+			})
+			return
+		}
+		if len(raws) > maxItems {
+			c.JSON(http.StatusRequestEntityTooLarge, HttpResponse{
+				Code: 413,
+				Msg:  fmt.Sprintf("每次最多解析 %d 条, 实际 %d 条", maxItems, len(raws)),
+			})
+			return
+		}
+		items := make([]batchItem, len(raws))
+		for i, raw := range raws {
+			if err := json.Unmarshal(raw, &items[i]); err != nil {
+				c.JSON(http.StatusBadRequest, HttpResponse{
+					Code: 400,
+					Msg:  fmt.Sprintf("第 %d 条格式错误: %v", i, err),
+				})
+				return
+			}
+		}
+
+		proxy := c.Query("proxy") == "1"
+		if c.Query("async") == "1" {
+			// 后台解析, 通过 /video/batch/{job}/events 获取进度
+			job := batchJobs.add(len(items), cfg.MaxAsyncJobs)
+			if job == nil {
+				c.JSON(http.StatusTooManyRequests, HttpResponse{
+					Code: 429,
+					Msg:  fmt.Sprintf("后台解析任务已达上限 %d 个, 请稍后再试", cfg.MaxAsyncJobs),
+				})
+				return
+			}
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.AsyncTimeout))
+				defer cancel()
+				batchParse(ctx, items, concurrency, proxy, job.notify)
+				job.finish()
+			}()
+			c.JSON(http.StatusAccepted, HttpResponse{
+				Code: 202,
+				Msg:  "已提交",
+				Data: gin.H{
+					"job":    job.id,
+					"total":  len(items),
+					"events": "/video/batch/" + job.id + "/events",
+				},
+			})
+			return
+		}
+
+		results := batchParse(c.Request.Context(), items, concurrency, proxy, nil)
+		c.JSON(http.StatusOK, HttpResponse{
+			Code: 200,
+			Msg:  "解析完成",
+			Data: results,
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wujunwei928/parse-video/config"
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// fakeIdParser 测试用的视频id解析, id 为 "missing" 时返回不存在
+type fakeIdParser struct {
+	running, maxRunning *atomic.Int32
+}
+
+func (p fakeIdParser) ParseVideoID(_ context.Context, videoId string) (*parser.VideoParseInfo, error) {
+	n := p.running.Add(1)
+	defer p.running.Add(-1)
+	for {
+		old := p.maxRunning.Load()
+		if n <= old || p.maxRunning.CompareAndSwap(old, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if videoId == "missing" {
+		return nil, &parser.ParseError{Kind: parser.ErrVideoNotFound}
+	}
+	return &parser.VideoParseInfo{Title: "title " + videoId}, nil
+}
+
+func TestBatchHandler(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	const source = "batch_test"
+	if err := parser.Register(source, parser.SourceInfo{VideoIdParser: fakeIdParser{&running, &maxRunning}}); err != nil {
+		t.Fatal(err)
+	}
+	defer parser.Unregister(source)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/video/batch", batchHandler(config.BatchConfig{MaxItems: 8, Concurrency: 2, MaxAsyncJobs: 1, AsyncTimeout: config.Duration(time.Minute)}))
+	post := func(body string) (int, HttpResponse, []batchResult) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/video/batch", strings.NewReader(body)))
+		var res struct {
+			HttpResponse
+			Data []batchResult `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("response %s: %v", w.Body.String(), err)
+		}
+		return w.Code, res.HttpResponse, res.Data
+	}
+
+	code, _, results := post(`[
+		{"source": "batch_test", "video_id": "1"},
+		"看看这个 https://example.com/share/1 视频",
+		{"source": "batch_test", "video_id": "missing"},
+		{"source": "batch_test", "video_id": "2"},
+		{"source": "batch_test"}
+	]`)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	want := []struct {
+		title string
+		kind  string
+		code  int
+	}{
+		{title: "title 1"},
+		{kind: "unsupported_source", code: http.StatusBadRequest},
+		{kind: "not_found", code: http.StatusNotFound},
+		{title: "title 2"},
+		{kind: "invalid_input", code: http.StatusBadRequest},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Index != i {
+			t.Errorf("results[%d].Index = %d", i, got.Index)
+		}
+		if len(w.kind) > 0 {
+			if got.Error == nil || got.Error.Kind != w.kind || got.Error.Code != w.code {
+				t.Errorf("results[%d].Error = %+v, want kind %s code %d", i, got.Error, w.kind, w.code)
+			}
+			continue
+		}
+		if got.Error != nil || got.Data == nil || got.Data.Title != w.title {
+			t.Errorf("results[%d] = %+v, want title %q", i, got, w.title)
+		}
+	}
+	if n := maxRunning.Load(); n > 2 {
+		t.Errorf("max concurrent parses = %d, want <= 2", n)
+	}
+
+	for _, tt := range []struct {
+		name string
+		body string
+		code int
+	}{
+		{"not array", `{"source": "batch_test"}`, http.StatusBadRequest},
+		{"empty", `[]`, http.StatusBadRequest},
+		{"bad item", `["a", 1]`, http.StatusBadRequest},
+		{"unknown field", `[{"source": "batch_test", "id": "1"}]`, http.StatusBadRequest},
+		{"both set", `[{"share_text": "a", "video_id": "1"}]`, http.StatusBadRequest},
+		{"too many", `["1","2","3","4","5","6","7","8","9"]`, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, res, _ := post(tt.body); code != tt.code || res.Code != tt.code {
+				t.Errorf("status = %d, code = %d, want %d", code, res.Code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// batchJobTtl 后台批量解析任务完成后保留的时间, 之后无法再获取进度
+const batchJobTtl = 10 * time.Minute
+
+// batchEvent 后台批量解析任务的进度事件
+type batchEvent struct {
+	id   int    // 事件序号, 从0开始, 用作 SSE 的事件id
+	Type string `json:"type"`
+
+	*batchResult     // started, parsed, failed 事件对应的条目
+	Done         int `json:"done"`   // 已完成的条数
+	Failed       int `json:"failed"` // 失败的条数
+	Total        int `json:"total"`
+}
+
+// batchJob 后台批量解析任务, 保存所有进度事件, 后连接的客户端也能收到完整的进度
+type batchJob struct {
+	id    string
+	total int
+
+	mu         sync.Mutex
+	events     []batchEvent
+	done       int
+	failed     int
+	finished   bool
+	finishedAt time.Time
+	changed    chan struct{} // 有新事件时关闭, 并替换为新的 channel
+}
+
+// notify 记录一条的进度, 用作 batchParse 的回调
+func (j *batchJob) notify(eventType string, result batchResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch eventType {
+	case batchEventParsed:
+		j.done++
+	case batchEventFailed:
+		j.done++
+		j.failed++
+	}
+	j.publish(batchEvent{Type: eventType, batchResult: &result})
+}
+
+// finish 所有条目解析完成
+func (j *batchJob) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.finished = true
+	j.finishedAt = time.Now()
+	j.publish(batchEvent{Type: batchEventFinished})
+}
+
+// publish 追加事件并通知等待中的客户端, 调用方需持有锁
+func (j *batchJob) publish(event batchEvent) {
+	event.id = len(j.events)
+	event.Done, event.Failed, event.Total = j.done, j.failed, j.total
+	j.events = append(j.events, event)
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// eventsSince 返回序号不小于 next 的事件, 任务是否已完成, 以及下次有新事件时关闭的 channel
+func (j *batchJob) eventsSince(next int) ([]batchEvent, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var events []batchEvent
+	if next < len(j.events) {
+		events = j.events[max(next, 0):]
+	}
+	return events, j.finished, j.changed
+}
+
+// batchJobStore 进行中和最近完成的后台批量解析任务
+type batchJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*batchJob
+}
+
+// batchJobs 后台批量解析任务, 只保存在内存中
+var batchJobs = &batchJobStore{jobs: make(map[string]*batchJob)}
+
+// add 创建任务, 同时清理过期的任务; 未完成的任务已有 maxRunning 个时返回 nil
+func (s *batchJobStore) add(total, maxRunning int) *batchJob {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	job := &batchJob{id: hex.EncodeToString(id), total: total, changed: make(chan struct{})}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	running := 0
+	for id, item := range s.jobs {
+		item.mu.Lock()
+		finished := item.finished
+		expired := finished && time.Since(item.finishedAt) > batchJobTtl
+		item.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+		if !finished {
+			running++
+		}
+	}
+	if running >= maxRunning {
+		return nil
+	}
+	s.jobs[job.id] = job
+	return job
+}
+
+func (s *batchJobStore) get(id string) *batchJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// batchEventsHandler GET /video/batch/{job}/events, 以 Server-Sent Events 推送任务进度
+// 先推送已有的事件, 再推送新事件, finished 事件后关闭连接; 支持通过 Last-Event-ID 断点续传
+func batchEventsHandler(c *gin.Context) {
+	job := batchJobs.get(c.Param("job"))
+	if job == nil {
+		c.JSON(http.StatusNotFound, HttpResponse{
+			Code: 404,
+			Msg:  "任务不存在或已过期",
+		})
+		return
+	}
+
+	next := 0
+	if lastId, err := strconv.Atoi(c.GetHeader("Last-Event-ID")); err == nil {
+		next = lastId + 1
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // 禁止 nginx 缓冲
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	for {
+		events, finished, changed := job.eventsSince(next)
+		for _, event := range events {
+			c.Render(-1, sse.Event{
+				Id:    strconv.Itoa(event.id),
+				Event: event.Type,
+				Data:  event,
+			})
+			next = event.id + 1
+		}
+		c.Writer.Flush()
+		if finished {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wujunwei928/parse-video/config"
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// eventProgress 事件中的进度
+type eventProgress struct {
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+	Total  int `json:"total"`
+}
+
+// readEvents 读取 SSE 响应中的所有事件类型, 以及最后一个事件的进度
+func readEvents(t *testing.T, url, lastEventId string) (types []string, last eventProgress) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if len(lastEventId) > 0 {
+		req.Header.Set("Last-Event-ID", lastEventId)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event:"); ok {
+			types = append(types, name)
+		} else if data, ok := strings.CutPrefix(line, "data:"); ok {
+			last = eventProgress{}
+			if err = json.Unmarshal([]byte(data), &last); err != nil {
+				t.Fatalf("event data %s: %v", data, err)
+			}
+		}
+	}
+	return types, last
+}
+
+func TestBatchEvents(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	const source = "batch_test"
+	if err := parser.Register(source, parser.SourceInfo{VideoIdParser: fakeIdParser{&running, &maxRunning}}); err != nil {
+		t.Fatal(err)
+	}
+	defer parser.Unregister(source)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/video/batch", batchHandler(config.BatchConfig{MaxItems: 8, Concurrency: 2, MaxAsyncJobs: 1, AsyncTimeout: config.Duration(time.Minute)}))
+	r.GET("/video/batch/:job/events", batchEventsHandler)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/video/batch?async=1", "application/json", strings.NewReader(
+		`[{"source": "batch_test", "video_id": "1"}, {"source": "batch_test", "video_id": "missing"}, {"source": "batch_test", "video_id": "2"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var submitted struct {
+		Data struct {
+			Job    string `json:"job"`
+			Events string `json:"events"`
+		} `json:"data"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&submitted); err != nil || res.StatusCode != http.StatusAccepted {
+		t.Fatalf("submit status = %d, err = %v", res.StatusCode, err)
+	}
+
+	types, last := readEvents(t, server.URL+submitted.Data.Events, "")
+	count := make(map[string]int)
+	for _, typ := range types {
+		count[typ]++
+	}
+	if count["started"] != 3 || count["parsed"] != 2 || count["failed"] != 1 || count["finished"] != 1 {
+		t.Errorf("event counts = %v", count)
+	}
+	if types[len(types)-1] != "finished" || last.Done != 3 || last.Failed != 1 || last.Total != 3 {
+		t.Errorf("last event = %s %+v, want finished with done 3, failed 1", types[len(types)-1], last)
+	}
+
+	// 断点续传只返回之后的事件
+	types, _ = readEvents(t, server.URL+submitted.Data.Events, "5")
+	if len(types) != 1 || types[0] != "finished" {
+		t.Errorf("events after id 5 = %v, want [finished]", types)
+	}
+
+	res, err = http.Get(server.URL + "/video/batch/nope/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job status = %d, want 404", res.StatusCode)
+	}
+}
+
+func TestBatchJobStore_maxRunning(t *testing.T) {
+	store := &batchJobStore{jobs: make(map[string]*batchJob)}
+	job := store.add(1, 1)
+	if job == nil {
+		t.Fatal("first job rejected")
+	}
+	if store.add(1, 1) != nil {
+		t.Error("job accepted while another is running")
+	}
+	job.finish()
+	if store.add(1, 1) == nil {
+		t.Error("job rejected after the running one finished")
+	}
+}
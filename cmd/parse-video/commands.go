@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// runParse parse 子命令: 解析分享文本或链接
+func runParse(ctx context.Context, env *env, args []string) error {
+	var cf clientFlags
+	fs := newFlagSet(env, "parse", "[flags] <分享文本或链接>")
+	cf.register(fs)
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	if err := checkOutput(fs, *output); err != nil {
+		return err
+	}
+
+	client, err := cf.client()
+	if err != nil {
+		return err
+	}
+	info, err := client.ParseVideoShareUrlByRegexp(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printParseInfo(env.stdout, *output, info)
+}
+
+// runId id 子命令: 根据渠道和视频id解析
+func runId(ctx context.Context, env *env, args []string) error {
+	var cf clientFlags
+	fs := newFlagSet(env, "id", "[flags] <渠道> <视频id>")
+	cf.register(fs)
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args, 2); err != nil {
+		return err
+	}
+	if err := checkOutput(fs, *output); err != nil {
+		return err
+	}
+
+	client, err := cf.client()
+	if err != nil {
+		return err
+	}
+	info, err := client.ParseVideoId(ctx, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	return printParseInfo(env.stdout, *output, info)
+}
+
+// runSources sources 子命令: 列出支持的渠道
+func runSources(_ context.Context, env *env, args []string) error {
+	fs := newFlagSet(env, "sources", "[flags]")
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if err := checkOutput(fs, *output); err != nil {
+		return err
+	}
+
+	sources := parser.Sources()
+	if *output == "json" {
+		return printJson(env.stdout, sources)
+	}
+	tw := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tSHARE_URL\tVIDEO_ID\tIMAGES\tDOMAINS")
+	for _, item := range sources {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			item.Source, yesNo(item.ShareUrl), yesNo(item.VideoId), yesNo(item.Images), strings.Join(item.Domains, ","))
+	}
+	return tw.Flush()
+}
+
+// batchLine batch 子命令 json 格式输出的一行
+type batchLine struct {
+	Index      int                    `json:"index"`                // 在文件中的序号, 从0开始, 不计空行和注释
+	Duplicates []int                  `json:"duplicates,omitempty"` // 与该条相同的其他序号
+	Input      string                 `json:"input"`
+	ShareUrl   string                 `json:"share_url,omitempty"`
+	Source     string                 `json:"source,omitempty"`
+	Data       *parser.VideoParseInfo `json:"data,omitempty"`
+	Error      *batchError            `json:"error,omitempty"`
+}
+
+// batchError 单条解析失败的错误
+type batchError struct {
+	Code int    `json:"code"` // 单独解析时的退出码
+	Msg  string `json:"msg"`
+}
+
+// runBatch batch 子命令: 批量解析文件中的分享链接, 每行一条, 忽略空行和 # 开头的注释
+// json 格式每解析完一条输出一行, table 格式全部完成后按顺序输出
+// 有失败的条目时, 返回序号最小的失败条目对应的退出码
+func runBatch(ctx context.Context, env *env, args []string) error {
+	var cf clientFlags
+	fs := newFlagSet(env, "batch", "[flags] -f <文件>")
+	cf.register(fs)
+	fs.IntVar(&cf.concurrency, "c", parser.DefaultBatchConcurrency, "同时解析的条数")
+	file := fs.String("f", "", "分享链接文件, 每行一条, - 表示从标准输入读取")
+	output := outputFlag(fs)
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if err := checkOutput(fs, *output); err != nil {
+		return err
+	}
+	if len(*file) <= 0 {
+		fmt.Fprintln(fs.Output(), "需要 -f 指定分享链接文件")
+		fs.Usage()
+		return errUsage
+	}
+	if cf.concurrency <= 0 {
+		fmt.Fprintln(fs.Output(), "-c 需要大于0")
+		return errUsage
+	}
+
+	inputs, err := readLines(env.stdin, *file)
+	if err != nil {
+		return err
+	}
+	client, err := cf.client()
+	if err != nil {
+		return err
+	}
+
+	var (
+		lines    []batchLine
+		firstErr error
+		errIndex = len(inputs)
+		encoder  = json.NewEncoder(env.stdout)
+	)
+	encoder.SetEscapeHTML(false)
+	for result := range client.BatchParseShareUrls(ctx, inputs) {
+		line := batchLine{
+			Index:      result.Index,
+			Duplicates: result.Duplicates,
+			Input:      inputs[result.Index],
+			ShareUrl:   result.ShareUrl,
+			Source:     result.Source,
+			Data:       result.ParseInfo,
+		}
+		if result.Error != nil {
+			line.Error = &batchError{Code: exitCode(result.Error), Msg: result.Error.Error()}
+			if result.Index < errIndex {
+				firstErr, errIndex = result.Error, result.Index
+			}
+		}
+		if *output == "json" {
+			if err = encoder.Encode(line); err != nil {
+				return err
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if *output == "table" {
+		sort.Slice(lines, func(i, j int) bool { return lines[i].Index < lines[j].Index })
+		tw := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "INDEX\tSOURCE\tSTATUS\tTITLE_OR_ERROR")
+		for _, line := range lines {
+			index := strconv.Itoa(line.Index)
+			for _, duplicate := range line.Duplicates {
+				index += "," + strconv.Itoa(duplicate)
+			}
+			if line.Error != nil {
+				fmt.Fprintf(tw, "%s\t%s\tfailed\t%s\n", index, line.Source, line.Error.Msg)
+			} else {
+				fmt.Fprintf(tw, "%s\t%s\tok\t%s\n", index, line.Source, oneLine(line.Data.Title))
+			}
+		}
+		if err = tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if firstErr != nil {
+		return reportedError{err: firstErr}
+	}
+	return nil
+}
+
+// readLines 读取文件中的非空行, 忽略 # 开头的注释, path 为 - 时读取 stdin
+func readLines(stdin io.Reader, path string) ([]string, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) <= 0 {
+		return nil, errors.New("no share url in " + path)
+	}
+	return lines, nil
+}
+
+// printParseInfo 按格式输出视频信息
+func printParseInfo(w io.Writer, output string, info *parser.VideoParseInfo) error {
+	if output == "json" {
+		return printJson(w, info)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	row := func(name, value string) {
+		if len(value) > 0 {
+			fmt.Fprintf(tw, "%s\t%s\n", name, value)
+		}
+	}
+	row("source", info.Source)
+	row("video_id", info.VideoId)
+	row("title", oneLine(info.Title))
+	row("author", info.Author.Name)
+	row("author_uid", info.Author.Uid)
+	if info.Duration > 0 {
+		row("duration", (time.Duration(info.Duration) * time.Second).String())
+	}
+	if info.PublishedAt > 0 {
+		row("published_at", time.Unix(info.PublishedAt, 0).Format(time.DateTime))
+	}
+	row("tags", strings.Join(info.Tags, " "))
+	if info.Music != nil {
+		row("music", oneLine(strings.TrimSuffix(info.Music.Title+" - "+info.Music.Author, " - ")))
+	}
+	if stats := info.Stats; stats != nil {
+		row("stats", fmt.Sprintf("plays %d, likes %d, comments %d, shares %d, collects %d", stats.Plays, stats.Likes, stats.Comments, stats.Shares, stats.Collects))
+	}
+	row("video_url", info.VideoUrl)
+	row("music_url", info.MusicUrl)
+	row("cover_url", info.CoverUrl)
+	for i, image := range info.Images {
+		row("image_"+strconv.Itoa(i+1), image)
+	}
+	for _, stream := range info.Streams {
+		row("stream_"+stream.Quality, stream.Url)
+	}
+	for _, page := range info.Pages {
+		row(fmt.Sprintf("page_%d", page.Page), page.VideoUrl)
+	}
+	return tw.Flush()
+}
+
+// printJson 输出缩进的 JSON, 不转义 html 字符, 地址中的 & 保持原样
+func printJson(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// oneLine 将换行和制表符替换为空格, 避免打乱表格
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/wujunwei928/parse-video/downloader"
+)
+
+// runDownload download 子命令: 解析后下载视频、封面和图集, 每保存一个文件输出一行文件路径
+// 中断后重新执行同样的命令, 从已下载的位置继续
+func runDownload(ctx context.Context, env *env, args []string) error {
+	var cf clientFlags
+	fs := newFlagSet(env, "download", "[flags] <分享文本或链接>")
+	cf.register(fs)
+	dir := fs.String("dir", ".", "保存目录, 不存在时自动创建")
+	template := fs.String("template", downloader.DefaultTemplate, "文件名模板, 变量: {source} {id} {title} {author.name} {author.uid} {kind} {index} {ext}")
+	noVideo := fs.Bool("no-video", false, "不下载视频")
+	noCover := fs.Bool("no-cover", false, "不下载封面")
+	noImages := fs.Bool("no-images", false, "不下载图集")
+	music := fs.Bool("music", false, "下载音乐")
+	chunks := fs.Int("chunks", 4, "大于 16MB 的文件分块并发下载的块数")
+	showProgress := fs.Bool("progress", false, "在标准错误输出下载进度")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	tpl, err := downloader.ParseTemplate(*template)
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return errUsage
+	}
+
+	var kinds []string
+	for kind, skip := range map[string]bool{
+		downloader.KindVideo: *noVideo,
+		downloader.KindCover: *noCover,
+		downloader.KindImage: *noImages,
+		downloader.KindAudio: !*music,
+	} {
+		if !skip {
+			kinds = append(kinds, kind)
+		}
+	}
+	opts := []downloader.Option{
+		downloader.WithHttpClient(newDownloadClient(cf.proxy)),
+		downloader.WithTemplate(tpl),
+		downloader.WithKinds(kinds...),
+		downloader.WithChunks(*chunks, 16<<20),
+	}
+	if *showProgress {
+		opts = append(opts, downloader.WithProgress(progressPrinter(env)))
+	}
+
+	client, err := cf.client()
+	if err != nil {
+		return err
+	}
+	info, err := client.ParseVideoShareUrlByRegexp(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	files, err := downloader.New(*dir, opts...).Download(ctx, info, nil)
+	for _, file := range files {
+		fmt.Fprintln(env.stdout, file.Path)
+	}
+	return err
+}
+
+// newDownloadClient 创建下载资源使用的客户端, 与解析使用相同的代理
+func newDownloadClient(proxy string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyUrl, err := url.Parse(proxy); err == nil && len(proxy) > 0 {
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	return &http.Client{Transport: transport}
+}
+
+// progressPrinter 每个文件每完成10%输出一行进度, 大小未知时每10MB输出一行
+func progressPrinter(env *env) func(p downloader.Progress) {
+	var mu sync.Mutex
+	printed := make(map[string]int64) // 每个文件已输出的进度档位
+	return func(p downloader.Progress) {
+		step := int64(10 << 20)
+		if p.Total > 0 {
+			step = max(p.Total/10, 1)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if level := p.Downloaded / step; level > printed[p.Path] {
+			printed[p.Path] = level
+			if p.Total > 0 {
+				fmt.Fprintf(env.stderr, "%s %d%% (%d/%d)\n", p.Path, p.Downloaded*100/p.Total, p.Downloaded, p.Total)
+			} else {
+				fmt.Fprintf(env.stderr, "%s %d\n", p.Path, p.Downloaded)
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// parse-video 命令行工具: 解析视频分享链接, 下载视频、封面和图集, 不需要启动服务
+//
+//	parse-video parse [-o json|table] <分享文本或链接>
+//	parse-video id [-o json|table] <渠道> <视频id>
+//	parse-video download [-dir 目录] [-template 文件名模板] <分享文本或链接>
+//	parse-video batch [-o json|table] -f links.txt
+//	parse-video sources [-o json|table]
+//
+// 退出码表示错误分类, 见 exitCode
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// 退出码, 解析失败时按错误分类返回, 便于脚本判断是否需要重试
+const (
+	exitOk            = 0   // 成功
+	exitError         = 1   // 未分类的错误
+	exitUsage         = 2   // 命令或参数错误
+	exitUnsupported   = 3   // 不支持的渠道
+	exitInvalidInput  = 4   // 分享链接或视频id格式错误
+	exitNotFound      = 5   // 视频不存在或已删除
+	exitPrivate       = 6   // 视频仅作者可见或需要登录
+	exitRateLimited   = 7   // 被上游限流
+	exitLayoutChanged = 8   // 上游页面或接口结构变化
+	exitNetwork       = 9   // 网络错误或上游服务异常
+	exitTimeout       = 10  // 超时
+	exitCanceled      = 130 // 被 Ctrl-C 中断
+)
+
+// exitCode 根据错误分类返回退出码
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOk
+	case errors.Is(err, parser.ErrUnsupportedSource):
+		return exitUnsupported
+	case errors.Is(err, parser.ErrInvalidInput):
+		return exitInvalidInput
+	case errors.Is(err, parser.ErrVideoNotFound):
+		return exitNotFound
+	case errors.Is(err, parser.ErrVideoPrivate):
+		return exitPrivate
+	case errors.Is(err, parser.ErrRateLimited):
+		return exitRateLimited
+	case errors.Is(err, parser.ErrLayoutChanged):
+		return exitLayoutChanged
+	case errors.Is(err, parser.ErrNetwork):
+		return exitNetwork
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, context.Canceled):
+		return exitCanceled
+	default:
+		return exitError
+	}
+}
+
+// errUsage 命令或参数错误, 已输出用法
+var errUsage = errors.New("usage error")
+
+// reportedError 已经输出过的错误, run 只根据它返回退出码
+type reportedError struct {
+	err error
+}
+
+func (e reportedError) Error() string { return e.err.Error() }
+
+func (e reportedError) Unwrap() error { return e.err }
+
+// command 子命令
+type command struct {
+	name  string
+	usage string // 参数说明
+	short string // 一行说明
+	run   func(ctx context.Context, env *env, args []string) error
+}
+
+var commands = []command{
+	{name: "parse", usage: "[flags] <分享文本或链接>", short: "解析分享链接, 输出视频信息", run: runParse},
+	{name: "id", usage: "[flags] <渠道> <视频id>", short: "根据渠道和视频id解析", run: runId},
+	{name: "download", usage: "[flags] <分享文本或链接>", short: "解析后下载视频、封面和图集", run: runDownload},
+	{name: "batch", usage: "[flags] -f <文件>", short: "批量解析文件中的分享链接, 每行一条", run: runBatch},
+	{name: "sources", usage: "[flags]", short: "列出支持的渠道", run: runSources},
+}
+
+// env 命令的输入输出, 测试时替换
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run 执行子命令, 返回退出码
+func run(ctx context.Context, env *env, args []string) int {
+	if len(args) <= 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		printUsage(env.stderr)
+		if len(args) <= 0 {
+			return exitUsage
+		}
+		return exitOk
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(ctx, env, args[1:])
+		switch {
+		case err == nil:
+			return exitOk
+		case errors.Is(err, flag.ErrHelp):
+			return exitOk
+		case errors.Is(err, errUsage):
+			return exitUsage
+		}
+		if !errors.As(err, new(reportedError)) {
+			fmt.Fprintln(env.stderr, "parse-video:", err)
+		}
+		return exitCode(err)
+	}
+	fmt.Fprintf(env.stderr, "parse-video: 未知命令 %q\n\n", args[0])
+	printUsage(env.stderr)
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: parse-video <命令> [flags] [参数]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "命令:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "parse-video <命令> -h 查看命令的参数; flags 需要写在参数之前")
+	fmt.Fprintln(w, "退出码: 0 成功, 1 未分类错误, 2 参数错误, 3 不支持的渠道, 4 链接或id格式错误, 5 视频不存在,")
+	fmt.Fprintln(w, "        6 视频不公开, 7 被限流, 8 上游结构变化, 9 网络错误, 10 超时, 130 被中断")
+}
+
+// clientFlags 解析客户端相关的参数, 所有子命令共用
+type clientFlags struct {
+	proxy       string
+	timeout     time.Duration
+	quality     string
+	allPages    bool
+	concurrency int
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.proxy, "proxy", os.Getenv("PARSE_VIDEO_PROXY_URL"), "请求视频平台使用的代理, 支持 http/https/socks5, 默认读取环境变量 PARSE_VIDEO_PROXY_URL")
+	fs.DurationVar(&f.timeout, "timeout", 30*time.Second, "请求视频平台的超时时间, 0 不限制")
+	fs.StringVar(&f.quality, "quality", "", "优先选择的清晰度, 如: 1080P")
+	fs.BoolVar(&f.allPages, "all-pages", false, "多P视频返回所有分P")
+}
+
+// client 根据参数创建解析客户端
+func (f *clientFlags) client() (*parser.Client, error) {
+	opts := []parser.ClientOption{
+		parser.WithTimeout(f.timeout),
+		parser.WithPreferredQuality(f.quality),
+		parser.WithAllPages(f.allPages),
+	}
+	if len(f.proxy) > 0 {
+		opts = append(opts, parser.WithProxy(f.proxy))
+	}
+	if f.concurrency > 0 {
+		opts = append(opts, parser.WithBatchConcurrency(f.concurrency))
+	}
+	return parser.NewClient(opts...)
+}
+
+// newFlagSet 创建子命令的参数解析, 错误输出到 stderr
+func newFlagSet(env *env, name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(env.stderr, "用法: parse-video %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags 解析参数并检查位置参数的个数
+func parseFlags(fs *flag.FlagSet, args []string, nArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if nArgs >= 0 && fs.NArg() != nArgs {
+		fmt.Fprintf(fs.Output(), "需要 %d 个参数, 实际 %d 个\n", nArgs, fs.NArg())
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// outputFlag -o 输出格式
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("o", "json", "输出格式: json 或 table")
+}
+
+// checkOutput 检查输出格式
+func checkOutput(fs *flag.FlagSet, output string) error {
+	if output != "json" && output != "table" {
+		fmt.Fprintf(fs.Output(), "输出格式错误 %q, 需要 json 或 table\n", output)
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
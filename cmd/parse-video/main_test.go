@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// fakeParser 测试用的渠道, 分享链接的路径即视频id, 视频id为 missing 时返回不存在
+type fakeParser struct {
+	mediaUrl string
+}
+
+func (p fakeParser) ParseShareUrl(ctx context.Context, shareUrl string) (*parser.VideoParseInfo, error) {
+	return p.ParseVideoID(ctx, shareUrl[strings.LastIndex(shareUrl, "/")+1:])
+}
+
+func (p fakeParser) ParseVideoID(_ context.Context, videoId string) (*parser.VideoParseInfo, error) {
+	if videoId == "missing" {
+		return nil, &parser.ParseError{Kind: parser.ErrVideoNotFound}
+	}
+	info := &parser.VideoParseInfo{
+		Title:    "title\t" + videoId,
+		VideoUrl: p.mediaUrl + "/video",
+		CoverUrl: p.mediaUrl + "/cover.jpg",
+		Images:   []string{p.mediaUrl + "/image?id=1"},
+	}
+	info.Author.Name = "author"
+	return info, nil
+}
+
+// runCli 执行命令, 返回退出码和输出
+func runCli(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), &env{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}, args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://cli.test/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/video":
+			w.Header().Set("Content-Type", "video/mp4")
+		case "/image":
+			w.Header().Set("Content-Type", "image/webp")
+		}
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer media.Close()
+
+	const source = "cli_test"
+	if err := parser.Register(source, parser.SourceInfo{
+		VideoShareUrlDomain: []string{"cli.test"},
+		VideoShareUrlParser: fakeParser{media.URL},
+		VideoIdParser:       fakeParser{media.URL},
+		MediaDomains:        []string{"127.0.0.1"},
+		MediaHeaders:        map[string]string{"Referer": "https://cli.test/"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer parser.Unregister(source)
+
+	for _, tt := range []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+	}{
+		{name: "no command", code: exitUsage},
+		{name: "unknown command", args: []string{"nope"}, code: exitUsage},
+		{name: "parse json", args: []string{"parse", "看看 https://cli.test/v/1 复制打开"}, code: exitOk, stdout: `"title": "title\t1"`},
+		{name: "parse table", args: []string{"parse", "-o", "table", "https://cli.test/v/1"}, code: exitOk, stdout: "title      title 1\n"},
+		{name: "parse bad output", args: []string{"parse", "-o", "xml", "https://cli.test/v/1"}, code: exitUsage},
+		{name: "parse missing arg", args: []string{"parse"}, code: exitUsage},
+		{name: "parse invalid", args: []string{"parse", "no url"}, code: exitInvalidInput},
+		{name: "parse unsupported", args: []string{"parse", "https://example.com/1"}, code: exitUnsupported},
+		{name: "parse not found", args: []string{"parse", "https://cli.test/v/missing"}, code: exitNotFound},
+		{name: "id", args: []string{"id", source, "2"}, code: exitOk, stdout: `"title": "title\t2"`},
+		{name: "id not found", args: []string{"id", source, "missing"}, code: exitNotFound},
+		{name: "sources", args: []string{"sources", "-o", "table"}, code: exitOk, stdout: "cli_test "},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCli(t, "", tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d, stderr: %s", code, tt.code, stderr)
+			}
+			if !strings.Contains(stdout, tt.stdout) {
+				t.Errorf("stdout = %q, want contains %q", stdout, tt.stdout)
+			}
+		})
+	}
+
+	t.Run("batch", func(t *testing.T) {
+		input := "# 注释\nhttps://cli.test/v/1\n\nhttps://cli.test/v/missing\nhttps://CLI.test/v/1/\n"
+		code, stdout, stderr := runCli(t, input, "batch", "-f", "-")
+		if code != exitNotFound {
+			t.Errorf("exit code = %d, want %d, stderr: %s", code, exitNotFound, stderr)
+		}
+		lines := make(map[int]batchLine)
+		for _, text := range strings.Split(strings.TrimSpace(stdout), "\n") {
+			var line batchLine
+			if err := json.Unmarshal([]byte(text), &line); err != nil {
+				t.Fatalf("line %s: %v", text, err)
+			}
+			lines[line.Index] = line
+		}
+		if len(lines) != 2 || lines[0].Data == nil || len(lines[0].Duplicates) != 1 || lines[1].Error.Code != exitNotFound {
+			t.Errorf("batch output = %s", stdout)
+		}
+	})
+
+	t.Run("download", func(t *testing.T) {
+		dir := t.TempDir()
+		code, stdout, stderr := runCli(t, "", "download", "-dir", dir, "-template", "{title}/v1.{ext}", "-progress", "https://cli.test/v/1")
+		if code != exitOk {
+			t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+		}
+		want := map[string]string{"title 1/v1.mp4": "/video", "title 1/v1_cover.jpg": "/cover.jpg", "title 1/v1_01.jpg": "/image"}
+		if files := strings.Split(strings.TrimSpace(stdout), "\n"); len(files) != len(want) {
+			t.Errorf("download output = %q, want %d files", stdout, len(want))
+		}
+		for name, content := range want {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil || string(data) != content {
+				t.Errorf("file %s = %q, %v, want %q", name, data, err, content)
+			}
+		}
+		if part, _ := filepath.Glob(filepath.Join(dir, "*", "*.part*")); len(part) > 0 {
+			t.Errorf("part files not removed: %v", part)
+		}
+		if !strings.Contains(stderr, "v1.mp4 100%") {
+			t.Errorf("progress output = %q", stderr)
+		}
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		code int
+	}{
+		{err: nil, code: exitOk},
+		{err: &parser.ParseError{Kind: parser.ErrRateLimited}, code: exitRateLimited},
+		{err: &parser.ParseError{Kind: parser.ErrLayoutChanged}, code: exitLayoutChanged},
+		{err: &parser.ParseError{Kind: parser.ErrNetwork}, code: exitNetwork},
+		{err: &parser.ParseError{Err: context.DeadlineExceeded}, code: exitTimeout},
+		{err: reportedError{err: context.Canceled}, code: exitCanceled},
+		{err: os.ErrNotExist, code: exitError},
+	} {
+		if code := exitCode(tt.err); code != tt.code {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+// Package config 加载 http 服务的配置
+// 优先级从低到高: 默认值 < 配置文件(yaml/toml) < 环境变量 < 命令行参数
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// EnvPrefix 环境变量前缀, 如 http.addr 对应 PARSE_VIDEO_HTTP_ADDR
+const EnvPrefix = "PARSE_VIDEO_"
+
+// Config 服务配置
+type Config struct {
+	Mode     string         `yaml:"mode" toml:"mode"` // gin 运行模式: debug, release, test
+	Http     HttpConfig     `yaml:"http" toml:"http"`
+	Https    HttpsConfig    `yaml:"https" toml:"https"`
+	Timeouts TimeoutsConfig `yaml:"timeouts" toml:"timeouts"`
+	Cors     CorsConfig     `yaml:"cors" toml:"cors"`
+	Proxy    ProxyConfig    `yaml:"proxy" toml:"proxy"`
+	Stream   StreamConfig   `yaml:"stream" toml:"stream"`
+	Sources  SourcesConfig  `yaml:"sources" toml:"sources"`
+	Batch    BatchConfig    `yaml:"batch" toml:"batch"`
+	Jobs     JobsConfig     `yaml:"jobs" toml:"jobs"`
+	Gallery  GalleryConfig  `yaml:"gallery" toml:"gallery"`
+}
+
+// HttpConfig http 服务
+type HttpConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"`
+	Addr    string `yaml:"addr" toml:"addr"` // 监听地址, 如: :8080
+}
+
+// HttpsConfig https 服务
+type HttpsConfig struct {
+	Enabled  bool   `yaml:"enabled" toml:"enabled"`
+	Addr     string `yaml:"addr" toml:"addr"`           // 监听地址, 如: :8443
+	CertFile string `yaml:"cert_file" toml:"cert_file"` // 证书文件, 包含完整证书链
+	KeyFile  string `yaml:"key_file" toml:"key_file"`   // 私钥文件
+
+	// WatchInterval 检查证书文件变化的间隔, 变化后自动重新加载, 0 表示不检查, 仍可通过 SIGHUP 重新加载
+	WatchInterval Duration   `yaml:"watch_interval" toml:"watch_interval"`
+	Acme          AcmeConfig `yaml:"acme" toml:"acme"` // 启用后通过 ACME 自动申请证书, 不使用 cert_file 和 key_file
+}
+
+// AcmeConfig ACME 自动申请证书
+type AcmeConfig struct {
+	Enabled      bool     `yaml:"enabled" toml:"enabled"`
+	DirectoryUrl string   `yaml:"directory_url" toml:"directory_url"` // ACME 服务目录地址, 测试时可使用 Pebble 或 Let's Encrypt 测试环境
+	Domains      []string `yaml:"domains" toml:"domains"`             // 申请证书的域名
+	Email        string   `yaml:"email" toml:"email"`                 // 联系邮箱
+	CacheDir     string   `yaml:"cache_dir" toml:"cache_dir"`         // 证书和账号密钥的缓存目录
+	CaFile       string   `yaml:"ca_file" toml:"ca_file"`             // 访问 ACME 服务时额外信任的根证书, 如 Pebble 的自签名证书
+}
+
+// TimeoutsConfig 超时设置, 0 表示不限制
+type TimeoutsConfig struct {
+	Read     Duration `yaml:"read" toml:"read"`         // 读取请求的超时时间
+	Write    Duration `yaml:"write" toml:"write"`       // 写入响应的超时时间, 视频代理和下载接口耗时较长, 建议不设置
+	Idle     Duration `yaml:"idle" toml:"idle"`         // keep-alive 连接空闲超时时间
+	Shutdown Duration `yaml:"shutdown" toml:"shutdown"` // 优雅关闭的最长等待时间
+	Parse    Duration `yaml:"parse" toml:"parse"`       // 请求视频平台接口的超时时间
+}
+
+// CorsConfig 跨域设置
+type CorsConfig struct {
+	AllowOrigins []string `yaml:"allow_origins" toml:"allow_origins"` // 允许跨域的来源, * 表示允许所有来源, 为空时不允许跨域
+}
+
+// ProxyConfig 请求视频平台使用的代理
+type ProxyConfig struct {
+	Url string `yaml:"url" toml:"url"` // 代理地址, 如: http://127.0.0.1:7890, socks5://127.0.0.1:1080
+}
+
+// StreamConfig /video/stream 代理令牌设置
+type StreamConfig struct {
+	Secret string   `yaml:"secret" toml:"secret"` // 令牌签名密钥, 至少16字节, 为空时随机生成
+	Ttl    Duration `yaml:"ttl" toml:"ttl"`       // 令牌有效期
+}
+
+// SourcesConfig 启用的视频渠道, Enabled 和 Disabled 只能设置一个
+type SourcesConfig struct {
+	Enabled  []string `yaml:"enabled" toml:"enabled"`   // 只启用这些渠道, 为空时启用所有渠道
+	Disabled []string `yaml:"disabled" toml:"disabled"` // 禁用这些渠道
+
+	// RateLimit 每个渠道每秒最多请求上游的次数, 所有接口共享, 0 表示不限制
+	RateLimit float64 `yaml:"rate_limit" toml:"rate_limit"`
+	RateBurst int     `yaml:"rate_burst" toml:"rate_burst"` // 允许短时间内突发的请求次数
+}
+
+// BatchConfig 批量解析接口 /video/batch 设置
+type BatchConfig struct {
+	MaxItems     int      `yaml:"max_items" toml:"max_items"`           // 每次请求最多解析的条数
+	Concurrency  int      `yaml:"concurrency" toml:"concurrency"`       // 每次请求同时解析的条数
+	MaxAsyncJobs int      `yaml:"max_async_jobs" toml:"max_async_jobs"` // 同时在后台解析的 async=1 任务数, 超过时返回 429
+	AsyncTimeout Duration `yaml:"async_timeout" toml:"async_timeout"`   // 后台解析任务的最长执行时间, 超时后未解析的条目失败
+}
+
+// JobsConfig 异步任务 /jobs 设置
+type JobsConfig struct {
+	Store       string   `yaml:"store" toml:"store"`               // 任务存储: memory 重启后丢失, file 保存在文件中, 重启后继续执行未完成的任务
+	File        string   `yaml:"file" toml:"file"`                 // store 为 file 时的文件路径
+	Workers     int      `yaml:"workers" toml:"workers"`           // 同时执行的任务数
+	MaxAttempts int      `yaml:"max_attempts" toml:"max_attempts"` // 每个任务最多执行的次数, 只有网络错误、被限流、超时会重试
+	RetryDelay  Duration `yaml:"retry_delay" toml:"retry_delay"`   // 第一次重试前等待的时间, 之后每次翻倍
+	Ttl         Duration `yaml:"ttl" toml:"ttl"`                   // 结束的任务保留的时间, 0 表示一直保留
+	DownloadDir string   `yaml:"download_dir" toml:"download_dir"` // 下载任务保存视频的目录
+	MaxPending  int      `yaml:"max_pending" toml:"max_pending"`   // 未结束的任务数上限, 超过时提交返回 429
+	MaxFileMB   int      `yaml:"max_file_mb" toml:"max_file_mb"`   // 下载任务每个视频的大小上限, 单位 MB
+	MaxDiskMB   int      `yaml:"max_disk_mb" toml:"max_disk_mb"`   // 下载目录的总大小上限, 单位 MB, 超过时新的下载任务失败, 0 表示不限制
+}
+
+// GalleryConfig 图集打包下载接口 /video/gallery.zip 设置
+type GalleryConfig struct {
+	MaxSizeMB int `yaml:"max_size_mb" toml:"max_size_mb"` // 每次打包的图片和封面总大小上限, 单位 MB
+}
+
+// Duration 支持 "30s", "5m" 格式的时长
+type Duration time.Duration
+
+// UnmarshalText 解析 "30s", "5m" 格式的时长
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// MarshalText 输出 "30s", "5m" 格式的时长
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default 默认配置: 只启用 http 服务, 监听 8080 端口
+func Default() *Config {
+	return &Config{
+		Mode: "release",
+		Http: HttpConfig{
+			Enabled: true,
+			Addr:    ":8080",
+		},
+		Https: HttpsConfig{
+			Addr:     ":8443",
+			CertFile: "full_chain_rsa.crt",
+			KeyFile:  "redjue.top.key",
+
+			WatchInterval: Duration(time.Minute),
+			Acme: AcmeConfig{
+				DirectoryUrl: "https://acme-v02.api.letsencrypt.org/directory",
+				CacheDir:     "acme-cache",
+			},
+		},
+		Timeouts: TimeoutsConfig{
+			Read:     Duration(30 * time.Second),
+			Idle:     Duration(120 * time.Second),
+			Shutdown: Duration(5 * time.Second),
+		},
+		Cors: CorsConfig{
+			AllowOrigins: []string{"*"},
+		},
+		Stream: StreamConfig{
+			Ttl: Duration(2 * time.Hour),
+		},
+		Sources: SourcesConfig{
+			RateBurst: 5,
+		},
+		Batch: BatchConfig{
+			MaxItems:     50,
+			Concurrency:  8,
+			MaxAsyncJobs: 4,
+			AsyncTimeout: Duration(5 * time.Minute),
+		},
+		Jobs: JobsConfig{
+			Store:       "memory",
+			File:        "jobs.json",
+			Workers:     4,
+			MaxAttempts: 3,
+			RetryDelay:  Duration(5 * time.Second),
+			Ttl:         Duration(24 * time.Hour),
+			DownloadDir: "downloads",
+			MaxPending:  100,
+			MaxFileMB:   2048,
+			MaxDiskMB:   10240,
+		},
+		Gallery: GalleryConfig{
+			MaxSizeMB: 200,
+		},
+	}
+}
+
+// Load 加载配置, args 为命令行参数(不含程序名), getenv 用于读取环境变量
+// 配置文件通过 -config 参数或 PARSE_VIDEO_CONFIG 环境变量指定, 根据扩展名识别 yaml/toml 格式
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	c := Default()
+
+	fs := flag.NewFlagSet("parse-video", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config", getenv(EnvPrefix+"CONFIG"), "配置文件路径, 支持 .yaml/.yml/.toml")
+	var flagValues []fieldValue
+	for _, f := range fields {
+		fs.Var(&flagRecorder{field: f, values: &flagValues}, f.flagName(), f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w\n%s", err, Usage())
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	if len(*configFile) > 0 {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := lookupEnv(getenv, f.envName()); ok {
+			if err := f.set(c, value); err != nil {
+				return nil, fmt.Errorf("env %s: %w", f.envName(), err)
+			}
+		}
+	}
+	for _, item := range flagValues {
+		if err := item.field.set(c, item.value); err != nil {
+			return nil, fmt.Errorf("flag -%s: %w", item.field.flagName(), err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// lookupEnv 读取环境变量, 空字符串视为未设置
+func lookupEnv(getenv func(string) string, name string) (string, bool) {
+	value := getenv(name)
+	return value, len(value) > 0
+}
+
+// loadFile 从配置文件加载, 文件中未出现的配置项保持原值
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(c); err != nil {
+			var strictErr *toml.StrictMissingError
+			if errors.As(err, &strictErr) {
+				return fmt.Errorf("parse config file %s: %s", path, strictErr.String())
+			}
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q, want .yaml, .yml or .toml", ext)
+	}
+	return nil
+}
+
+// Validate 校验配置, 返回所有错误
+func (c *Config) Validate() error {
+	var errs []error
+	addErr := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
+
+	switch c.Mode {
+	case "debug", "release", "test":
+	default:
+		addErr("mode", "invalid mode %q, want debug, release or test", c.Mode)
+	}
+
+	if !c.Http.Enabled && !c.Https.Enabled {
+		errs = append(errs, errors.New("http.enabled, https.enabled: at least one of http and https must be enabled"))
+	}
+	if c.Http.Enabled {
+		if err := checkAddr(c.Http.Addr); err != nil {
+			addErr("http.addr", "%v", err)
+		}
+	}
+	if c.Https.Enabled {
+		if err := checkAddr(c.Https.Addr); err != nil {
+			addErr("https.addr", "%v", err)
+		}
+		if c.Http.Enabled && c.Http.Addr == c.Https.Addr {
+			addErr("https.addr", "same as http.addr %q", c.Http.Addr)
+		}
+		if c.Https.Acme.Enabled {
+			errs = append(errs, c.Https.Acme.validate()...)
+		} else {
+			for _, item := range []struct{ key, file string }{
+				{"https.cert_file", c.Https.CertFile},
+				{"https.key_file", c.Https.KeyFile},
+			} {
+				if len(item.file) <= 0 {
+					addErr(item.key, "required when https is enabled")
+				} else if _, err := os.Stat(item.file); err != nil {
+					addErr(item.key, "%v", err)
+				}
+			}
+		}
+	} else if c.Https.Acme.Enabled {
+		addErr("https.acme.enabled", "requires https.enabled")
+	}
+
+	for _, item := range []struct {
+		key string
+		d   Duration
+	}{
+		{"timeouts.read", c.Timeouts.Read},
+		{"timeouts.write", c.Timeouts.Write},
+		{"timeouts.idle", c.Timeouts.Idle},
+		{"timeouts.shutdown", c.Timeouts.Shutdown},
+		{"timeouts.parse", c.Timeouts.Parse},
+		{"https.watch_interval", c.Https.WatchInterval},
+		{"jobs.retry_delay", c.Jobs.RetryDelay},
+		{"jobs.ttl", c.Jobs.Ttl},
+	} {
+		if item.d < 0 {
+			addErr(item.key, "must not be negative, got %s", time.Duration(item.d))
+		}
+	}
+
+	for _, origin := range c.Cors.AllowOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) <= 0 || len(u.Path) > 0 {
+			addErr("cors.allow_origins", "invalid origin %q, want * or scheme://host[:port]", origin)
+		}
+	}
+
+	if len(c.Proxy.Url) > 0 {
+		u, err := url.Parse(c.Proxy.Url)
+		if err != nil || len(u.Host) <= 0 {
+			addErr("proxy.url", "invalid url %q", c.Proxy.Url)
+		} else if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			addErr("proxy.url", "unsupported scheme %q, want http, https or socks5", u.Scheme)
+		}
+	}
+
+	if len(c.Stream.Secret) > 0 && len(c.Stream.Secret) < 16 {
+		addErr("stream.secret", "must be at least 16 bytes")
+	}
+	if c.Stream.Ttl <= 0 {
+		addErr("stream.ttl", "must be positive, got %s", time.Duration(c.Stream.Ttl))
+	}
+
+	switch c.Jobs.Store {
+	case "memory":
+	case "file":
+		if len(c.Jobs.File) <= 0 {
+			addErr("jobs.file", "required when jobs.store is file")
+		}
+	default:
+		addErr("jobs.store", "invalid store %q, want memory or file", c.Jobs.Store)
+	}
+	if c.Jobs.Workers <= 0 {
+		addErr("jobs.workers", "must be positive, got %d", c.Jobs.Workers)
+	}
+	if c.Jobs.MaxAttempts <= 0 {
+		addErr("jobs.max_attempts", "must be positive, got %d", c.Jobs.MaxAttempts)
+	}
+	if len(c.Jobs.DownloadDir) <= 0 {
+		addErr("jobs.download_dir", "required")
+	}
+	if c.Jobs.MaxPending <= 0 {
+		addErr("jobs.max_pending", "must be positive, got %d", c.Jobs.MaxPending)
+	}
+	if c.Jobs.MaxFileMB <= 0 {
+		addErr("jobs.max_file_mb", "must be positive, got %d", c.Jobs.MaxFileMB)
+	}
+	if c.Jobs.MaxDiskMB < 0 {
+		addErr("jobs.max_disk_mb", "must not be negative, got %d", c.Jobs.MaxDiskMB)
+	}
+	if c.Gallery.MaxSizeMB <= 0 {
+		addErr("gallery.max_size_mb", "must be positive, got %d", c.Gallery.MaxSizeMB)
+	}
+
+	if c.Sources.RateLimit < 0 {
+		addErr("sources.rate_limit", "must not be negative, got %g", c.Sources.RateLimit)
+	}
+	if c.Sources.RateLimit > 0 && c.Sources.RateBurst <= 0 {
+		addErr("sources.rate_burst", "must be positive when rate_limit is set, got %d", c.Sources.RateBurst)
+	}
+	if c.Batch.MaxItems <= 0 {
+		addErr("batch.max_items", "must be positive, got %d", c.Batch.MaxItems)
+	}
+	if c.Batch.Concurrency <= 0 {
+		addErr("batch.concurrency", "must be positive, got %d", c.Batch.Concurrency)
+	}
+	if c.Batch.MaxAsyncJobs <= 0 {
+		addErr("batch.max_async_jobs", "must be positive, got %d", c.Batch.MaxAsyncJobs)
+	}
+	if c.Batch.AsyncTimeout <= 0 {
+		addErr("batch.async_timeout", "must be positive, got %s", time.Duration(c.Batch.AsyncTimeout))
+	}
+
+	if len(c.Sources.Enabled) > 0 && len(c.Sources.Disabled) > 0 {
+		errs = append(errs, errors.New("sources.enabled, sources.disabled: only one of them can be set"))
+	}
+	knownSources := make(map[string]bool)
+	for _, item := range parser.Sources() {
+		knownSources[item.Source] = true
+	}
+	for _, item := range []struct {
+		key     string
+		sources []string
+	}{
+		{"sources.enabled", c.Sources.Enabled},
+		{"sources.disabled", c.Sources.Disabled},
+	} {
+		for _, source := range item.sources {
+			if !knownSources[source] {
+				addErr(item.key, "unknown source %q", source)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate 校验 ACME 配置
+func (a AcmeConfig) validate() []error {
+	var errs []error
+	if len(a.Domains) <= 0 {
+		errs = append(errs, errors.New("https.acme.domains: required when acme is enabled"))
+	}
+	if u, err := url.Parse(a.DirectoryUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) <= 0 {
+		errs = append(errs, fmt.Errorf("https.acme.directory_url: invalid url %q", a.DirectoryUrl))
+	}
+	if len(a.CacheDir) <= 0 {
+		errs = append(errs, errors.New("https.acme.cache_dir: required when acme is enabled"))
+	}
+	if len(a.CaFile) > 0 {
+		if _, err := os.Stat(a.CaFile); err != nil {
+			errs = append(errs, fmt.Errorf("https.acme.ca_file: %w", err))
+		}
+	}
+	return errs
+}
+
+// checkAddr 校验监听地址, 格式: [host]:port
+func checkAddr(addr string) error {
+	if len(addr) <= 0 {
+		return errors.New("required")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEnv 返回读取 env 的 getenv
+func testEnv(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_default(t *testing.T) {
+	c, err := Load(nil, testEnv(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, Default()) {
+		t.Errorf("Load() = %+v, want default %+v", c, Default())
+	}
+}
+
+func TestLoad_precedence(t *testing.T) {
+	certFile := writeFile(t, "cert.pem", "cert")
+	keyFile := writeFile(t, "key.pem", "key")
+
+	yamlFile := writeFile(t, "config.yaml", `
+mode: debug
+http:
+  addr: ":7777"
+https:
+  enabled: true
+  addr: ":7778"
+  cert_file: `+certFile+`
+  key_file: `+keyFile+`
+timeouts:
+  read: 10s
+  parse: 15s
+cors:
+  allow_origins: ["https://a.example.com"]
+sources:
+  disabled: [douyin]
+`)
+	tomlFile := writeFile(t, "config.toml", `
+mode = "debug"
+
+[http]
+addr = ":7777"
+
+[https]
+enabled = true
+addr = ":7778"
+cert_file = "`+certFile+`"
+key_file = "`+keyFile+`"
+
+[timeouts]
+read = "10s"
+parse = "15s"
+
+[cors]
+allow_origins = ["https://a.example.com"]
+
+[sources]
+disabled = ["douyin"]
+`)
+
+	for _, file := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(file), func(t *testing.T) {
+			env := map[string]string{
+				"PARSE_VIDEO_CONFIG":        file,
+				"PARSE_VIDEO_HTTP_ADDR":     ":9000",
+				"PARSE_VIDEO_TIMEOUTS_READ": "20s",
+				"PARSE_VIDEO_STREAM_SECRET": "0123456789abcdef",
+			}
+			c, err := Load([]string{"-http-addr", ":9001", "-cors-allow-origins", "https://b.example.com, https://c.example.com"}, testEnv(env))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := Default()
+			want.Mode = "debug"
+			want.Http.Addr = ":9001" // 命令行参数 > 环境变量 > 配置文件
+			want.Https.Enabled, want.Https.Addr = true, ":7778"
+			want.Https.CertFile, want.Https.KeyFile = certFile, keyFile
+			want.Timeouts.Read = Duration(20 * time.Second)
+			want.Timeouts.Parse = Duration(15 * time.Second)
+			want.Cors.AllowOrigins = []string{"https://b.example.com", "https://c.example.com"}
+			want.Stream.Secret = "0123456789abcdef"
+			want.Sources.Disabled = []string{"douyin"}
+			if !reflect.DeepEqual(c, want) {
+				t.Errorf("Load() = %+v\nwant %+v", c, want)
+			}
+		})
+	}
+}
+
+func TestLoad_acme(t *testing.T) {
+	// 启用 ACME 时不需要证书文件
+	c, err := Load([]string{"-https-enabled", "-https-cert-file", "missing.crt", "-https-acme-enabled", "-https-acme-domains", "a.example.com,b.example.com", "-https-acme-directory-url", "https://localhost:14000/dir"}, testEnv(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(c.Https.Acme.Domains, want) {
+		t.Errorf("acme domains = %v, want %v", c.Https.Acme.Domains, want)
+	}
+}
+
+func TestLoad_boolFlag(t *testing.T) {
+	c, err := Load([]string{"-http-enabled=false", "-https-enabled", "-https-cert-file", "config.go", "-https-key-file", "config.go"}, testEnv(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Http.Enabled || !c.Https.Enabled {
+		t.Errorf("http enabled = %v, https enabled = %v", c.Http.Enabled, c.Https.Enabled)
+	}
+}
+
+func TestLoad_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "invalid values",
+			args: []string{"-mode", "prod", "-http-addr", "8080", "-https-enabled", "-https-cert-file", "missing.crt", "-https-key-file", ""},
+			want: []string{"mode: invalid mode", "http.addr: invalid address", "https.cert_file:", "https.key_file: required"},
+		},
+		{
+			name: "acme",
+			args: []string{"-https-enabled", "-https-acme-enabled", "-https-acme-directory-url", "localhost:14000/dir", "-https-acme-ca-file", "missing.pem"},
+			want: []string{"https.acme.domains: required", "https.acme.directory_url: invalid url", "https.acme.ca_file:"},
+		},
+		{
+			name: "acme without https",
+			args: []string{"-https-acme-enabled", "-https-acme-domains", "example.com"},
+			want: []string{"https.acme.enabled: requires https.enabled"},
+		},
+		{
+			name: "nothing enabled",
+			args: []string{"-http-enabled=false"},
+			want: []string{"at least one of http and https"},
+		},
+		{
+			name: "stream and cors",
+			env:  map[string]string{"PARSE_VIDEO_STREAM_SECRET": "short", "PARSE_VIDEO_CORS_ALLOW_ORIGINS": "example.com"},
+			want: []string{"stream.secret:", "cors.allow_origins: invalid origin"},
+		},
+		{
+			name: "sources",
+			args: []string{"-sources-enabled", "douyin,nope", "-sources-disabled", "kuaishou"},
+			want: []string{"only one of them", `sources.enabled: unknown source "nope"`},
+		},
+		{
+			name: "proxy",
+			args: []string{"-proxy-url", "ftp://127.0.0.1:21"},
+			want: []string{"proxy.url: unsupported scheme"},
+		},
+		{
+			name: "batch",
+			args: []string{"-batch-max-items", "0", "-batch-concurrency", "-1", "-batch-max-async-jobs", "0", "-batch-async-timeout", "0s"},
+			want: []string{"batch.max_items: must be positive", "batch.concurrency: must be positive", "batch.max_async_jobs: must be positive", "batch.async_timeout: must be positive"},
+		},
+		{
+			name: "rate limit",
+			args: []string{"-sources-rate-limit", "2", "-sources-rate-burst", "0"},
+			want: []string{"sources.rate_burst: must be positive"},
+		},
+		{
+			name: "bad number",
+			args: []string{"-sources-rate-limit", "fast"},
+			want: []string{"sources-rate-limit", "invalid number"},
+		},
+		{
+			name: "jobs",
+			args: []string{"-jobs-store", "redis", "-jobs-workers", "0", "-jobs-max-attempts", "0", "-jobs-download-dir", "", "-jobs-ttl", "-1h", "-jobs-max-pending", "0", "-jobs-max-file-mb", "0", "-jobs-max-disk-mb", "-1"},
+			want: []string{"jobs.store: invalid store", "jobs.workers:", "jobs.max_attempts:", "jobs.download_dir: required", "jobs.ttl: must not be negative", "jobs.max_pending:", "jobs.max_file_mb:", "jobs.max_disk_mb: must not be negative"},
+		},
+		{
+			name: "gallery",
+			env:  map[string]string{"PARSE_VIDEO_GALLERY_MAX_SIZE_MB": "0"},
+			want: []string{"gallery.max_size_mb: must be positive"},
+		},
+		{
+			name: "bad integer",
+			args: []string{"-batch-max-items", "ten"},
+			want: []string{"batch-max-items", "invalid integer"},
+		},
+		{
+			name: "bad duration",
+			env:  map[string]string{"PARSE_VIDEO_TIMEOUTS_READ": "10"},
+			want: []string{"env PARSE_VIDEO_TIMEOUTS_READ"},
+		},
+		{
+			name: "bad flag",
+			args: []string{"-timeouts-idle", "abc"},
+			want: []string{"timeouts-idle"},
+		},
+		{
+			name: "unknown yaml key",
+			env:  map[string]string{"PARSE_VIDEO_CONFIG": "testdata/unknown.yaml"},
+			want: []string{"field htttp not found"},
+		},
+		{
+			name: "unknown toml key",
+			env:  map[string]string{"PARSE_VIDEO_CONFIG": "testdata/unknown.toml"},
+			want: []string{"htttp"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.args, testEnv(tt.env))
+			if err == nil {
+				t.Fatal("Load() want error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %v, want contains %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_help(t *testing.T) {
+	_, err := Load([]string{"-h"}, testEnv(nil))
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Load(-h) error = %v, want %v", err, flag.ErrHelp)
+	}
+	if usage := Usage(); !strings.Contains(usage, "-https-cert-file string") || !strings.Contains(usage, "PARSE_VIDEO_HTTPS_CERT_FILE") {
+		t.Errorf("Usage() = %s", usage)
+	}
+}
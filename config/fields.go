@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// field 可通过环境变量和命令行参数设置的配置项
+type field struct {
+	key   string // 配置文件中的路径, 如: http.addr
+	usage string
+	bool  bool // 是否为布尔值, 命令行参数可省略值, 如: -https
+	set   func(c *Config, value string) error
+}
+
+// envName 环境变量名, 如: http.addr -> PARSE_VIDEO_HTTP_ADDR
+func (f field) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.key, ".", "_"))
+}
+
+// flagName 命令行参数名, 如: https.cert_file -> https-cert-file
+func (f field) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.key)
+}
+
+func stringField(key, usage string, get func(c *Config) *string) field {
+	return field{key: key, usage: usage, set: func(c *Config, value string) error {
+		*get(c) = value
+		return nil
+	}}
+}
+
+func boolField(key, usage string, get func(c *Config) *bool) field {
+	return field{key: key, usage: usage, bool: true, set: func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", value)
+		}
+		*get(c) = b
+		return nil
+	}}
+}
+
+func durationField(key, usage string, get func(c *Config) *Duration) field {
+	return field{key: key, usage: usage, set: func(c *Config, value string) error {
+		return get(c).UnmarshalText([]byte(value))
+	}}
+}
+
+func intField(key, usage string, get func(c *Config) *int) field {
+	return field{key: key, usage: usage, set: func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*get(c) = n
+		return nil
+	}}
+}
+
+func floatField(key, usage string, get func(c *Config) *float64) field {
+	return field{key: key, usage: usage, set: func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*get(c) = f
+		return nil
+	}}
+}
+
+// listField 逗号分隔的列表, 空字符串表示清空
+func listField(key, usage string, get func(c *Config) *[]string) field {
+	return field{key: key, usage: usage, set: func(c *Config, value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				list = append(list, item)
+			}
+		}
+		*get(c) = list
+		return nil
+	}}
+}
+
+// fields 所有可通过环境变量和命令行参数设置的配置项
+var fields = []field{
+	stringField("mode", "gin 运行模式: debug, release, test", func(c *Config) *string { return &c.Mode }),
+	boolField("http.enabled", "启用 http 服务", func(c *Config) *bool { return &c.Http.Enabled }),
+	stringField("http.addr", "http 监听地址, 如: :8080", func(c *Config) *string { return &c.Http.Addr }),
+	boolField("https.enabled", "启用 https 服务", func(c *Config) *bool { return &c.Https.Enabled }),
+	stringField("https.addr", "https 监听地址, 如: :8443", func(c *Config) *string { return &c.Https.Addr }),
+	stringField("https.cert_file", "https 证书文件", func(c *Config) *string { return &c.Https.CertFile }),
+	stringField("https.key_file", "https 私钥文件", func(c *Config) *string { return &c.Https.KeyFile }),
+	durationField("https.watch_interval", "检查证书文件变化的间隔, 0 不检查", func(c *Config) *Duration { return &c.Https.WatchInterval }),
+	boolField("https.acme.enabled", "通过 ACME 自动申请证书", func(c *Config) *bool { return &c.Https.Acme.Enabled }),
+	stringField("https.acme.directory_url", "ACME 服务目录地址", func(c *Config) *string { return &c.Https.Acme.DirectoryUrl }),
+	listField("https.acme.domains", "ACME 申请证书的域名, 逗号分隔", func(c *Config) *[]string { return &c.Https.Acme.Domains }),
+	stringField("https.acme.email", "ACME 联系邮箱", func(c *Config) *string { return &c.Https.Acme.Email }),
+	stringField("https.acme.cache_dir", "ACME 证书缓存目录", func(c *Config) *string { return &c.Https.Acme.CacheDir }),
+	stringField("https.acme.ca_file", "访问 ACME 服务时额外信任的根证书", func(c *Config) *string { return &c.Https.Acme.CaFile }),
+	durationField("timeouts.read", "读取请求超时时间, 如: 30s", func(c *Config) *Duration { return &c.Timeouts.Read }),
+	durationField("timeouts.write", "写入响应超时时间, 0 不限制", func(c *Config) *Duration { return &c.Timeouts.Write }),
+	durationField("timeouts.idle", "keep-alive 连接空闲超时时间", func(c *Config) *Duration { return &c.Timeouts.Idle }),
+	durationField("timeouts.shutdown", "优雅关闭的最长等待时间", func(c *Config) *Duration { return &c.Timeouts.Shutdown }),
+	durationField("timeouts.parse", "请求视频平台接口超时时间, 0 不限制", func(c *Config) *Duration { return &c.Timeouts.Parse }),
+	listField("cors.allow_origins", "允许跨域的来源, 逗号分隔, * 表示所有", func(c *Config) *[]string { return &c.Cors.AllowOrigins }),
+	stringField("proxy.url", "请求视频平台使用的代理, 如: socks5://127.0.0.1:1080", func(c *Config) *string { return &c.Proxy.Url }),
+	stringField("stream.secret", "/video/stream 令牌签名密钥, 至少16字节", func(c *Config) *string { return &c.Stream.Secret }),
+	durationField("stream.ttl", "/video/stream 令牌有效期, 如: 2h", func(c *Config) *Duration { return &c.Stream.Ttl }),
+	listField("sources.enabled", "只启用这些渠道, 逗号分隔", func(c *Config) *[]string { return &c.Sources.Enabled }),
+	listField("sources.disabled", "禁用这些渠道, 逗号分隔", func(c *Config) *[]string { return &c.Sources.Disabled }),
+	floatField("sources.rate_limit", "每个渠道每秒最多请求上游的次数, 0 不限制", func(c *Config) *float64 { return &c.Sources.RateLimit }),
+	intField("sources.rate_burst", "每个渠道允许突发的请求次数", func(c *Config) *int { return &c.Sources.RateBurst }),
+	intField("batch.max_items", "/video/batch 每次请求最多解析的条数", func(c *Config) *int { return &c.Batch.MaxItems }),
+	intField("batch.concurrency", "/video/batch 每次请求同时解析的条数", func(c *Config) *int { return &c.Batch.Concurrency }),
+	intField("batch.max_async_jobs", "同时在后台解析的 /video/batch?async=1 任务数", func(c *Config) *int { return &c.Batch.MaxAsyncJobs }),
+	durationField("batch.async_timeout", "/video/batch?async=1 后台解析任务的最长执行时间", func(c *Config) *Duration { return &c.Batch.AsyncTimeout }),
+	stringField("jobs.store", "异步任务存储: memory, file", func(c *Config) *string { return &c.Jobs.Store }),
+	stringField("jobs.file", "jobs.store 为 file 时的文件路径", func(c *Config) *string { return &c.Jobs.File }),
+	intField("jobs.workers", "同时执行的异步任务数", func(c *Config) *int { return &c.Jobs.Workers }),
+	intField("jobs.max_attempts", "每个异步任务最多执行的次数", func(c *Config) *int { return &c.Jobs.MaxAttempts }),
+	durationField("jobs.retry_delay", "异步任务第一次重试前等待的时间, 之后每次翻倍", func(c *Config) *Duration { return &c.Jobs.RetryDelay }),
+	durationField("jobs.ttl", "结束的异步任务保留的时间, 0 一直保留", func(c *Config) *Duration { return &c.Jobs.Ttl }),
+	stringField("jobs.download_dir", "下载任务保存视频的目录", func(c *Config) *string { return &c.Jobs.DownloadDir }),
+	intField("jobs.max_pending", "未结束的异步任务数上限, 超过时返回 429", func(c *Config) *int { return &c.Jobs.MaxPending }),
+	intField("jobs.max_file_mb", "下载任务每个视频的大小上限, 单位 MB", func(c *Config) *int { return &c.Jobs.MaxFileMB }),
+	intField("jobs.max_disk_mb", "下载目录的总大小上限, 单位 MB, 0 不限制", func(c *Config) *int { return &c.Jobs.MaxDiskMB }),
+	intField("gallery.max_size_mb", "/video/gallery.zip 每次打包的图片总大小上限, 单位 MB", func(c *Config) *int { return &c.Gallery.MaxSizeMB }),
+}
+
+// fieldValue 命令行中设置的配置项, 在环境变量之后应用
+type fieldValue struct {
+	field field
+	value string
+}
+
+// flagRecorder 记录命令行参数, 实现 flag.Value
+type flagRecorder struct {
+	field  field
+	values *[]fieldValue
+}
+
+func (r *flagRecorder) String() string {
+	return ""
+}
+
+func (r *flagRecorder) Set(value string) error {
+	// 提前校验格式, 错误信息中带上参数名
+	if err := r.field.set(Default(), value); err != nil {
+		return err
+	}
+	*r.values = append(*r.values, fieldValue{field: r.field, value: value})
+	return nil
+}
+
+func (r *flagRecorder) IsBoolFlag() bool {
+	return r.field.bool
+}
+
+// Usage 返回所有配置项的说明, 包括命令行参数和环境变量
+func Usage() string {
+	var b strings.Builder
+	b.WriteString("Usage of parse-video:\n")
+	fmt.Fprintf(&b, "  -config string\n\t配置文件路径, 支持 .yaml/.yml/.toml (env %sCONFIG)\n", EnvPrefix)
+	for _, f := range fields {
+		typ := " string"
+		if f.bool {
+			typ = ""
+		}
+		fmt.Fprintf(&b, "  -%s%s\n\t%s (env %s)\n", f.flagName(), typ, f.usage, f.envName())
+	}
+	return b.String()
+}
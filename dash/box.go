@@ -0,0 +1,170 @@
+package dash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxBoxSize 单个 box 的最大长度, 防止异常数据导致分配过大的内存
+const maxBoxSize = 512 << 20
+
+// box mp4 的基本结构, data 为完整的 box 数据, 包含头部
+type box struct {
+	typ  string
+	data []byte
+	hdr  int // 头部长度, 8 或 16(64位长度)
+}
+
+// payload 返回 box 的内容, 不含头部
+func (b *box) payload() []byte {
+	return b.data[b.hdr:]
+}
+
+// readBox 从 r 中读取一个 box, 没有更多数据时返回 io.EOF
+func readBox(r io.Reader) (*box, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:8]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("read box header: %w", err)
+		}
+		return nil, err
+	}
+	size := uint64(binary.BigEndian.Uint32(hdr[:4]))
+	typ := string(hdr[4:8])
+	hdrLen := 8
+
+	switch size {
+	case 0:
+		// 长度为0表示 box 一直到文件结尾
+		rest, err := io.ReadAll(io.LimitReader(r, maxBoxSize))
+		if err != nil {
+			return nil, fmt.Errorf("read box %s: %w", typ, err)
+		}
+		data := append(hdr[:8:8], rest...)
+		binary.BigEndian.PutUint32(data[:4], uint32(len(data)))
+		return &box{typ: typ, data: data, hdr: hdrLen}, nil
+	case 1:
+		if _, err := io.ReadFull(r, hdr[8:16]); err != nil {
+			return nil, fmt.Errorf("read box %s large size: %w", typ, err)
+		}
+		size = binary.BigEndian.Uint64(hdr[8:16])
+		hdrLen = 16
+	}
+	if size < uint64(hdrLen) || size > maxBoxSize {
+		return nil, fmt.Errorf("invalid box %s size: %d", typ, size)
+	}
+
+	data := make([]byte, size)
+	copy(data, hdr[:hdrLen])
+	if _, err := io.ReadFull(r, data[hdrLen:]); err != nil {
+		return nil, fmt.Errorf("read box %s: %w", typ, err)
+	}
+	return &box{typ: typ, data: data, hdr: hdrLen}, nil
+}
+
+// parseChildren 解析容器 box 的子 box, 子 box 的 data 与 payload 共享内存, 修改会反映到父 box
+func parseChildren(payload []byte) ([]*box, error) {
+	var children []*box
+	for len(payload) > 0 {
+		if len(payload) < 8 {
+			return nil, errors.New("truncated child box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(payload[:4]))
+		typ := string(payload[4:8])
+		hdrLen := 8
+		switch size {
+		case 0:
+			size = uint64(len(payload))
+		case 1:
+			if len(payload) < 16 {
+				return nil, fmt.Errorf("truncated child box %s header", typ)
+			}
+			size = binary.BigEndian.Uint64(payload[8:16])
+			hdrLen = 16
+		}
+		if size < uint64(hdrLen) || size > uint64(len(payload)) {
+			return nil, fmt.Errorf("invalid child box %s size: %d", typ, size)
+		}
+		children = append(children, &box{typ: typ, data: payload[:size:size], hdr: hdrLen})
+		payload = payload[size:]
+	}
+	return children, nil
+}
+
+// findChild 查找第一个指定类型的子 box
+func findChild(children []*box, typ string) *box {
+	for _, child := range children {
+		if child.typ == typ {
+			return child
+		}
+	}
+	return nil
+}
+
+// findPath 按路径查找子 box, 如: mdia/mdhd
+func findPath(b *box, path ...string) (*box, error) {
+	for _, typ := range path {
+		children, err := parseChildren(b.payload())
+		if err != nil {
+			return nil, err
+		}
+		if b = findChild(children, typ); b == nil {
+			return nil, fmt.Errorf("box %s not found", typ)
+		}
+	}
+	return b, nil
+}
+
+// makeBox 生成 box, children 为已编码的子 box 或内容
+func makeBox(typ string, children ...[]byte) []byte {
+	size := 8
+	for _, child := range children {
+		size += len(child)
+	}
+	data := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(data[:4], uint32(size))
+	copy(data[4:8], typ)
+	for _, child := range children {
+		data = append(data, child...)
+	}
+	return data
+}
+
+// fullBoxVersion 获取 full box 的版本号
+func fullBoxVersion(b *box) (byte, error) {
+	payload := b.payload()
+	if len(payload) < 4 {
+		return 0, fmt.Errorf("box %s too short", b.typ)
+	}
+	return payload[0], nil
+}
+
+// putUint32 修改 box 内容中指定偏移的 uint32
+func putUint32(b *box, offset int, v uint32) error {
+	payload := b.payload()
+	if len(payload) < offset+4 {
+		return fmt.Errorf("box %s too short", b.typ)
+	}
+	binary.BigEndian.PutUint32(payload[offset:], v)
+	return nil
+}
+
+// getUint32 读取 box 内容中指定偏移的 uint32
+func getUint32(b *box, offset int) (uint32, error) {
+	payload := b.payload()
+	if len(payload) < offset+4 {
+		return 0, fmt.Errorf("box %s too short", b.typ)
+	}
+	return binary.BigEndian.Uint32(payload[offset:]), nil
+}
+
+// getUint64 读取 box 内容中指定偏移的 uint64
+func getUint64(b *box, offset int) (uint64, error) {
+	payload := b.payload()
+	if len(payload) < offset+8 {
+		return 0, fmt.Errorf("box %s too short", b.typ)
+	}
+	return binary.BigEndian.Uint64(payload[offset:]), nil
+}
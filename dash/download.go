@@ -0,0 +1,97 @@
+package dash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// defaultUserAgent 下载视频流时默认使用的 UserAgent
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36"
+
+type options struct {
+	httpClient *http.Client
+	header     http.Header
+}
+
+// Option MergeUrl 配置项
+type Option func(o *options)
+
+// WithHttpClient 使用自定义的 http.Client 下载视频流
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		if httpClient != nil {
+			o.httpClient = httpClient
+		}
+	}
+}
+
+// WithHeader 设置下载视频流的请求头, 如B站需要设置 Referer
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		o.header.Set(key, value)
+	}
+}
+
+// MergeUrl 下载视频流和音频流, 边下载边合并为一个 mp4 写入 w
+// ctx 取消时中断下载
+func MergeUrl(ctx context.Context, w io.Writer, videoUrl, audioUrl string, opts ...Option) error {
+	o := &options{
+		httpClient: http.DefaultClient,
+		header:     http.Header{"User-Agent": {defaultUserAgent}},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 同时发起两个请求, 合并时交替读取
+	type result struct {
+		body io.ReadCloser
+		err  error
+	}
+	videoCh, audioCh := make(chan result, 1), make(chan result, 1)
+	for _, item := range []struct {
+		url string
+		ch  chan result
+	}{{videoUrl, videoCh}, {audioUrl, audioCh}} {
+		go func(reqUrl string, ch chan result) {
+			body, err := o.open(ctx, reqUrl)
+			ch <- result{body: body, err: err}
+		}(item.url, item.ch)
+	}
+	video, audio := <-videoCh, <-audioCh
+	for _, res := range []result{video, audio} {
+		if res.body != nil {
+			defer res.body.Close()
+		}
+	}
+	if err := errors.Join(video.err, audio.err); err != nil {
+		return err
+	}
+
+	return Mux(w, video.body, audio.body)
+}
+
+// open 请求视频流, 返回响应内容
+func (o *options) open(ctx context.Context, reqUrl string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = o.header.Clone()
+
+	res, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("request %s fail, status: %s", reqUrl, res.Status)
+	}
+	return res.Body, nil
+}
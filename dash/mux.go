@@ -0,0 +1,326 @@
+// Package dash 将 dash 格式分离的视频流和音频流(fragmented mp4, 如B站的 m4s)合并为一个 mp4 文件
+// 只重新封装, 不转码, 不依赖 ffmpeg
+package dash
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnsupported 输入不是支持的 fragmented mp4 格式
+var ErrUnsupported = errors.New("unsupported dash stream")
+
+// tfhd 的 base-data-offset-present 标志, 数据偏移为文件的绝对位置, 合并后会失效
+const tfhdBaseDataOffsetPresent = 0x000001
+
+// input 单个输入流, 只包含一条轨道
+type input struct {
+	r         io.Reader
+	name      string
+	trackId   uint32 // 合并后的轨道id
+	ftyp      []byte
+	mvhd      *box
+	mehd      *box
+	trak      *box
+	trex      *box
+	others    []*box // moov 中的其他 box, 如: udta
+	timescale uint32
+
+	next *fragment // 下一个待写入的分片
+}
+
+// fragment 一个分片, moof 和紧随其后的 mdat
+type fragment struct {
+	moof *box
+	mfhd *box
+	mdat *box
+	time float64 // 分片开始时间, 秒
+}
+
+// Mux 将视频流和音频流合并为一个 fragmented mp4, 写入 w
+// 输入需为只包含一条轨道的 fragmented mp4, 按顺序读取, 内存中只保留当前分片
+func Mux(w io.Writer, video, audio io.Reader) error {
+	inputs := []*input{
+		{r: video, name: "video", trackId: 1},
+		{r: audio, name: "audio", trackId: 2},
+	}
+	for _, in := range inputs {
+		if err := in.readHeader(); err != nil {
+			return fmt.Errorf("%s: %w", in.name, err)
+		}
+	}
+
+	if err := writeHeader(w, inputs[0], inputs[1]); err != nil {
+		return err
+	}
+
+	for _, in := range inputs {
+		if err := in.readFragment(); err != nil {
+			return fmt.Errorf("%s: %w", in.name, err)
+		}
+	}
+
+	// 按分片开始时间交错写入, 时间相同时视频在前
+	var seq uint32
+	for {
+		var in *input
+		for _, item := range inputs {
+			if item.next != nil && (in == nil || item.next.time < in.next.time) {
+				in = item
+			}
+		}
+		if in == nil {
+			return nil
+		}
+
+		seq++
+		if err := putUint32(in.next.mfhd, 4, seq); err != nil {
+			return err
+		}
+		if _, err := w.Write(in.next.moof.data); err != nil {
+			return err
+		}
+		if _, err := w.Write(in.next.mdat.data); err != nil {
+			return err
+		}
+		if err := in.readFragment(); err != nil {
+			return fmt.Errorf("%s: %w", in.name, err)
+		}
+	}
+}
+
+// readHeader 读取 ftyp 和 moov, 并修改轨道id
+func (in *input) readHeader() error {
+	for {
+		b, err := readBox(in.r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%w: moov not found", ErrUnsupported)
+			}
+			return err
+		}
+		switch b.typ {
+		case "ftyp":
+			in.ftyp = b.data
+		case "moov":
+			return in.parseMoov(b)
+		}
+	}
+}
+
+// parseMoov 解析 moov, 修改 tkhd 和 trex 中的轨道id
+func (in *input) parseMoov(moov *box) error {
+	children, err := parseChildren(moov.payload())
+	if err != nil {
+		return err
+	}
+
+	var traks []*box
+	for _, child := range children {
+		switch child.typ {
+		case "mvhd":
+			in.mvhd = child
+		case "trak":
+			traks = append(traks, child)
+		case "mvex":
+			mvexChildren, err := parseChildren(child.payload())
+			if err != nil {
+				return err
+			}
+			in.mehd = findChild(mvexChildren, "mehd")
+			in.trex = findChild(mvexChildren, "trex")
+		default:
+			in.others = append(in.others, child)
+		}
+	}
+	if in.mvhd == nil {
+		return fmt.Errorf("%w: mvhd not found", ErrUnsupported)
+	}
+	if len(traks) != 1 {
+		return fmt.Errorf("%w: expect 1 track, got %d", ErrUnsupported, len(traks))
+	}
+	if in.trex == nil {
+		return fmt.Errorf("%w: not a fragmented mp4, trex not found", ErrUnsupported)
+	}
+	in.trak = traks[0]
+
+	// tkhd: version(1) + flags(3) + creation_time + modification_time + track_ID
+	tkhd, err := findPath(in.trak, "tkhd")
+	if err != nil {
+		return err
+	}
+	version, err := fullBoxVersion(tkhd)
+	if err != nil {
+		return err
+	}
+	offset := 12
+	if version == 1 {
+		offset = 20
+	}
+	if err = putUint32(tkhd, offset, in.trackId); err != nil {
+		return err
+	}
+
+	// trex: version(1) + flags(3) + track_ID
+	if err = putUint32(in.trex, 4, in.trackId); err != nil {
+		return err
+	}
+
+	// mdhd: version(1) + flags(3) + creation_time + modification_time + timescale
+	mdhd, err := findPath(in.trak, "mdia", "mdhd")
+	if err != nil {
+		return err
+	}
+	if version, err = fullBoxVersion(mdhd); err != nil {
+		return err
+	}
+	offset = 12
+	if version == 1 {
+		offset = 20
+	}
+	if in.timescale, err = getUint32(mdhd, offset); err != nil {
+		return err
+	}
+	if in.timescale == 0 {
+		return fmt.Errorf("%w: mdhd timescale is 0", ErrUnsupported)
+	}
+
+	return nil
+}
+
+// readFragment 读取下一个分片, 没有更多分片时 next 为 nil
+func (in *input) readFragment() error {
+	in.next = nil
+	for {
+		b, err := readBox(in.r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if b.typ != "moof" {
+			// 跳过 sidx, styp, free, mfra 等
+			continue
+		}
+
+		frag := &fragment{moof: b}
+		if err = in.parseMoof(frag); err != nil {
+			return err
+		}
+		// trun 中的数据偏移相对于 moof, mdat 需紧随 moof
+		if frag.mdat, err = readBox(in.r); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%w: mdat not found after moof", ErrUnsupported)
+			}
+			return err
+		}
+		if frag.mdat.typ != "mdat" {
+			return fmt.Errorf("%w: expect mdat after moof, got %s", ErrUnsupported, frag.mdat.typ)
+		}
+		in.next = frag
+		return nil
+	}
+}
+
+// parseMoof 解析 moof, 修改 tfhd 中的轨道id, 并获取分片开始时间
+func (in *input) parseMoof(frag *fragment) error {
+	children, err := parseChildren(frag.moof.payload())
+	if err != nil {
+		return err
+	}
+	if frag.mfhd = findChild(children, "mfhd"); frag.mfhd == nil {
+		return fmt.Errorf("%w: mfhd not found", ErrUnsupported)
+	}
+
+	trafCount := 0
+	for _, traf := range children {
+		if traf.typ != "traf" {
+			continue
+		}
+		trafCount++
+		trafChildren, err := parseChildren(traf.payload())
+		if err != nil {
+			return err
+		}
+
+		// tfhd: version(1) + flags(3) + track_ID
+		tfhd := findChild(trafChildren, "tfhd")
+		if tfhd == nil {
+			return fmt.Errorf("%w: tfhd not found", ErrUnsupported)
+		}
+		flags, err := getUint32(tfhd, 0)
+		if err != nil {
+			return err
+		}
+		if flags&tfhdBaseDataOffsetPresent != 0 {
+			return fmt.Errorf("%w: tfhd with base data offset", ErrUnsupported)
+		}
+		if err = putUint32(tfhd, 4, in.trackId); err != nil {
+			return err
+		}
+
+		// tfdt: version(1) + flags(3) + baseMediaDecodeTime(32位或64位)
+		tfdt := findChild(trafChildren, "tfdt")
+		if tfdt == nil {
+			return fmt.Errorf("%w: tfdt not found", ErrUnsupported)
+		}
+		version, err := fullBoxVersion(tfdt)
+		if err != nil {
+			return err
+		}
+		var decodeTime uint64
+		if version == 1 {
+			decodeTime, err = getUint64(tfdt, 4)
+		} else {
+			var t uint32
+			t, err = getUint32(tfdt, 4)
+			decodeTime = uint64(t)
+		}
+		if err != nil {
+			return err
+		}
+		frag.time = float64(decodeTime) / float64(in.timescale)
+	}
+	if trafCount != 1 {
+		return fmt.Errorf("%w: expect 1 traf, got %d", ErrUnsupported, trafCount)
+	}
+
+	return nil
+}
+
+// writeHeader 写入 ftyp 和合并后的 moov
+func writeHeader(w io.Writer, video, audio *input) error {
+	ftyp := video.ftyp
+	if len(ftyp) <= 0 {
+		ftyp = makeBox("ftyp", []byte("iso5"), []byte{0, 0, 0, 1}, []byte("iso5iso6mp41"))
+	}
+
+	// mvhd 使用视频流的, next_track_ID 位于内容末尾
+	mvhd := append([]byte(nil), video.mvhd.data...)
+	if len(mvhd) < video.mvhd.hdr+4 {
+		return fmt.Errorf("%w: mvhd too short", ErrUnsupported)
+	}
+	nextTrack := &box{typ: "mvhd", data: mvhd, hdr: video.mvhd.hdr}
+	if err := putUint32(nextTrack, len(nextTrack.payload())-4, 3); err != nil {
+		return err
+	}
+
+	mvexChildren := make([][]byte, 0, 3)
+	if video.mehd != nil {
+		mvexChildren = append(mvexChildren, video.mehd.data)
+	}
+	mvexChildren = append(mvexChildren, video.trex.data, audio.trex.data)
+
+	moovChildren := [][]byte{mvhd, video.trak.data, audio.trak.data, makeBox("mvex", mvexChildren...)}
+	for _, other := range video.others {
+		moovChildren = append(moovChildren, other.data)
+	}
+
+	if _, err := w.Write(ftyp); err != nil {
+		return err
+	}
+	_, err := w.Write(makeBox("moov", moovChildren...))
+	return err
+}
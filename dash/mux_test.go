@@ -0,0 +1,204 @@
+package dash
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fullBox 生成 full box 的内容: version + flags + fields
+func fullBox(version byte, flags uint32, fields ...uint32) []byte {
+	data := make([]byte, 4, 4+len(fields)*4)
+	binary.BigEndian.PutUint32(data, flags)
+	data[0] = version
+	for _, field := range fields {
+		data = binary.BigEndian.AppendUint32(data, field)
+	}
+	return data
+}
+
+// testStream 生成只有一条轨道的 fragmented mp4, 每个分片时长 fragDuration
+func testStream(handler string, timescale uint32, fragDuration uint32, fragCount int, tfhdFlags uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[96:], 2) // next_track_ID
+
+	tkhd := fullBox(0, 3, 0, 0, 1, 0, 0)
+	mdhd := fullBox(0, 0, 0, 0, timescale, 0, 0)
+	hdlr := append(fullBox(0, 0, 0), []byte(handler+"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")...)
+	trak := makeBox("trak", makeBox("tkhd", tkhd), makeBox("mdia", makeBox("mdhd", mdhd), makeBox("hdlr", hdlr)))
+	mvex := makeBox("mvex", makeBox("trex", fullBox(0, 0, 1, 1, 0, 0, 0)))
+
+	var buf bytes.Buffer
+	buf.Write(makeBox("ftyp", []byte("iso5"), []byte{0, 0, 0, 1}, []byte("iso6mp41")))
+	buf.Write(makeBox("moov", makeBox("mvhd", mvhd), trak, mvex, makeBox("udta", []byte(handler))))
+	buf.Write(makeBox("sidx", fullBox(0, 0, 1, timescale)))
+	for i := 0; i < fragCount; i++ {
+		mdat := makeBox("mdat", []byte(handler), []byte{byte(i)})
+		traf := makeBox("traf",
+			makeBox("tfhd", fullBox(0, tfhdFlags|0x020000, 1)),
+			makeBox("tfdt", fullBox(1, 0, 0, uint32(i)*fragDuration)),
+			makeBox("trun", fullBox(0, 0x000001, 1, 0)),
+		)
+		buf.Write(makeBox("moof", makeBox("mfhd", fullBox(0, 0, uint32(i+1))), traf))
+		buf.Write(mdat)
+	}
+	return buf.Bytes()
+}
+
+// readAll 读取所有顶层 box
+func readAll(t *testing.T, data []byte) []*box {
+	t.Helper()
+	var boxes []*box
+	r := bytes.NewReader(data)
+	for {
+		b, err := readBox(r)
+		if errors.Is(err, io.EOF) {
+			return boxes
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		boxes = append(boxes, b)
+	}
+}
+
+func TestMux(t *testing.T) {
+	// 视频: 每个分片2秒, 音频: 每个分片1秒
+	video := testStream("vide", 90000, 180000, 3, 0)
+	audio := testStream("soun", 48000, 48000, 6, 0)
+
+	var out bytes.Buffer
+	if err := Mux(&out, bytes.NewReader(video), bytes.NewReader(audio)); err != nil {
+		t.Fatal(err)
+	}
+
+	boxes := readAll(t, out.Bytes())
+	if boxes[0].typ != "ftyp" || boxes[1].typ != "moov" {
+		t.Fatalf("first boxes = %s, %s, want ftyp, moov", boxes[0].typ, boxes[1].typ)
+	}
+
+	moovChildren, err := parseChildren(boxes[1].payload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trackIds, trexIds []uint32
+	for _, child := range moovChildren {
+		switch child.typ {
+		case "trak":
+			tkhd, _ := findPath(child, "tkhd")
+			id, _ := getUint32(tkhd, 12)
+			trackIds = append(trackIds, id)
+		case "mvex":
+			mvexChildren, _ := parseChildren(child.payload())
+			for _, trex := range mvexChildren {
+				id, _ := getUint32(trex, 4)
+				trexIds = append(trexIds, id)
+			}
+		case "mvhd":
+			if next, _ := getUint32(child, len(child.payload())-4); next != 3 {
+				t.Errorf("mvhd next_track_ID = %d, want 3", next)
+			}
+		}
+	}
+	if len(trackIds) != 2 || trackIds[0] != 1 || trackIds[1] != 2 {
+		t.Errorf("tkhd track ids = %v, want [1 2]", trackIds)
+	}
+	if len(trexIds) != 2 || trexIds[0] != 1 || trexIds[1] != 2 {
+		t.Errorf("trex track ids = %v, want [1 2]", trexIds)
+	}
+
+	// 分片按时间交错: v0(0s) a0(0s) a1(1s) v1(2s) a2(2s) a3(3s) v2(4s) a4(4s) a5(5s)
+	var got []string
+	var seq uint32
+	for i := 2; i < len(boxes); i++ {
+		b := boxes[i]
+		switch b.typ {
+		case "sidx":
+			t.Errorf("sidx should be dropped")
+		case "moof":
+			mfhd, _ := findPath(b, "mfhd")
+			s, _ := getUint32(mfhd, 4)
+			if s != seq+1 {
+				t.Errorf("mfhd sequence = %d, want %d", s, seq+1)
+			}
+			seq = s
+			tfhd, _ := findPath(b, "traf", "tfhd")
+			id, _ := getUint32(tfhd, 4)
+			mdat := boxes[i+1]
+			if mdat.typ != "mdat" {
+				t.Fatalf("box after moof = %s, want mdat", mdat.typ)
+			}
+			name := map[string]string{"vide": "v", "soun": "a"}[string(mdat.payload()[:4])]
+			if (name == "v" && id != 1) || (name == "a" && id != 2) {
+				t.Errorf("fragment %s%d track id = %d", name, mdat.payload()[4], id)
+			}
+			got = append(got, name+string('0'+mdat.payload()[4]))
+		}
+	}
+	want := []string{"v0", "a0", "a1", "v1", "a2", "a3", "v2", "a4", "a5"}
+	if len(got) != len(want) {
+		t.Fatalf("fragments = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("fragments = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMux_unsupported(t *testing.T) {
+	tests := []struct {
+		name  string
+		video []byte
+	}{
+		{"base data offset", testStream("vide", 90000, 180000, 1, tfhdBaseDataOffsetPresent)},
+		{"no moov", makeBox("ftyp", []byte("iso5"))},
+	}
+	audio := testStream("soun", 48000, 48000, 1, 0)
+	for _, tt := range tests {
+		err := Mux(io.Discard, bytes.NewReader(tt.video), bytes.NewReader(audio))
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: Mux error = %v, want %v", tt.name, err, ErrUnsupported)
+		}
+	}
+}
+
+func TestMergeUrl(t *testing.T) {
+	streams := map[string][]byte{
+		"/video.m4s": testStream("vide", 90000, 180000, 2, 0),
+		"/audio.m4s": testStream("soun", 48000, 48000, 2, 0),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://www.bilibili.com/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		data, ok := streams[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := MergeUrl(context.Background(), &out, server.URL+"/video.m4s", server.URL+"/audio.m4s", WithHeader("Referer", "https://www.bilibili.com/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if boxes := readAll(t, out.Bytes()); len(boxes) != 2+4*2 {
+		t.Errorf("merged box count = %d, want %d", len(boxes), 2+4*2)
+	}
+
+	err = MergeUrl(context.Background(), io.Discard, server.URL+"/video.m4s", server.URL+"/missing.m4s", WithHeader("Referer", "https://www.bilibili.com/"))
+	if err == nil {
+		t.Errorf("MergeUrl with missing audio should fail")
+	}
+}
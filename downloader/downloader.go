@@ -0,0 +1,426 @@
+// Package downloader 下载解析结果中的视频、音频、封面和图集到目录
+// 文件名由模板生成, 支持断点续传、大文件分块并发下载、渠道需要的防盗链请求头、校验和以及进度回调
+package downloader
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/wujunwei928/parse-video/dash"
+	"github.com/wujunwei928/parse-video/hls"
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// 文件类型
+const (
+	KindVideo = "video" // 视频
+	KindAudio = "audio" // 音频, 如抖音的背景音乐, B站的音频流
+	KindCover = "cover" // 封面
+	KindImage = "image" // 图集图片
+)
+
+// Progress 下载进度
+type Progress struct {
+	Kind       string
+	Url        string
+	Path       string
+	Downloaded int64 // 已下载的字节数, 续传时包括之前下载的部分
+	Total      int64 // 文件大小, 未知时为 -1
+}
+
+// Option Downloader 配置项
+type Option func(d *Downloader)
+
+// WithHttpClient 使用自定义的 http.Client 下载, 如服务端使用只能访问渠道资源域名的客户端
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(d *Downloader) {
+		d.client = httpClient
+	}
+}
+
+// WithHeader 设置所有请求的请求头, 覆盖渠道需要的请求头
+func WithHeader(key, value string) Option {
+	return func(d *Downloader) {
+		d.header.Set(key, value)
+	}
+}
+
+// WithTemplate 文件名模板, 默认 DefaultTemplate
+func WithTemplate(template *Template) Option {
+	return func(d *Downloader) {
+		d.template = template
+	}
+}
+
+// WithKinds 下载的文件类型, 默认下载全部类型
+func WithKinds(kinds ...string) Option {
+	return func(d *Downloader) {
+		d.kinds = kinds
+	}
+}
+
+// WithConcurrency 同时下载的文件数, 默认4
+func WithConcurrency(concurrency int) Option {
+	return func(d *Downloader) {
+		d.concurrency = concurrency
+	}
+}
+
+// WithChunks 服务器支持 Range 且文件不小于 minSize 时, 分为 chunks 块并发下载, 默认大于 16MB 的文件分4块
+func WithChunks(chunks int, minSize int64) Option {
+	return func(d *Downloader) {
+		d.chunks, d.chunkMinSize = chunks, minSize
+	}
+}
+
+// WithMaxSize 每个文件最多下载 maxSize 字节, 超过时返回 ErrTooLarge, 默认不限制
+// m3u8 和 dash 合并后的文件同样限制
+func WithMaxSize(maxSize int64) Option {
+	return func(d *Downloader) {
+		d.maxSize = maxSize
+	}
+}
+
+// WithProgress 下载进度回调, 每写入一次数据调用一次, 同一个文件不会并发调用, 需要尽快返回
+func WithProgress(onProgress func(p Progress)) Option {
+	return func(d *Downloader) {
+		d.onProgress = onProgress
+	}
+}
+
+// Downloader 下载器, 可以并发使用
+type Downloader struct {
+	dir          string
+	client       *http.Client
+	header       http.Header
+	template     *Template
+	kinds        []string
+	concurrency  int
+	chunks       int
+	chunkMinSize int64
+	maxSize      int64
+	onProgress   func(p Progress)
+}
+
+// New 创建下载器, 文件保存在 dir 目录下
+func New(dir string, opts ...Option) *Downloader {
+	d := &Downloader{
+		dir:          dir,
+		client:       http.DefaultClient,
+		header:       make(http.Header),
+		template:     MustParseTemplate(DefaultTemplate),
+		kinds:        []string{KindVideo, KindAudio, KindCover, KindImage},
+		concurrency:  4,
+		chunks:       4,
+		chunkMinSize: 16 << 20,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.concurrency = max(d.concurrency, 1)
+	return d
+}
+
+// task Download 中需要下载的一个文件
+type task struct {
+	kind     string
+	url      string
+	audioUrl string // dash 视频流对应的音频流, 下载后合并
+	path     string
+}
+
+// Download 下载视频信息中的视频、音频、封面和图集, 返回下载完成的文件, 已存在的文件不重复下载
+// vars 为额外的模板变量, 覆盖从 info 中获取的同名变量
+// source 和 id 默认为 info.Source 和 info.VideoId, 为空时分别根据资源域名识别和使用视频地址的摘要
+// m3u8 视频合并分片保存为 ts, B站等 m4s 视频流与音频流合并保存为 mp4
+// 部分文件下载失败时继续下载其他文件, 返回所有失败的错误
+func (d *Downloader) Download(ctx context.Context, info *parser.VideoParseInfo, vars Vars) ([]File, error) {
+	tasks := d.tasks(info, vars)
+	if len(tasks) <= 0 {
+		return nil, errors.New("nothing to download")
+	}
+
+	var (
+		wg    sync.WaitGroup
+		files = make([]*File, len(tasks))
+		errs  = make([]error, len(tasks))
+		sem   = make(chan struct{}, d.concurrency)
+	)
+	for i, t := range tasks {
+		wg.Add(1)
+		go func(i int, t task) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			file, err := d.downloadTask(ctx, t)
+			files[i] = file
+			if err != nil {
+				errs[i] = fmt.Errorf("download %s %s: %w", t.kind, t.url, err)
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	var result []File
+	for _, file := range files {
+		if file != nil {
+			result = append(result, *file)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// tasks 根据视频信息和模板生成需要下载的文件
+func (d *Downloader) tasks(info *parser.VideoParseInfo, extra Vars) []task {
+	source, id := info.Source, info.VideoId
+	if len(source) <= 0 {
+		source = mediaSource(info)
+	}
+	if len(id) <= 0 {
+		id = urlDigest(info)
+	}
+	vars := Vars{
+		"source":      source,
+		"id":          id,
+		"title":       info.Title,
+		"author.name": info.Author.Name,
+		"author.uid":  info.Author.Uid,
+	}
+	for key, value := range extra {
+		vars[key] = value
+	}
+
+	var tasks []task
+	add := func(kind, rawUrl, index, ext string) {
+		vars["kind"], vars["index"], vars["ext"] = kind, index, ext
+		tasks = append(tasks, task{kind: kind, url: rawUrl, path: filepath.Join(d.dir, filepath.FromSlash(d.template.Execute(vars)))})
+	}
+
+	dashVideo := strings.EqualFold(urlExt(info.VideoUrl), ".m4s") && len(info.MusicUrl) > 0
+	if d.wants(KindVideo) && len(info.VideoUrl) > 0 {
+		switch {
+		case strings.EqualFold(urlExt(info.VideoUrl), ".m3u8"):
+			add(KindVideo, info.VideoUrl, "", "ts")
+		case dashVideo:
+			add(KindVideo, info.VideoUrl, "", "mp4")
+			tasks[len(tasks)-1].audioUrl = info.MusicUrl
+		default:
+			add(KindVideo, info.VideoUrl, "", fileExt(info.VideoUrl, "mp4"))
+		}
+	}
+	if d.wants(KindAudio) && len(info.MusicUrl) > 0 {
+		ext := fileExt(info.MusicUrl, "mp3")
+		if dashVideo {
+			ext = "m4a"
+		}
+		add(KindAudio, info.MusicUrl, "", ext)
+	}
+	if d.wants(KindCover) && len(info.CoverUrl) > 0 {
+		add(KindCover, info.CoverUrl, "", fileExt(info.CoverUrl, "jpg"))
+	}
+	if d.wants(KindImage) {
+		for i, image := range info.Images {
+			add(KindImage, image, fmt.Sprintf("%02d", i+1), fileExt(image, "jpg"))
+		}
+	}
+	return tasks
+}
+
+// wants 是否下载该类型的文件
+func (d *Downloader) wants(kind string) bool {
+	for _, item := range d.kinds {
+		if item == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadTask 下载一个文件, m3u8 和 dash 视频先下载到 .part 文件, 完成后重命名
+func (d *Downloader) downloadTask(ctx context.Context, t task) (*File, error) {
+	switch {
+	case t.kind == KindVideo && len(t.audioUrl) > 0:
+		return d.merge(ctx, t)
+	case t.kind == KindVideo && strings.EqualFold(urlExt(t.url), ".m3u8"):
+		return d.writeFile(t, func(w io.Writer) error {
+			header := d.requestHeader(t.url, nil)
+			opts := []hls.Option{hls.WithHttpClient(d.client)}
+			for name := range header {
+				opts = append(opts, hls.WithHeader(name, header.Get(name)))
+			}
+			return hls.Download(ctx, w, t.url, opts...)
+		})
+	default:
+		return d.Fetch(ctx, Request{Url: t.url, Path: t.path, Kind: t.kind})
+	}
+}
+
+// merge 分别下载视频流和音频流(都支持续传), 再合并为 mp4
+func (d *Downloader) merge(ctx context.Context, t task) (*File, error) {
+	if stat, err := os.Stat(t.path); err == nil {
+		return &File{Kind: t.kind, Url: t.url, Path: t.path, Size: stat.Size(), Skipped: true}, nil
+	}
+	video, err := d.Fetch(ctx, Request{Url: t.url, Path: t.path + ".video.m4s", Kind: KindVideo})
+	if err != nil {
+		return nil, err
+	}
+	audio, err := d.Fetch(ctx, Request{Url: t.audioUrl, Path: t.path + ".audio.m4s", Kind: KindAudio})
+	if err != nil {
+		return nil, err
+	}
+	file, err := d.writeFile(t, func(w io.Writer) error {
+		videoFile, err := os.Open(video.Path)
+		if err != nil {
+			return err
+		}
+		defer videoFile.Close()
+		audioFile, err := os.Open(audio.Path)
+		if err != nil {
+			return err
+		}
+		defer audioFile.Close()
+		return dash.Mux(w, videoFile, audioFile)
+	})
+	if err == nil {
+		_ = os.Remove(video.Path)
+		_ = os.Remove(audio.Path)
+	}
+	return file, err
+}
+
+// writeFile 通过 write 写入 .part 文件, 完成后重命名, 文件已存在时跳过
+func (d *Downloader) writeFile(t task, write func(w io.Writer) error) (*File, error) {
+	file := &File{Kind: t.kind, Url: t.url, Path: t.path}
+	if stat, err := os.Stat(t.path); err == nil {
+		file.Size, file.Skipped = stat.Size(), true
+		return file, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return nil, err
+	}
+	part := t.path + partSuffix
+	f, err := os.Create(part)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(part)
+	defer f.Close()
+	var w io.Writer = f
+	if d.maxSize > 0 {
+		w = &limitWriter{w: f, n: d.maxSize}
+	}
+	if err = write(w); err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(part)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Rename(part, t.path); err != nil {
+		return nil, err
+	}
+	file.Size = stat.Size()
+	return file, nil
+}
+
+// progress 单个文件的下载进度, 多个分块并发写入时加锁后回调
+type progress struct {
+	mu         sync.Mutex
+	p          Progress
+	onProgress func(p Progress)
+}
+
+func (d *Downloader) newProgress(req Request, total int64) *progress {
+	return &progress{
+		p:          Progress{Kind: req.Kind, Url: req.Url, Path: req.Path, Total: total},
+		onProgress: d.onProgress,
+	}
+}
+
+// add 增加已下载的字节数并回调
+func (p *progress) add(n int64) {
+	if p.onProgress == nil || n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.p.Downloaded += n
+	p.onProgress(p.p)
+}
+
+// Write 实现 io.Writer, 用于 io.TeeReader
+func (p *progress) Write(data []byte) (int, error) {
+	p.add(int64(len(data)))
+	return len(data), nil
+}
+
+// mediaSource 根据视频、封面或图片的域名识别渠道
+func mediaSource(info *parser.VideoParseInfo) string {
+	for _, rawUrl := range append([]string{info.VideoUrl, info.CoverUrl}, info.Images...) {
+		if u, err := url.Parse(rawUrl); err == nil {
+			if source, ok := parser.MatchMediaHost(u.Hostname()); ok {
+				return source
+			}
+		}
+	}
+	return ""
+}
+
+// urlDigest 视频地址(没有视频时为第一张图片)去掉查询参数后的摘要, 同一视频多次下载时文件名相同, 可以续传
+func urlDigest(info *parser.VideoParseInfo) string {
+	rawUrl := info.VideoUrl
+	if len(rawUrl) <= 0 && len(info.Images) > 0 {
+		rawUrl = info.Images[0]
+	}
+	if len(rawUrl) <= 0 {
+		rawUrl = info.CoverUrl
+	}
+	if u, err := url.Parse(rawUrl); err == nil {
+		rawUrl = u.Host + u.Path
+	}
+	sum := sha1.Sum([]byte(rawUrl))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// urlExt 地址路径的扩展名
+func urlExt(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return path.Ext(u.Path)
+}
+
+// fileExts 可以直接使用的地址扩展名
+var fileExts = map[string]bool{
+	"mp4": true, "mov": true, "flv": true, "mp3": true, "m4a": true, "aac": true,
+	"jpg": true, "jpeg": true, "png": true, "webp": true, "gif": true, "heic": true,
+}
+
+// fileExt 地址扩展名可以直接使用时返回该扩展名, 否则返回 defaultExt
+func fileExt(rawUrl, defaultExt string) string {
+	ext := strings.ToLower(strings.TrimPrefix(urlExt(rawUrl), "."))
+	if fileExts[ext] {
+		return ext
+	}
+	return defaultExt
+}
@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+func TestDownloader_Download(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://downloader.test/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/missing.jpg" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer s.Close()
+
+	const source = "downloader_test"
+	if err := parser.Register(source, parser.SourceInfo{
+		VideoIdParser: struct{ parser.VideoIdParser }{},
+		MediaDomains:  []string{"127.0.0.1"},
+		MediaHeaders:  map[string]string{"Referer": "https://downloader.test/"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer parser.Unregister(source)
+
+	info := &parser.VideoParseInfo{
+		Title:    "标题: 测试",
+		VideoUrl: s.URL + "/play?id=1",
+		MusicUrl: s.URL + "/music.mp3",
+		CoverUrl: s.URL + "/cover.webp",
+		Images:   []string{s.URL + "/1.png", s.URL + "/missing.jpg"},
+	}
+	info.Author.Name = "作者"
+	dir := t.TempDir()
+	d := New(dir, WithTemplate(MustParseTemplate("{source}/{author.name}/{title}-{id}.{ext}")))
+	files, err := d.Download(context.Background(), info, Vars{"id": "42"})
+	if err == nil {
+		t.Errorf("Download should return the missing image error")
+	}
+
+	want := map[string]string{
+		"downloader_test/作者/标题_ 测试-42.mp4":        "/play",
+		"downloader_test/作者/标题_ 测试-42_audio.mp3":  "/music.mp3",
+		"downloader_test/作者/标题_ 测试-42_cover.webp": "/cover.webp",
+		"downloader_test/作者/标题_ 测试-42_01.png":     "/1.png",
+	}
+	if len(files) != len(want) {
+		t.Errorf("files = %+v, want %d files", files, len(want))
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Errorf("file %s = %q, %v, want %q", name, data, err, content)
+		}
+	}
+
+	// 只下载封面, 已存在时跳过
+	d = New(dir, WithTemplate(MustParseTemplate("{source}/{author.name}/{title}-{id}.{ext}")), WithKinds(KindCover))
+	files, err = d.Download(context.Background(), info, Vars{"id": "42"})
+	if err != nil || len(files) != 1 || files[0].Kind != KindCover || !files[0].Skipped {
+		t.Errorf("cover only = %+v, %v", files, err)
+	}
+
+	// 未提供变量时使用解析结果中的渠道和视频id
+	info.Source, info.VideoId = "douyin", "7380308612853402939"
+	files, err = d.Download(context.Background(), info, nil)
+	if err != nil || len(files) != 1 || files[0].Path != filepath.Join(dir, "douyin", "作者", "标题_ 测试-7380308612853402939_cover.webp") {
+		t.Errorf("info vars = %+v, %v", files, err)
+	}
+}
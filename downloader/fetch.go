@@ -0,0 +1,459 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// 下载错误
+var (
+	ErrChecksum      = errors.New("checksum mismatch")   // 下载完成后校验和不一致
+	ErrRemoteChanged = errors.New("remote file changed") // 续传时服务器上的文件已变化, 下次从头下载
+	ErrTooLarge      = errors.New("file too large")      // 文件超过 WithMaxSize 设置的大小
+)
+
+// 未完成文件的后缀: 数据写入 <文件>.part, 分块进度保存在 <文件>.part.json
+const (
+	partSuffix  = ".part"
+	stateSuffix = ".part.json"
+)
+
+// Request 下载一个地址
+type Request struct {
+	Url      string
+	Path     string      // 保存路径, 已存在时不重复下载
+	Kind     string      // 文件类型, 用于进度回调
+	Header   http.Header // 额外的请求头, 覆盖渠道需要的请求头
+	Checksum string      // 校验和, 格式为 算法:十六进制值, 支持 md5, sha1, sha256, 为空时不校验
+}
+
+// File 下载完成的文件
+type File struct {
+	Kind    string `json:"kind"` // video, audio, cover, image
+	Url     string `json:"url"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Skipped bool   `json:"skipped,omitempty"` // 文件已存在, 未重新下载
+}
+
+// remoteFile 服务器上文件的信息
+type remoteFile struct {
+	size         int64 // 未知时为 -1
+	ranges       bool  // 是否支持 Range 请求
+	etag         string
+	lastModified string
+}
+
+// chunk 分块, 下载 [Start+Done, End) 范围
+type chunk struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"` // 已写入的字节数
+}
+
+// partState 未完成文件的分块进度, 服务器上的文件未变化时从已写入的位置继续下载
+type partState struct {
+	Size         int64    `json:"size"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Chunks       []*chunk `json:"chunks"`
+}
+
+// Fetch 下载一个地址到 req.Path, 支持断点续传:
+// 服务器支持 Range 时, 大于 WithChunks 设置大小的文件分块并发下载, 中断后从各分块已写入的位置继续;
+// 不支持时从头下载. 完成后校验 req.Checksum, 再重命名为 req.Path
+func (d *Downloader) Fetch(ctx context.Context, req Request) (*File, error) {
+	file := &File{Kind: req.Kind, Url: req.Url, Path: req.Path}
+	if stat, err := os.Stat(req.Path); err == nil {
+		file.Size, file.Skipped = stat.Size(), true
+		return file, verifyChecksum(req.Path, req.Checksum)
+	}
+	if err := os.MkdirAll(filepath.Dir(req.Path), 0755); err != nil {
+		return nil, err
+	}
+	if _, _, err := parseChecksum(req.Checksum); err != nil {
+		return nil, err
+	}
+
+	header := d.requestHeader(req.Url, req.Header)
+	remote, res, err := d.probe(ctx, req.Url, header)
+	if err != nil {
+		return nil, err
+	}
+	if d.maxSize > 0 && remote.size > d.maxSize {
+		if res != nil {
+			_ = res.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, remote.size)
+	}
+	part, statePath := req.Path+partSuffix, req.Path+stateSuffix
+	progress := d.newProgress(req, remote.size)
+	if res != nil {
+		// 不支持 Range, 直接使用探测请求的响应从头下载
+		err = writeBody(part, res.Body, d.maxSize, progress)
+		_ = res.Body.Close()
+	} else {
+		err = d.fetchChunks(ctx, req.Url, header, part, statePath, remote, progress)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifyChecksum(part, req.Checksum); err != nil {
+		_ = os.Remove(part)
+		_ = os.Remove(statePath)
+		return nil, err
+	}
+	if err = os.Rename(part, req.Path); err != nil {
+		return nil, err
+	}
+	_ = os.Remove(statePath)
+	stat, err := os.Stat(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	file.Size = stat.Size()
+	return file, nil
+}
+
+// requestHeader 请求头: 渠道需要的请求头, WithHeader 设置的请求头, 最后是单次请求的请求头
+func (d *Downloader) requestHeader(rawUrl string, extra http.Header) http.Header {
+	header := http.Header{"User-Agent": {parser.DefaultUserAgent}}
+	if u, err := url.Parse(rawUrl); err == nil {
+		if source, ok := parser.MatchMediaHost(u.Hostname()); ok {
+			for name, values := range parser.MediaHeaders(source) {
+				header[name] = values
+			}
+		}
+	}
+	for _, h := range []http.Header{d.header, extra} {
+		for name, values := range h {
+			header[name] = values
+		}
+	}
+	return header
+}
+
+// probe 请求第一个字节, 判断是否支持 Range 并获取文件大小
+// 不支持 Range 时返回完整内容的响应, 调用方需要关闭
+func (d *Downloader) probe(ctx context.Context, rawUrl string, header http.Header) (remoteFile, *http.Response, error) {
+	res, err := d.get(ctx, rawUrl, header, "bytes=0-0", "")
+	if err != nil {
+		return remoteFile{}, nil, err
+	}
+	remote := remoteFile{
+		size:         res.ContentLength,
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+	}
+	if res.StatusCode == http.StatusOK {
+		return remote, res, nil
+	}
+
+	_ = res.Body.Close()
+	// Content-Range: bytes 0-0/12345
+	contentRange := res.Header.Get("Content-Range")
+	size, err := strconv.ParseInt(contentRange[strings.LastIndex(contentRange, "/")+1:], 10, 64)
+	if err != nil || size <= 0 {
+		// 大小未知时无法分块, 重新请求完整内容
+		res, err = d.get(ctx, rawUrl, header, "", "")
+		if err != nil {
+			return remoteFile{}, nil, err
+		}
+		remote.size = res.ContentLength
+		return remote, res, nil
+	}
+	remote.size, remote.ranges = size, true
+	return remote, nil, nil
+}
+
+// get 发送 GET 请求, rangeHeader 不为空时请求部分内容, 只返回 200 或 206 的响应
+// 429 和 5xx 返回对应分类的 *parser.ParseError, 便于调用方判断是否重试
+func (d *Downloader) get(ctx context.Context, rawUrl string, header http.Header, rangeHeader, ifRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	if len(rangeHeader) > 0 {
+		req.Header.Set("Range", rangeHeader)
+	}
+	if len(ifRange) > 0 {
+		req.Header.Set("If-Range", ifRange)
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &parser.ParseError{Kind: parser.ErrNetwork, Err: err}
+	}
+	if res.StatusCode == http.StatusOK || (res.StatusCode == http.StatusPartialContent && len(rangeHeader) > 0) {
+		return res, nil
+	}
+
+	_ = res.Body.Close()
+	statusErr := fmt.Errorf("download %s response status: %s", rawUrl, res.Status)
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return nil, &parser.ParseError{Kind: parser.ErrRateLimited, Err: statusErr}
+	case res.StatusCode >= http.StatusInternalServerError:
+		return nil, &parser.ParseError{Kind: parser.ErrNetwork, Err: statusErr}
+	default:
+		return nil, statusErr
+	}
+}
+
+// fetchChunks 分块并发下载到 part, 分块进度保存在 statePath, 出错或取消时保存进度后返回
+func (d *Downloader) fetchChunks(ctx context.Context, rawUrl string, header http.Header, part, statePath string, remote remoteFile, progress *progress) error {
+	state := loadState(statePath, part, remote)
+	if state == nil {
+		state = newState(remote, d.chunks, d.chunkMinSize)
+	}
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = f.Truncate(state.Size); err != nil {
+		return err
+	}
+
+	// If-Range: 文件变化时服务器返回完整内容而不是 206, 避免拼接新旧两个文件
+	ifRange := remote.etag
+	if len(ifRange) <= 0 {
+		ifRange = remote.lastModified
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, c := range state.Chunks {
+		progress.add(c.Done)
+		if c.Start+c.Done >= c.End {
+			continue
+		}
+		wg.Add(1)
+		go func(c *chunk) {
+			defer wg.Done()
+			err := d.fetchChunk(ctx, rawUrl, header, ifRange, f, c, &mu, progress)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				cancel()
+				return
+			}
+			mu.Lock()
+			_ = saveState(statePath, state)
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	if errors.Is(firstErr, ErrRemoteChanged) {
+		_ = os.Remove(statePath)
+		_ = f.Close()
+		_ = os.Remove(part)
+		return firstErr
+	}
+	if firstErr != nil {
+		_ = saveState(statePath, state)
+		return firstErr
+	}
+	return f.Sync()
+}
+
+// fetchChunk 下载一个分块, 每次写入后更新 c.Done
+func (d *Downloader) fetchChunk(ctx context.Context, rawUrl string, header http.Header, ifRange string, f *os.File, c *chunk, mu *sync.Mutex, progress *progress) error {
+	mu.Lock()
+	offset := c.Start + c.Done
+	mu.Unlock()
+	res, err := d.get(ctx, rawUrl, header, fmt.Sprintf("bytes=%d-%d", offset, c.End-1), ifRange)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent {
+		return ErrRemoteChanged
+	}
+
+	buf := make([]byte, 32*1024)
+	for offset < c.End {
+		n, readErr := res.Body.Read(buf[:min(int64(len(buf)), c.End-offset)])
+		if n > 0 {
+			if _, err = f.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+			mu.Lock()
+			c.Done = offset - c.Start
+			mu.Unlock()
+			progress.add(int64(n))
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &parser.ParseError{Kind: parser.ErrNetwork, Err: readErr}
+		}
+	}
+	if offset < c.End {
+		return &parser.ParseError{Kind: parser.ErrNetwork, Err: io.ErrUnexpectedEOF}
+	}
+	return nil
+}
+
+// writeBody 从头写入 part, maxSize 大于0时最多写入 maxSize 字节
+func writeBody(part string, body io.Reader, maxSize int64, progress *progress) error {
+	f, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if maxSize > 0 {
+		w = &limitWriter{w: f, n: maxSize}
+	}
+	if _, err = io.Copy(w, io.TeeReader(body, progress)); err != nil {
+		if errors.Is(err, ErrTooLarge) {
+			_ = f.Close()
+			_ = os.Remove(part)
+			return err
+		}
+		return &parser.ParseError{Kind: parser.ErrNetwork, Err: err}
+	}
+	return f.Close()
+}
+
+// limitWriter 最多写入 n 字节, 超过时返回 ErrTooLarge
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, ErrTooLarge
+	}
+	n, err := l.w.Write(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// newState 按大小划分分块, 小于 minSize 或 chunks 不大于1时只有一个分块, 也可以续传
+func newState(remote remoteFile, chunks int, minSize int64) *partState {
+	state := &partState{Size: remote.size, ETag: remote.etag, LastModified: remote.lastModified}
+	if remote.size < minSize {
+		chunks = 1
+	}
+	chunks = max(chunks, 1)
+	chunkSize := (remote.size + int64(chunks) - 1) / int64(chunks)
+	for start := int64(0); start < remote.size; start += chunkSize {
+		state.Chunks = append(state.Chunks, &chunk{Start: start, End: min(start+chunkSize, remote.size)})
+	}
+	return state
+}
+
+// loadState 读取分块进度, 文件不存在、服务器上的文件已变化或 part 文件不完整时返回 nil
+func loadState(statePath, part string, remote remoteFile) *partState {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	var state partState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	if state.Size != remote.size || state.ETag != remote.etag || state.LastModified != remote.lastModified {
+		return nil
+	}
+	if stat, err := os.Stat(part); err != nil || stat.Size() != state.Size {
+		return nil
+	}
+	return &state
+}
+
+// saveState 保存分块进度, 先写临时文件再重命名
+func saveState(statePath string, state *partState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := statePath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statePath)
+}
+
+// parseChecksum 解析 算法:十六进制值 格式的校验和
+func parseChecksum(checksum string) (func() hash.Hash, []byte, error) {
+	if len(checksum) <= 0 {
+		return nil, nil, nil
+	}
+	algorithm, value, _ := strings.Cut(checksum, ":")
+	sum, err := hex.DecodeString(value)
+	if err != nil || len(sum) <= 0 {
+		return nil, nil, fmt.Errorf("invalid checksum %q", checksum)
+	}
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New, sum, nil
+	case "sha1":
+		return sha1.New, sum, nil
+	case "sha256":
+		return sha256.New, sum, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+}
+
+// verifyChecksum 校验文件, checksum 为空时不校验
+func verifyChecksum(path, checksum string) error {
+	newHash, want, err := parseChecksum(checksum)
+	if err != nil || newHash == nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("%w: %s got %x", ErrChecksum, filepath.Base(path), got)
+	}
+	return nil
+}
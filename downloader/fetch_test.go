@@ -0,0 +1,242 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testContent 测试用的文件内容
+var testContent = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+// rangeServer 支持 Range 的测试服务器, 记录请求的 Range 和返回的字节数
+type rangeServer struct {
+	*httptest.Server
+	etag   string
+	ranges bool
+
+	mu     sync.Mutex
+	served atomic.Int64
+	seen   []string
+}
+
+func newRangeServer(t *testing.T, ranges bool) *rangeServer {
+	s := &rangeServer{etag: `"v1"`, ranges: ranges}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.seen = append(s.seen, r.Header.Get("Range"))
+		s.mu.Unlock()
+		if !s.ranges {
+			r.Header.Del("Range")
+		}
+		w.Header().Set("ETag", s.etag)
+		cw := &countingWriter{ResponseWriter: w, n: &s.served}
+		http.ServeContent(cw, r, "", time.Time{}, bytes.NewReader(testContent))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	w.n.Add(int64(len(data)))
+	return w.ResponseWriter.Write(data)
+}
+
+func TestDownloader_Fetch(t *testing.T) {
+	sum := sha256.Sum256(testContent)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+	for _, tt := range []struct {
+		name     string
+		ranges   bool
+		chunks   int
+		checksum string
+		requests int // 不含探测请求
+		err      error
+	}{
+		{name: "chunks", ranges: true, chunks: 4, checksum: checksum, requests: 4},
+		{name: "single", ranges: true, chunks: 1, requests: 1},
+		{name: "no range", ranges: false, chunks: 4, checksum: checksum},
+		{name: "checksum mismatch", ranges: true, chunks: 2, checksum: "md5:00112233445566778899aabbccddeeff", requests: 2, err: ErrChecksum},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRangeServer(t, tt.ranges)
+			var last Progress
+			d := New(t.TempDir(), WithChunks(tt.chunks, 1024), WithProgress(func(p Progress) { last = p }))
+			path := filepath.Join(d.dir, "a", "file.bin")
+			file, err := d.Fetch(context.Background(), Request{Url: s.URL, Path: path, Checksum: tt.checksum})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Fetch error = %v, want %v", err, tt.err)
+			}
+			if len(s.seen)-1 != tt.requests {
+				t.Errorf("requests = %d, want %d: %q", len(s.seen)-1, tt.requests, s.seen)
+			}
+			if tt.err != nil {
+				if _, err = os.Stat(path + partSuffix); !os.IsNotExist(err) {
+					t.Errorf("part file should be removed, err = %v", err)
+				}
+				return
+			}
+			data, _ := os.ReadFile(path)
+			if !bytes.Equal(data, testContent) || file.Size != int64(len(testContent)) {
+				t.Errorf("file size = %d, content equal = %v", file.Size, bytes.Equal(data, testContent))
+			}
+			if last.Downloaded != int64(len(testContent)) || last.Total != int64(len(testContent)) {
+				t.Errorf("last progress = %+v", last)
+			}
+			if leftover, _ := filepath.Glob(path + ".*"); len(leftover) > 0 {
+				t.Errorf("leftover files: %v", leftover)
+			}
+
+			// 已存在时不重复下载
+			file, err = d.Fetch(context.Background(), Request{Url: s.URL, Path: path, Checksum: tt.checksum})
+			if err != nil || !file.Skipped {
+				t.Errorf("second Fetch = %+v, %v, want skipped", file, err)
+			}
+		})
+	}
+}
+
+func TestDownloader_Fetch_resume(t *testing.T) {
+	s := newRangeServer(t, true)
+	d := New(t.TempDir(), WithChunks(2, 1024))
+	path := filepath.Join(d.dir, "file.bin")
+
+	// 模拟中断: 第一块写入了 1000 字节, 第二块写入了 100 字节, 未写入的部分是无效数据
+	size := int64(len(testContent))
+	half := size / 2
+	part := bytes.Repeat([]byte{'x'}, len(testContent))
+	copy(part, testContent[:1000])
+	copy(part[half:], testContent[half:half+100])
+	if err := os.WriteFile(path+partSuffix, part, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeState := func(etag string) {
+		data, _ := json.Marshal(partState{Size: size, ETag: etag, Chunks: []*chunk{
+			{Start: 0, End: half, Done: 1000},
+			{Start: half, End: size, Done: 100},
+		}})
+		if err := os.WriteFile(path+stateSuffix, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeState(s.etag)
+
+	if _, err := d.Fetch(context.Background(), Request{Url: s.URL, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, testContent) {
+		t.Errorf("resumed file content mismatch")
+	}
+	// 探测请求1字节 + 剩余部分
+	if served, want := s.served.Load(), size-1100+1; served != want {
+		t.Errorf("served %d bytes, want %d: %q", served, want, s.seen)
+	}
+
+	// 服务器上的文件变化后从头下载
+	_ = os.Remove(path)
+	if err := os.WriteFile(path+partSuffix, part, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeState(`"v0"`)
+	s.served.Store(0)
+	if _, err := d.Fetch(context.Background(), Request{Url: s.URL, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, testContent) {
+		t.Errorf("restarted file content mismatch")
+	}
+	if served, want := s.served.Load(), size+1; served != want {
+		t.Errorf("served %d bytes after change, want %d", served, want)
+	}
+}
+
+func TestDownloader_Fetch_canceled(t *testing.T) {
+	// 每次只返回一部分内容后阻塞, 取消后保存进度
+	block := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-0" {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(testContent))
+			return
+		}
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(testContent)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(testContent[start : start+512])
+		w.(http.Flusher).Flush()
+		<-block
+	}))
+	defer s.Close()
+	defer close(block)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := New(t.TempDir(), WithChunks(2, 1024), WithProgress(func(p Progress) {
+		if p.Downloaded >= 1024 {
+			cancel()
+		}
+	}))
+	path := filepath.Join(d.dir, "file.bin")
+	if _, err := d.Fetch(ctx, Request{Url: s.URL, Path: path}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Fetch error = %v, want canceled", err)
+	}
+
+	data, err := os.ReadFile(path + stateSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state partState
+	if err = json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Chunks) != 2 || state.Chunks[0].Done != 512 || state.Chunks[1].Done != 512 {
+		t.Errorf("saved state = %s", data)
+	}
+}
+
+func TestDownloader_Fetch_maxSize(t *testing.T) {
+	// 分块传输, 大小未知
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < len(testContent); i += 4096 {
+			_, _ = w.Write(testContent[i : i+4096])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer chunked.Close()
+
+	dir := t.TempDir()
+	d := New(dir, WithHttpClient(chunked.Client()), WithMaxSize(int64(len(testContent))-1))
+	for _, rawUrl := range []string{newRangeServer(t, true).URL, newRangeServer(t, false).URL, chunked.URL} {
+		path := filepath.Join(dir, "video.mp4")
+		if _, err := d.Fetch(context.Background(), Request{Url: rawUrl, Path: path}); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Fetch %s error = %v, want ErrTooLarge", rawUrl, err)
+		}
+		if _, err := os.Stat(path + partSuffix); err == nil {
+			t.Errorf("Fetch %s left the part file", rawUrl)
+		}
+	}
+
+	d = New(dir, WithHttpClient(chunked.Client()), WithMaxSize(int64(len(testContent))))
+	if _, err := d.Fetch(context.Background(), Request{Url: chunked.URL, Path: filepath.Join(dir, "video.mp4")}); err != nil {
+		t.Errorf("Fetch within limit error = %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultTemplate 默认文件名模板
+const DefaultTemplate = "{source}/{title}-{id}.{ext}"
+
+// maxNameLength 每个变量替换后的最大长度(字符数), 避免超过文件系统的文件名长度限制
+const maxNameLength = 80
+
+// templateVarRe 模板变量, 如: {title}, {author.name}
+var templateVarRe = regexp.MustCompile(`\{([a-z_.]+)\}`)
+
+// Vars 文件名模板变量
+// 内置变量: source 渠道, id 视频id(解析结果没有视频id时为视频地址的摘要), title 标题, author.name 作者名称, author.uid 作者id,
+// kind 文件类型(video, audio, cover, image), index 图集图片的序号(从01开始, 其他文件为空), ext 扩展名
+type Vars map[string]string
+
+// Template 文件名模板, 变量写在 {} 中, / 分隔子目录; 变量的值会替换文件系统不允许的字符, 不会产生子目录
+type Template struct {
+	text string
+	vars []string // 模板中使用的变量
+}
+
+// ParseTemplate 解析文件名模板, 模板需要包含 {ext}, 不能是绝对路径或包含 ..
+func ParseTemplate(text string) (*Template, error) {
+	t := &Template{text: text}
+	for _, match := range templateVarRe.FindAllStringSubmatch(text, -1) {
+		t.vars = append(t.vars, match[1])
+	}
+	literal := templateVarRe.ReplaceAllString(text, "x")
+	switch {
+	case strings.ContainsAny(literal, "{}"):
+		return nil, fmt.Errorf("template %q: invalid variable", text)
+	case !t.uses("ext"):
+		return nil, fmt.Errorf("template %q: missing {ext}", text)
+	case strings.HasPrefix(literal, "/") || strings.Contains(literal, "\\"):
+		return nil, fmt.Errorf("template %q: must be a relative path", text)
+	}
+	for _, elem := range strings.Split(literal, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return nil, fmt.Errorf("template %q: invalid path element %q", text, elem)
+		}
+	}
+	return t, nil
+}
+
+// MustParseTemplate 同 ParseTemplate, 出错时 panic
+func MustParseTemplate(text string) *Template {
+	t, err := ParseTemplate(text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t *Template) String() string {
+	return t.text
+}
+
+// uses 模板是否使用了变量
+func (t *Template) uses(name string) bool {
+	for _, item := range t.vars {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute 替换模板变量, 返回以 / 分隔的相对路径
+// 模板没有使用 kind 或 index 时, 在扩展名前加上对应的后缀区分不同的文件, 如: _cover, _audio, _01
+func (t *Template) Execute(vars Vars) string {
+	name := templateVarRe.ReplaceAllStringFunc(t.text, func(match string) string {
+		if value := vars[match[1:len(match)-1]]; len(value) > 0 {
+			return SanitizeName(value)
+		}
+		return ""
+	})
+	// 变量为空时, 避免产生空目录名或 . 开头的隐藏文件
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		if elem == "" || strings.HasPrefix(elem, ".") {
+			elems[i] = "_" + elem
+		}
+	}
+	name = strings.Join(elems, "/")
+	var suffix string
+	if kind := vars["kind"]; kind != "" && kind != KindVideo && kind != KindImage && !t.uses("kind") {
+		suffix = "_" + SanitizeName(kind)
+	}
+	if index := vars["index"]; index != "" && !t.uses("index") {
+		suffix += "_" + SanitizeName(index)
+	}
+	if len(suffix) <= 0 {
+		return name
+	}
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + suffix + ext
+}
+
+// SanitizeName 替换文件名中文件系统不允许的字符和控制字符, 合并空白字符, 去掉首尾的空格和点, 并限制长度
+// 结果为空时返回 _
+func SanitizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case r == utf8.RuneError, unicode.IsControl(r), strings.ContainsRune(`/\:*?"<>|`, r):
+			r = '_'
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+
+	name = strings.Trim(b.String(), " .")
+	if utf8.RuneCountInString(name) > maxNameLength {
+		name = strings.TrimRight(string([]rune(name)[:maxNameLength]), " .")
+	}
+	if len(name) <= 0 {
+		return "_"
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+package downloader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeName(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{name: "标题 #话题", want: "标题 #话题"},
+		{name: "a/b\\c:d*e?f\"g<h>i|j", want: "a_b_c_d_e_f_g_h_i_j"},
+		{name: "  多行\n标题\t ", want: "多行 标题"},
+		{name: "..", want: "_"},
+		{name: "../etc/passwd", want: "_etc_passwd"},
+		{name: "", want: "_"},
+		{name: "ctrl\x00\x7f", want: "ctrl__"},
+		{name: strings.Repeat("长", 100), want: strings.Repeat("长", maxNameLength)},
+	} {
+		if got := SanitizeName(tt.name); got != tt.want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	for _, text := range []string{
+		"{title}",            // 缺少扩展名
+		"/tmp/{title}.{ext}", // 绝对路径
+		"../{title}.{ext}",
+		"a//{title}.{ext}",
+		"{Title}.{ext}",
+		"{title.{ext}",
+	} {
+		if _, err := ParseTemplate(text); err == nil {
+			t.Errorf("ParseTemplate(%q) should fail", text)
+		}
+	}
+}
+
+func TestTemplate_Execute(t *testing.T) {
+	vars := Vars{"source": "douyin", "id": "123", "title": "a/b: c", "author.name": "作者", "ext": "jpg"}
+	for _, tt := range []struct {
+		template string
+		kind     string
+		index    string
+		want     string
+	}{
+		{template: "{source}/{author.name}/{title}-{id}.{ext}", kind: KindVideo, want: "douyin/作者/a_b_ c-123.jpg"},
+		{template: "{source}/{author.name}/{title}-{id}.{ext}", kind: KindCover, want: "douyin/作者/a_b_ c-123_cover.jpg"},
+		{template: "{id}.{ext}", kind: KindImage, index: "02", want: "123_02.jpg"},
+		{template: "{id}/{kind}{index}.{ext}", kind: KindImage, index: "02", want: "123/image02.jpg"},
+		{template: "{id}/{kind}{index}.{ext}", kind: KindVideo, want: "123/video.jpg"},
+		{template: "{id}/{kind}.{ext}", kind: KindImage, index: "02", want: "123/image_02.jpg"},
+		{template: "{id}{index}.{ext}", kind: KindCover, want: "123_cover.jpg"},
+		{template: "{unknown}.{ext}", kind: KindVideo, want: "_.jpg"},
+		{template: "{unknown}/{id}.{ext}", kind: KindVideo, want: "_/123.jpg"},
+	} {
+		vars["kind"], vars["index"] = tt.kind, tt.index
+		if got := MustParseTemplate(tt.template).Execute(vars); got != tt.want {
+			t.Errorf("%s kind %s index %q = %q, want %q", tt.template, tt.kind, tt.index, got, tt.want)
+		}
+	}
+}
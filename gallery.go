@@ -0,0 +1,188 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wujunwei928/parse-video/downloader"
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// errGalleryTooLarge 图集总大小超过限制
+var errGalleryTooLarge = errors.New("图集超过大小限制")
+
+// galleryEntry 图集 zip 中的一个图片文件
+type galleryEntry struct {
+	name string // 不含扩展名的文件名, 扩展名根据地址或响应类型确定
+	url  string
+}
+
+// galleryHandler /video/gallery.zip 解析分享链接, 将图集打包为 zip 返回
+// zip 中的文件依次为: 封面 cover.jpg(cover=1 时), 按顺序编号的图片 01.jpg, 02.webp..., 解析结果 meta.json
+// 图片和封面的总大小超过 maxSize 时, 还未开始传输则返回 413, 否则中断传输
+func galleryHandler(client *http.Client, maxSize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info, err := parser.ParseVideoShareUrlByRegexpContext(c.Request.Context(), c.Query("url"))
+		if err != nil {
+			status := parseErrorStatus(err)
+			c.JSON(status, HttpResponse{
+				Code: status,
+				Msg:  err.Error(),
+			})
+			return
+		}
+		if len(info.Images) <= 0 {
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  "该链接没有图集",
+			})
+			return
+		}
+
+		var entries []galleryEntry
+		if c.Query("cover") == "1" && len(info.CoverUrl) > 0 {
+			entries = append(entries, galleryEntry{name: "cover", url: info.CoverUrl})
+		}
+		width := max(len(fmt.Sprint(len(info.Images))), 2)
+		for i, image := range info.Images {
+			entries = append(entries, galleryEntry{name: fmt.Sprintf("%0*d", width, i+1), url: image})
+		}
+
+		name := "gallery.zip"
+		if len(info.Title) > 0 {
+			name = downloader.SanitizeName(info.Title) + ".zip"
+		}
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		c.Status(http.StatusOK)
+
+		err = writeGallery(c.Request.Context(), c.Writer, client, entries, info, maxSize)
+		if err == nil {
+			return
+		}
+		log.Printf("打包图集失败: %v", err)
+		// 已开始传输时只能中断, zip 缺少目录无法解压; 否则返回错误信息
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("Content-Type")
+			status := http.StatusBadGateway
+			if errors.Is(err, errGalleryTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.JSON(status, HttpResponse{
+				Code: status,
+				Msg:  "打包图集失败: " + err.Error(),
+			})
+		}
+	}
+}
+
+// writeGallery 依次下载图片写入 zip, 最后写入解析结果 meta.json
+// 出错时不写入 zip 目录, 避免客户端得到缺少图片但可以解压的文件
+func writeGallery(ctx context.Context, w io.Writer, client *http.Client, entries []galleryEntry, info *parser.VideoParseInfo, maxSize int64) error {
+	zw := zip.NewWriter(w)
+	remaining := maxSize
+	for _, entry := range entries {
+		n, err := writeGalleryEntry(ctx, zw, client, entry, remaining)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.url, err)
+		}
+		remaining -= n
+	}
+
+	meta, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "meta.json", Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(meta); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeGalleryEntry 下载一张图片写入 zip, 最多写入 limit 字节, 返回写入的字节数
+// 图片本身已压缩, 不再压缩
+func writeGalleryEntry(ctx context.Context, zw *zip.Writer, client *http.Client, entry galleryEntry, limit int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, entry.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", parser.DefaultUserAgent)
+	if source, ok := parser.MatchMediaHost(req.URL.Hostname()); ok {
+		for name, values := range parser.MediaHeaders(source) {
+			req.Header[name] = values
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > limit {
+		return 0, errGalleryTooLarge
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     entry.name + "." + imageExt(entry.url, resp.Header.Get("Content-Type")),
+		Method:   zip.Store,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return n, err
+	}
+	if n > limit {
+		return n, errGalleryTooLarge
+	}
+	return n, nil
+}
+
+// imageExts 图片响应类型对应的扩展名
+var imageExts = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/webp": "webp",
+	"image/gif":  "gif",
+	"image/heic": "heic",
+	"image/avif": "avif",
+}
+
+// imageExt 图片扩展名: 优先使用地址中的扩展名, 其次根据响应类型, 都无法识别时为 jpg
+func imageExt(rawUrl, contentType string) string {
+	if u, err := url.Parse(rawUrl); err == nil {
+		switch ext := strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), ".")); ext {
+		case "jpg", "jpeg":
+			return "jpg"
+		case "png", "webp", "gif", "heic", "avif":
+			return ext
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if ext, ok := imageExts[mediaType]; ok {
+		return ext
+	}
+	return "jpg"
+}
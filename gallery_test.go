@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+// fakeGalleryParser 测试用的图集渠道, 根据分享链接的最后一段返回不同的图集
+type fakeGalleryParser struct {
+	mediaUrl string
+}
+
+func (p fakeGalleryParser) ParseShareUrl(_ context.Context, shareUrl string) (*parser.VideoParseInfo, error) {
+	info := &parser.VideoParseInfo{Title: "图集/标题", CoverUrl: p.mediaUrl + "/cover"}
+	switch shareUrl[strings.LastIndex(shareUrl, "/")+1:] {
+	case "video":
+		info.VideoUrl = p.mediaUrl + "/video.mp4"
+	case "large":
+		info.Images = []string{p.mediaUrl + "/large.png"}
+	case "missing":
+		info.Images = []string{p.mediaUrl + "/1.jpeg", p.mediaUrl + "/missing.jpg"}
+	default:
+		info.Images = []string{p.mediaUrl + "/1.jpeg", p.mediaUrl + "/2?x=.png"}
+	}
+	return info, nil
+}
+
+func TestGalleryHandler(t *testing.T) {
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://gallery.test/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/missing.jpg":
+			w.WriteHeader(http.StatusNotFound)
+		case "/large.png":
+			_, _ = w.Write(bytes.Repeat([]byte{'x'}, 2048))
+		case "/2":
+			w.Header().Set("Content-Type", "image/webp")
+			_, _ = w.Write([]byte(r.URL.Path))
+		default:
+			_, _ = w.Write([]byte(r.URL.Path))
+		}
+	}))
+	defer media.Close()
+
+	const source = "gallery_test"
+	if err := parser.Register(source, parser.SourceInfo{
+		VideoShareUrlDomain: []string{"gallery.test"},
+		VideoShareUrlParser: fakeGalleryParser{media.URL},
+		VideoIdParser:       struct{ parser.VideoIdParser }{},
+		MediaDomains:        []string{"127.0.0.1"},
+		MediaHeaders:        map[string]string{"Referer": "https://gallery.test/"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer parser.Unregister(source)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/video/gallery.zip", galleryHandler(media.Client(), 1024))
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/video/gallery.zip?"+query, nil))
+		return w
+	}
+
+	for _, tt := range []struct {
+		shareUrl string
+		status   int
+	}{
+		{shareUrl: "https://gallery.test/video", status: http.StatusBadRequest},
+		{shareUrl: "https://gallery.test/large", status: http.StatusRequestEntityTooLarge},
+		{shareUrl: "https://gallery.test/missing", status: http.StatusBadGateway},
+		{shareUrl: "https://example.com/1", status: http.StatusBadRequest},
+	} {
+		w := get("url=" + tt.shareUrl)
+		if w.Code != tt.status {
+			t.Errorf("%s status = %d, want %d: %s", tt.shareUrl, w.Code, tt.status, w.Body.String())
+		}
+		// 打包失败时返回的是 JSON, 不能带有 zip 的响应头
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") || w.Header().Get("Content-Disposition") != "" {
+			t.Errorf("%s Content-Type = %q, Content-Disposition = %q", tt.shareUrl, contentType, w.Header().Get("Content-Disposition"))
+		}
+	}
+
+	w := get("url=https://gallery.test/ok&cover=1")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("status = %d, content type %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.Contains(disposition, "filename*=utf-8''%E5%9B%BE%E9%9B%86_%E6%A0%87%E9%A2%98.zip") {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ name, content string }{
+		{"cover.jpg", "/cover"},
+		{"01.jpg", "/1.jpeg"},
+		{"02.webp", "/2"},
+		{"meta.json", ""},
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("zip has %d files, want %d", len(zr.File), len(want))
+	}
+	for i, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if f.Name != want[i].name {
+			t.Errorf("file %d name = %s, want %s", i, f.Name, want[i].name)
+		}
+		if f.Name == "meta.json" {
+			var info parser.VideoParseInfo
+			if err = json.Unmarshal(data, &info); err != nil || info.Title != "图集/标题" || len(info.Images) != 2 {
+				t.Errorf("meta.json = %s, %v", data, err)
+			}
+		} else if string(data) != want[i].content {
+			t.Errorf("%s = %q, want %q", f.Name, data, want[i].content)
+		}
+	}
+}
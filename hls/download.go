@@ -0,0 +1,352 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// defaultUserAgent 请求播放列表和分片时默认使用的 UserAgent
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36"
+
+// maxPlaylistSize 播放列表的最大长度
+const maxPlaylistSize = 8 << 20
+
+// maxSegmentSize 分片和初始化分片的最大长度, 下载时内存中最多保留 concurrency 个分片
+const maxSegmentSize = 32 << 20
+
+// ErrTooLarge 播放列表或分片超过最大长度
+var ErrTooLarge = errors.New("hls response too large")
+
+type options struct {
+	httpClient  *http.Client
+	header      http.Header
+	headerFunc  func(u *url.URL) http.Header
+	concurrency int
+	maxHeight   int64
+}
+
+// Option Download 和 Proxy 配置项
+type Option func(o *options)
+
+// WithHttpClient 使用自定义的 http.Client 请求播放列表和分片
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		if httpClient != nil {
+			o.httpClient = httpClient
+		}
+	}
+}
+
+// WithHeader 设置请求播放列表和分片的请求头, 如: Referer
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		o.header.Set(key, value)
+	}
+}
+
+// WithHeaderFunc 根据请求地址设置请求头, 覆盖 WithHeader 设置的同名请求头
+// 用于播放列表、分片和密钥在不同域名, 需要不同的 Referer 等请求头
+func WithHeaderFunc(headerFunc func(u *url.URL) http.Header) Option {
+	return func(o *options) {
+		o.headerFunc = headerFunc
+	}
+}
+
+// WithConcurrency 设置同时下载的分片数, 默认4
+func WithConcurrency(concurrency int) Option {
+	return func(o *options) {
+		if concurrency > 0 {
+			o.concurrency = concurrency
+		}
+	}
+}
+
+// WithMaxHeight 主播放列表有多个码率时, 选择高度不超过 maxHeight 的最高码率, 默认选择最高码率
+func WithMaxHeight(maxHeight int64) Option {
+	return func(o *options) {
+		o.maxHeight = maxHeight
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		httpClient:  http.DefaultClient,
+		header:      http.Header{"User-Agent": {defaultUserAgent}},
+		concurrency: 4,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// SelectVariant 选择码率: maxHeight 大于0时, 选择高度不超过 maxHeight 的最高码率, 都超过时选择最低码率
+// maxHeight 为0时选择最高码率
+func SelectVariant(variants []Variant, maxHeight int64) (Variant, bool) {
+	if len(variants) <= 0 {
+		return Variant{}, false
+	}
+	sorted := append([]Variant(nil), variants...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Bandwidth > sorted[j].Bandwidth
+	})
+	if maxHeight <= 0 {
+		return sorted[0], true
+	}
+	for _, variant := range sorted {
+		if variant.Height > 0 && variant.Height <= maxHeight {
+			return variant, true
+		}
+	}
+	return sorted[len(sorted)-1], true
+}
+
+// Download 下载 m3u8 的所有分片, 解密后按顺序拼接写入 w
+// ts 分片拼接为 ts 文件, fmp4 分片拼接为 mp4 文件(初始化分片写在最前面)
+// 主播放列表时按 WithMaxHeight 选择码率; 直播播放列表只下载当前列表中的分片
+func Download(ctx context.Context, w io.Writer, playlistUrl string, opts ...Option) error {
+	playlist, err := Resolve(ctx, playlistUrl, opts...)
+	if err != nil {
+		return err
+	}
+	return DownloadPlaylist(ctx, w, playlist, opts...)
+}
+
+// Resolve 请求播放列表, 主播放列表时按 WithMaxHeight 选择码率, 返回媒体播放列表
+// 可根据 IsFmp4 确定下载后的文件格式, 再调用 DownloadPlaylist 下载
+func Resolve(ctx context.Context, playlistUrl string, opts ...Option) (*Playlist, error) {
+	o := newOptions(opts)
+	playlist, err := o.fetchPlaylist(ctx, playlistUrl)
+	if err != nil {
+		return nil, err
+	}
+	if playlist.IsMaster() {
+		variant, _ := SelectVariant(playlist.Variants, o.maxHeight)
+		if playlist, err = o.fetchPlaylist(ctx, variant.Uri); err != nil {
+			return nil, err
+		}
+		if playlist.IsMaster() {
+			return nil, fmt.Errorf("%w: nested master playlist", ErrInvalidPlaylist)
+		}
+	}
+	return playlist, nil
+}
+
+// DownloadPlaylist 下载媒体播放列表的所有分片, 解密后按顺序拼接写入 w
+func DownloadPlaylist(ctx context.Context, w io.Writer, playlist *Playlist, opts ...Option) error {
+	if playlist.IsMaster() {
+		return fmt.Errorf("%w: master playlist has no segments", ErrInvalidPlaylist)
+	}
+	return newOptions(opts).downloadSegments(ctx, w, playlist.Segments)
+}
+
+// fetchPlaylist 请求并解析播放列表
+func (o *options) fetchPlaylist(ctx context.Context, playlistUrl string) (*Playlist, error) {
+	data, err := o.fetch(ctx, playlistUrl, 0, 0, maxPlaylistSize)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, playlistUrl)
+}
+
+// segmentResult 分片下载结果
+type segmentResult struct {
+	data []byte
+	err  error
+}
+
+// downloadSegments 并发下载分片, 按顺序写入 w, 内存中最多保留 concurrency 个分片
+func (o *options) downloadSegments(ctx context.Context, w io.Writer, segments []Segment) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys := &keyCache{o: o, keys: make(map[string][]byte)}
+	results := make([]chan segmentResult, len(segments))
+	for i := range results {
+		results[i] = make(chan segmentResult, 1)
+	}
+
+	// 写入一个分片后才开始下载下一个, 限制并发数和内存占用
+	sem := make(chan struct{}, o.concurrency)
+	go func() {
+		for i := range segments {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int) {
+				data, err := o.downloadSegment(ctx, keys, segments[i])
+				results[i] <- segmentResult{data: data, err: err}
+			}(i)
+		}
+	}()
+
+	var lastMap *Map
+	for i, segment := range segments {
+		var res segmentResult
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if res.err != nil {
+			return fmt.Errorf("download segment %d fail: %w", i, res.err)
+		}
+
+		// fmp4 初始化分片, 变化时重新写入
+		if segment.Map != nil && (lastMap == nil || *lastMap != *segment.Map) {
+			initData, err := o.fetch(ctx, segment.Map.Uri, segment.Map.Offset, segment.Map.Length, maxSegmentSize)
+			if err != nil {
+				return fmt.Errorf("download init segment fail: %w", err)
+			}
+			if _, err = w.Write(initData); err != nil {
+				return err
+			}
+			lastMap = segment.Map
+		}
+
+		if _, err := w.Write(res.data); err != nil {
+			return err
+		}
+		<-sem
+	}
+
+	return nil
+}
+
+// downloadSegment 下载单个分片, 加密时解密
+func (o *options) downloadSegment(ctx context.Context, keys *keyCache, segment Segment) ([]byte, error) {
+	data, err := o.fetch(ctx, segment.Uri, segment.Offset, segment.Length, maxSegmentSize)
+	if err != nil {
+		return nil, err
+	}
+	if segment.Key == nil {
+		return data, nil
+	}
+	if segment.Key.Method != "AES-128" {
+		return nil, fmt.Errorf("unsupported encryption method: %s", segment.Key.Method)
+	}
+
+	key, err := keys.get(ctx, segment.Key.Uri)
+	if err != nil {
+		return nil, fmt.Errorf("get key fail: %w", err)
+	}
+	iv := segment.Key.IV
+	if len(iv) <= 0 {
+		// 未指定 IV 时, 使用分片序号作为 IV
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], uint64(segment.Sequence))
+	}
+	return decryptAes128(data, key, iv)
+}
+
+// decryptAes128 AES-128-CBC 解密, 并去掉 PKCS7 填充
+func decryptAes128(data, key, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("encrypted segment size is not a multiple of block size")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding <= 0 || padding > aes.BlockSize || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("invalid pkcs7 padding")
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+// keyCache 密钥缓存, 同一个密钥只请求一次
+type keyCache struct {
+	o    *options
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func (c *keyCache) get(ctx context.Context, keyUrl string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[keyUrl]; ok {
+		return key, nil
+	}
+	key, err := c.o.fetch(ctx, keyUrl, 0, 0, aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid key length: %d", len(key))
+	}
+	c.keys[keyUrl] = key
+	return key, nil
+}
+
+// newRequest 创建 GET 请求, 带上 WithHeader 和 WithHeaderFunc 设置的请求头
+func (o *options) newRequest(ctx context.Context, reqUrl string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = o.header.Clone()
+	if o.headerFunc != nil {
+		for name, values := range o.headerFunc(req.URL) {
+			req.Header[name] = values
+		}
+	}
+	return req, nil
+}
+
+// fetch 请求地址内容, length 大于0时只请求 offset 开始的 length 字节
+// limit 大于0时限制响应长度, 超过时返回 ErrTooLarge, 不截断返回
+func (o *options) fetch(ctx context.Context, reqUrl string, offset, length, limit int64) ([]byte, error) {
+	req, err := o.newRequest(ctx, reqUrl)
+	if err != nil {
+		return nil, err
+	}
+	if length > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+length-1, 10))
+	}
+
+	res, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("request %s fail, status: %s", reqUrl, res.Status)
+	}
+
+	var body io.Reader = res.Body
+	if limit > 0 {
+		body = io.LimitReader(res.Body, limit+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, fmt.Errorf("request %s fail: %w, limit %d bytes", reqUrl, ErrTooLarge, limit)
+	}
+	// 服务端不支持 Range 时, 返回完整内容, 手动截取; 内容不完整时不能当作分片返回
+	if length > 0 && res.StatusCode == http.StatusOK {
+		if int64(len(data)) < offset+length {
+			return nil, fmt.Errorf("request %s fail, range %d-%d exceeds response length %d", reqUrl, offset, offset+length-1, len(data))
+		}
+		data = data[offset : offset+length]
+	}
+	return data, nil
+}
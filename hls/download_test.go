@@ -0,0 +1,227 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// encryptAes128 AES-128-CBC 加密, 使用 PKCS7 填充
+func encryptAes128(t *testing.T, data, key, iv []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return out
+}
+
+// newTestServer 返回一个 HLS 测试服务: 主播放列表 -> 两个码率, 720p 的分片使用 AES-128 加密
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	key := []byte("0123456789abcdef")
+	seqIv := func(seq uint64) []byte {
+		iv := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], seq)
+		return iv
+	}
+	explicitIv := bytes.Repeat([]byte{0x11}, aes.BlockSize)
+
+	files := map[string][]byte{
+		"/master.m3u8": []byte("#EXTM3U\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=500000,RESOLUTION=640x360\n360p.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=1500000,RESOLUTION=1280x720\n720p.m3u8\n"),
+		"/360p.m3u8": []byte("#EXTM3U\n#EXTINF:2,\nlow0.ts\n#EXTINF:2,\nlow1.ts\n#EXT-X-ENDLIST\n"),
+		"/720p.m3u8": []byte("#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:5\n" +
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"/key\"\n" +
+			"#EXTINF:2,\nseg0.ts\n#EXTINF:2,\nseg1.ts\n" +
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"/key\",IV=0x11111111111111111111111111111111\n" +
+			"#EXTINF:2,\nseg2.ts\n" +
+			"#EXT-X-KEY:METHOD=NONE\n" +
+			"#EXTINF:2,\nseg3.ts\n#EXT-X-ENDLIST\n"),
+		"/key":     key,
+		"/low0.ts": []byte("low0|"),
+		"/low1.ts": []byte("low1|"),
+		"/seg0.ts": encryptAes128(t, []byte("segment-0|"), key, seqIv(5)),
+		"/seg1.ts": encryptAes128(t, []byte("segment-1|"), key, seqIv(6)),
+		"/seg2.ts": encryptAes128(t, []byte("segment-2|"), key, explicitIv),
+		"/seg3.ts": []byte("segment-3|"),
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://www.acfun.cn/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		data, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".m3u8") {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		}
+		_, _ = w.Write(data)
+	}))
+}
+
+func TestDownload(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"best", nil, "segment-0|segment-1|segment-2|segment-3|"},
+		{"max height", []Option{WithMaxHeight(480)}, "low0|low1|"},
+		{"serial", []Option{WithConcurrency(1)}, "segment-0|segment-1|segment-2|segment-3|"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		opts := append([]Option{WithHeader("Referer", "https://www.acfun.cn/")}, tt.opts...)
+		if err := Download(context.Background(), &out, server.URL+"/master.m3u8", opts...); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: Download = %q, want %q", tt.name, out.String(), tt.want)
+		}
+	}
+
+	playlist, err := Resolve(context.Background(), server.URL+"/master.m3u8", WithHeader("Referer", "https://www.acfun.cn/"))
+	if err != nil || len(playlist.Segments) != 4 || playlist.IsFmp4() {
+		t.Errorf("Resolve = %+v, %v", playlist, err)
+	}
+
+	// 缺少 Referer 时请求失败
+	if err := Download(context.Background(), io.Discard, server.URL+"/master.m3u8"); err == nil {
+		t.Errorf("Download without referer should fail")
+	}
+}
+
+func TestProxy(t *testing.T) {
+	upstream := newTestServer(t)
+	defer upstream.Close()
+
+	// 代理链接只携带编号, 代理时根据编号找回地址, 模拟签名令牌
+	var mu sync.Mutex
+	var links []string
+	link := func(uri string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		links = append(links, uri)
+		return "/hls?t=" + strconv.Itoa(len(links)-1)
+	}
+	target := func(r *http.Request) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		i, err := strconv.Atoi(r.URL.Query().Get("t"))
+		if err != nil || i < 0 || i >= len(links) {
+			return "", errors.New("invalid token")
+		}
+		return links[i], nil
+	}
+	proxy := httptest.NewServer(NewProxy(target, link, WithHeaderFunc(func(u *url.URL) http.Header {
+		if u.Host != strings.TrimPrefix(upstream.URL, "http://") {
+			return nil
+		}
+		return http.Header{"Referer": {"https://www.acfun.cn/"}}
+	})))
+	defer proxy.Close()
+
+	get := func(target string) (*http.Response, []byte) {
+		t.Helper()
+		res, err := http.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, data
+	}
+
+	res, data := get(proxy.URL + link(upstream.URL+"/720p.m3u8"))
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/vnd.apple.mpegurl" {
+		t.Fatalf("proxy playlist status = %d, content type = %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	playlist, err := Parse(data, proxy.URL+"/hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := playlist.Segments[0].Key
+	if key == nil {
+		t.Fatal("proxied playlist has no key")
+	}
+	keyReq, _ := http.NewRequest(http.MethodGet, key.Uri, nil)
+	if keyUrl, err := target(keyReq); err != nil || keyUrl != upstream.URL+"/key" {
+		t.Errorf("proxied key = %s, target = %s, %v", key.Uri, keyUrl, err)
+	}
+
+	// 通过代理后的地址可以完整下载
+	var out bytes.Buffer
+	if err = Download(context.Background(), &out, proxy.URL+link(upstream.URL+"/master.m3u8")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "segment-0|segment-1|segment-2|segment-3|"; out.String() != want {
+		t.Errorf("Download via proxy = %q, want %q", out.String(), want)
+	}
+
+	// 不接受 target 无法校验的地址
+	if res, _ = get(proxy.URL + "/hls?url=" + url.QueryEscape(upstream.URL+"/720p.m3u8")); res.StatusCode != http.StatusForbidden {
+		t.Errorf("proxy unsigned url status = %d, want %d", res.StatusCode, http.StatusForbidden)
+	}
+	if res, _ = get(proxy.URL + link("file:///etc/passwd")); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("proxy non-http url status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestFetch_rangeIgnored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 忽略 Range, 返回完整内容
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	o := newOptions(nil)
+	data, err := o.fetch(context.Background(), server.URL, 2, 4, 0)
+	if err != nil || string(data) != "2345" {
+		t.Errorf("fetch = %q, %v, want %q", data, err, "2345")
+	}
+	if data, err = o.fetch(context.Background(), server.URL, 8, 4, 0); err == nil {
+		t.Errorf("fetch beyond response = %q, want error", data)
+	}
+}
+
+func TestFetch_limit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	o := newOptions(nil)
+	if data, err := o.fetch(context.Background(), server.URL, 0, 0, 10); err != nil || string(data) != "0123456789" {
+		t.Errorf("fetch = %q, %v", data, err)
+	}
+	// 超过长度限制时返回错误, 不截断
+	if data, err := o.fetch(context.Background(), server.URL, 0, 0, 9); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("fetch over limit = %q, %v, want ErrTooLarge", data, err)
+	}
+}
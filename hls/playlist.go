@@ -0,0 +1,242 @@
+// Package hls 解析 m3u8 播放列表, 下载并拼接分片, 以及改写播放列表地址用于代理播放
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPlaylist 不是有效的 m3u8 播放列表
+var ErrInvalidPlaylist = errors.New("invalid m3u8 playlist")
+
+// Playlist m3u8 播放列表, 主播放列表(master)只有 Variants, 媒体播放列表只有 Segments
+type Playlist struct {
+	Variants       []Variant // 不同码率的子播放列表
+	TargetDuration float64   // 分片最大时长, 秒
+	MediaSequence  int64     // 第一个分片的序号
+	Segments       []Segment // 分片列表
+	EndList        bool      // 是否有 EXT-X-ENDLIST, 没有时为直播
+}
+
+// IsMaster 是否为主播放列表
+func (p *Playlist) IsMaster() bool {
+	return len(p.Variants) > 0
+}
+
+// IsFmp4 分片是否为 fmp4 格式(有 EXT-X-MAP 初始化分片), 拼接后为 mp4 文件, 否则为 ts 文件
+func (p *Playlist) IsFmp4() bool {
+	for _, segment := range p.Segments {
+		if segment.Map != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Variant 主播放列表中的一个码率
+type Variant struct {
+	Uri        string // 子播放列表绝对地址
+	Bandwidth  int64  // 码率, bps
+	Width      int64  // 宽度, 未知时为0
+	Height     int64  // 高度, 未知时为0
+	Codecs     string // 编码, 如: avc1.64001f,mp4a.40.2
+	Resolution string // 分辨率, 如: 1280x720
+}
+
+// Segment 媒体播放列表中的一个分片
+type Segment struct {
+	Uri      string  // 分片绝对地址
+	Duration float64 // 时长, 秒
+	Sequence int64   // 分片序号, 用于生成默认的解密 IV
+	Key      *Key    // 加密信息, 未加密时为 nil
+	Map      *Map    // fmp4 初始化分片, ts 分片时为 nil
+	Offset   int64   // EXT-X-BYTERANGE 偏移, Length 为0时不使用
+	Length   int64   // EXT-X-BYTERANGE 长度
+}
+
+// Key 分片加密信息, EXT-X-KEY
+type Key struct {
+	Method string // 加密方式, 如: AES-128
+	Uri    string // 密钥绝对地址
+	IV     []byte // 初始化向量, 为空时使用分片序号
+}
+
+// Map fmp4 初始化分片, EXT-X-MAP
+type Map struct {
+	Uri    string
+	Offset int64
+	Length int64
+}
+
+// Parse 解析 m3u8 播放列表, 相对地址根据 baseUrl 转换为绝对地址
+func Parse(data []byte, baseUrl string) (*Playlist, error) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("parse base url fail: %w", err)
+	}
+	resolve := func(uri string) (string, error) {
+		ref, err := url.Parse(uri)
+		if err != nil {
+			return "", fmt.Errorf("%w: bad uri %q", ErrInvalidPlaylist, uri)
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() || strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff")) != "#EXTM3U" {
+		return nil, fmt.Errorf("%w: missing #EXTM3U", ErrInvalidPlaylist)
+	}
+
+	var (
+		playlist   = &Playlist{}
+		key        *Key
+		segmentMap *Map
+		variant    *Variant
+		segment    *Segment
+		nextOffset int64 // EXT-X-BYTERANGE 未指定偏移时, 紧接上一个分片
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) <= 0 {
+			continue
+		}
+
+		tag, value, _ := strings.Cut(line, ":")
+		switch tag {
+		case "#EXT-X-STREAM-INF":
+			attrs := parseAttributes(value)
+			variant = &Variant{
+				Codecs:     attrs["CODECS"],
+				Resolution: attrs["RESOLUTION"],
+			}
+			variant.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+			if w, h, ok := strings.Cut(variant.Resolution, "x"); ok {
+				variant.Width, _ = strconv.ParseInt(w, 10, 64)
+				variant.Height, _ = strconv.ParseInt(h, 10, 64)
+			}
+		case "#EXT-X-TARGETDURATION":
+			playlist.TargetDuration, _ = strconv.ParseFloat(value, 64)
+		case "#EXT-X-MEDIA-SEQUENCE":
+			playlist.MediaSequence, _ = strconv.ParseInt(value, 10, 64)
+		case "#EXT-X-ENDLIST":
+			playlist.EndList = true
+		case "#EXT-X-KEY":
+			attrs := parseAttributes(value)
+			if attrs["METHOD"] == "NONE" {
+				key = nil
+				continue
+			}
+			key = &Key{Method: attrs["METHOD"]}
+			if key.Uri, err = resolve(attrs["URI"]); err != nil {
+				return nil, err
+			}
+			if iv := attrs["IV"]; len(iv) > 0 {
+				iv = strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X")
+				if key.IV, err = hex.DecodeString(iv); err != nil || len(key.IV) != 16 {
+					return nil, fmt.Errorf("%w: bad key iv %q", ErrInvalidPlaylist, attrs["IV"])
+				}
+			}
+		case "#EXT-X-MAP":
+			attrs := parseAttributes(value)
+			segmentMap = &Map{}
+			if segmentMap.Uri, err = resolve(attrs["URI"]); err != nil {
+				return nil, err
+			}
+			if byteRange := attrs["BYTERANGE"]; len(byteRange) > 0 {
+				if segmentMap.Length, segmentMap.Offset, err = parseByteRange(byteRange, 0); err != nil {
+					return nil, err
+				}
+			}
+		case "#EXTINF":
+			durationStr, _, _ := strings.Cut(value, ",")
+			segment = &Segment{Key: key, Map: segmentMap}
+			segment.Duration, _ = strconv.ParseFloat(durationStr, 64)
+		case "#EXT-X-BYTERANGE":
+			if segment == nil {
+				segment = &Segment{Key: key, Map: segmentMap}
+			}
+			if segment.Length, segment.Offset, err = parseByteRange(value, nextOffset); err != nil {
+				return nil, err
+			}
+		default:
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			uri, err := resolve(line)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case variant != nil:
+				variant.Uri = uri
+				playlist.Variants = append(playlist.Variants, *variant)
+				variant = nil
+			case segment != nil:
+				segment.Uri = uri
+				segment.Sequence = playlist.MediaSequence + int64(len(playlist.Segments))
+				playlist.Segments = append(playlist.Segments, *segment)
+				nextOffset = segment.Offset + segment.Length
+				segment = nil
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(playlist.Variants) <= 0 && len(playlist.Segments) <= 0 {
+		return nil, fmt.Errorf("%w: no variant or segment", ErrInvalidPlaylist)
+	}
+
+	return playlist, nil
+}
+
+// parseByteRange 解析 BYTERANGE: <length>[@<offset>], 未指定偏移时使用 defaultOffset
+func parseByteRange(value string, defaultOffset int64) (length, offset int64, err error) {
+	lengthStr, offsetStr, hasOffset := strings.Cut(value, "@")
+	if length, err = strconv.ParseInt(lengthStr, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("%w: bad byte range %q", ErrInvalidPlaylist, value)
+	}
+	offset = defaultOffset
+	if hasOffset {
+		if offset, err = strconv.ParseInt(offsetStr, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("%w: bad byte range %q", ErrInvalidPlaylist, value)
+		}
+	}
+	return length, offset, nil
+}
+
+// parseAttributes 解析标签属性列表, 如: BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+func parseAttributes(value string) map[string]string {
+	attrs := make(map[string]string)
+	for len(value) > 0 {
+		name, rest, ok := strings.Cut(value, "=")
+		if !ok {
+			break
+		}
+		name = strings.TrimSpace(name)
+
+		var attrValue string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				attrValue, rest = rest[1:], ""
+			} else {
+				attrValue, rest = rest[1:end+1], rest[end+2:]
+			}
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			attrValue, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[name] = strings.TrimSpace(attrValue)
+		value = rest
+	}
+	return attrs
+}
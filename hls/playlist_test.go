@@ -0,0 +1,147 @@
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testMaster = `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+360p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2"
+https://cdn.example.com/720p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080
+/1080p/index.m3u8
+`
+
+const testMedia = `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+#EXTINF:9.5,
+seg7.m4s
+#EXT-X-KEY:METHOD=AES-128,URI="../key.bin",IV=0x000102030405060708090a0b0c0d0e0f
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000@2000
+seg8.m4s
+#EXT-X-BYTERANGE:500
+seg8.m4s
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:3.2,title
+seg9.m4s
+#EXT-X-ENDLIST
+`
+
+func TestParse_master(t *testing.T) {
+	playlist, err := Parse([]byte(testMaster), "https://example.com/video/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !playlist.IsMaster() || len(playlist.Variants) != 3 {
+		t.Fatalf("variants = %+v, want 3", playlist.Variants)
+	}
+	wantUris := []string{
+		"https://example.com/video/360p/index.m3u8",
+		"https://cdn.example.com/720p/index.m3u8",
+		"https://example.com/1080p/index.m3u8",
+	}
+	for i, want := range wantUris {
+		if playlist.Variants[i].Uri != want {
+			t.Errorf("variant %d uri = %s, want %s", i, playlist.Variants[i].Uri, want)
+		}
+	}
+	if v := playlist.Variants[1]; v.Bandwidth != 2800000 || v.Width != 1280 || v.Height != 720 || v.Codecs != "avc1.4d401f,mp4a.40.2" {
+		t.Errorf("variant 1 = %+v", v)
+	}
+
+	tests := []struct {
+		maxHeight int64
+		want      int64
+	}{
+		{0, 1080},
+		{720, 720},
+		{1000, 720},
+		{240, 360},
+	}
+	for _, tt := range tests {
+		if got, _ := SelectVariant(playlist.Variants, tt.maxHeight); got.Height != tt.want {
+			t.Errorf("SelectVariant(%d) height = %d, want %d", tt.maxHeight, got.Height, tt.want)
+		}
+	}
+}
+
+func TestParse_media(t *testing.T) {
+	playlist, err := Parse([]byte(testMedia), "https://example.com/video/720p/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.IsMaster() || !playlist.IsFmp4() || !playlist.EndList || playlist.TargetDuration != 10 || playlist.MediaSequence != 7 {
+		t.Fatalf("playlist = %+v", playlist)
+	}
+	if len(playlist.Segments) != 4 {
+		t.Fatalf("segments = %d, want 4", len(playlist.Segments))
+	}
+
+	segments := playlist.Segments
+	if segments[0].Key != nil || segments[0].Sequence != 7 || segments[0].Duration != 9.5 {
+		t.Errorf("segment 0 = %+v", segments[0])
+	}
+	if m := segments[0].Map; m == nil || m.Uri != "https://example.com/video/720p/init.mp4" || m.Length != 720 || m.Offset != 0 {
+		t.Errorf("segment 0 map = %+v", m)
+	}
+	if k := segments[1].Key; k == nil || k.Uri != "https://example.com/video/key.bin" || len(k.IV) != 16 || k.IV[15] != 0x0f {
+		t.Errorf("segment 1 key = %+v", k)
+	}
+	if segments[1].Offset != 2000 || segments[1].Length != 1000 {
+		t.Errorf("segment 1 range = %d@%d, want 1000@2000", segments[1].Length, segments[1].Offset)
+	}
+	if segments[2].Offset != 3000 || segments[2].Length != 500 || segments[2].Key == nil {
+		t.Errorf("segment 2 = %+v", segments[2])
+	}
+	if segments[3].Key != nil || segments[3].Sequence != 10 {
+		t.Errorf("segment 3 = %+v", segments[3])
+	}
+}
+
+func TestParse_invalid(t *testing.T) {
+	for _, data := range []string{"", "<html></html>", "#EXTM3U\n#EXT-X-ENDLIST\n"} {
+		if _, err := Parse([]byte(data), "https://example.com/"); !errors.Is(err, ErrInvalidPlaylist) {
+			t.Errorf("Parse(%q) error = %v, want %v", data, err, ErrInvalidPlaylist)
+		}
+	}
+}
+
+func TestRewritePlaylist(t *testing.T) {
+	data, err := RewritePlaylist([]byte(testMedia), "https://example.com/video/720p/index.m3u8", func(uri string) string {
+		return "/proxy?u=" + uri
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`#EXT-X-MAP:URI="/proxy?u=https://example.com/video/720p/init.mp4",BYTERANGE="720@0"`,
+		`#EXT-X-KEY:METHOD=AES-128,URI="/proxy?u=https://example.com/video/key.bin",IV=0x000102030405060708090a0b0c0d0e0f`,
+		"\n/proxy?u=https://example.com/video/720p/seg9.m4s\n",
+		"#EXTINF:3.2,title\n",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("rewritten playlist missing %q:\n%s", want, data)
+		}
+	}
+
+	// 改写后仍是有效的播放列表, 分片数不变
+	playlist, err := Parse(data, "https://proxy.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range playlist.Segments {
+		if !strings.HasPrefix(segment.Uri, "https://proxy.example.com/proxy?u=") {
+			t.Errorf("segment uri = %s, want proxied", segment.Uri)
+		}
+	}
+	if len(playlist.Segments) != 4 {
+		t.Errorf("segments = %d, want 4", len(playlist.Segments))
+	}
+}
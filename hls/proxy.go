@@ -0,0 +1,147 @@
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// uriAttrTags 属性中带 URI 的标签, 代理时需改写
+var uriAttrTags = map[string]bool{
+	"#EXT-X-KEY":                true,
+	"#EXT-X-SESSION-KEY":        true,
+	"#EXT-X-MAP":                true,
+	"#EXT-X-MEDIA":              true,
+	"#EXT-X-I-FRAME-STREAM-INF": true,
+}
+
+// uriAttrRe 匹配标签中的 URI="..." 属性
+var uriAttrRe = regexp.MustCompile(`URI="([^"]*)"`)
+
+// RewritePlaylist 改写播放列表中的所有地址, 相对地址先根据 baseUrl 转换为绝对地址再传给 rewrite
+// 包括子播放列表、分片、密钥、初始化分片等, 其他内容保持不变
+func RewritePlaylist(data []byte, baseUrl string, rewrite func(uri string) string) ([]byte, error) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, fmt.Errorf("parse base url fail: %w", err)
+	}
+	resolve := func(uri string) string {
+		ref, err := url.Parse(uri)
+		if err != nil {
+			return uri
+		}
+		return rewrite(base.ResolveReference(ref).String())
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() || strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff")) != "#EXTM3U" {
+		return nil, fmt.Errorf("%w: missing #EXTM3U", ErrInvalidPlaylist)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case len(line) <= 0:
+		case strings.HasPrefix(line, "#"):
+			tag, _, _ := strings.Cut(line, ":")
+			if uriAttrTags[tag] {
+				line = uriAttrRe.ReplaceAllStringFunc(line, func(attr string) string {
+					uri := uriAttrRe.FindStringSubmatch(attr)[1]
+					return `URI="` + resolve(uri) + `"`
+				})
+			}
+		default:
+			line = resolve(line)
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// isPlaylist 根据 Content-Type 和内容开头判断是否为 m3u8 播放列表
+func isPlaylist(contentType string, head []byte) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.Contains(contentType, "mpegurl") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimPrefix(head, []byte("\ufeff")), []byte("#EXTM3U"))
+}
+
+// NewProxy 返回 HLS 代理
+// target 从请求中取出要代理的地址, 如校验签名令牌, 返回错误时响应 403
+// 播放列表中的地址会被 link 改写为代理链接, 浏览器播放时所有请求都经过代理, 以便携带 Referer 等请求头
+// 分片、密钥等其他内容原样转发
+func NewProxy(target func(r *http.Request) (string, error), link func(uri string) string, opts ...Option) http.Handler {
+	o := newOptions(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, err := target(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		targetUrl, err := url.Parse(target)
+		if err != nil || (targetUrl.Scheme != "http" && targetUrl.Scheme != "https") {
+			http.Error(w, "invalid url", http.StatusBadRequest)
+			return
+		}
+
+		req, err := o.newRequest(r.Context(), target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rangeHeader := r.Header.Get("Range"); len(rangeHeader) > 0 {
+			req.Header.Set("Range", rangeHeader)
+		}
+		res, err := o.httpClient.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+
+		body := bufio.NewReader(res.Body)
+		head, _ := body.Peek(len("\ufeff#EXTM3U"))
+		if res.StatusCode == http.StatusOK && isPlaylist(res.Header.Get("Content-Type"), head) {
+			data, err := io.ReadAll(io.LimitReader(body, maxPlaylistSize))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			// 重定向后的地址作为相对地址的基准
+			data, err = RewritePlaylist(data, res.Request.URL.String(), link)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Header().Set("Cache-Control", "no-cache")
+			_, _ = w.Write(data)
+			return
+		}
+
+		for _, key := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges"} {
+			if value := res.Header.Get(key); len(value) > 0 {
+				w.Header().Set(key, value)
+			}
+		}
+		w.WriteHeader(res.StatusCode)
+		if _, err = io.Copy(w, body); err != nil {
+			log.Printf("hls proxy %s fail: %v", target, err)
+		}
+	})
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wujunwei928/parse-video/config"
+	"github.com/wujunwei928/parse-video/downloader"
+	"github.com/wujunwei928/parse-video/jobs"
+	"github.com/wujunwei928/parse-video/parser"
+	"github.com/wujunwei928/parse-video/safehttp"
+)
+
+// 异步任务类型
+const (
+	jobTypeParse    = "parse"    // 解析视频信息
+	jobTypeDownload = "download" // 解析后下载视频到服务器
+)
+
+// downloadResult 下载任务的结果
+type downloadResult struct {
+	Info *parser.VideoParseInfo `json:"info"`
+	File string                 `json:"file"` // 下载文件的地址 /jobs/{id}/file
+	Size int64                  `json:"size"`
+}
+
+// newJobQueue 根据配置创建异步任务队列, 并注册解析和下载任务
+func newJobQueue(cfg config.JobsConfig) (*jobs.Queue, error) {
+	var store jobs.Store = jobs.NewMemoryStore()
+	if cfg.Store == "file" {
+		fileStore, err := jobs.NewFileStore(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+
+	queue := jobs.NewQueue(store,
+		jobs.WithWorkers(cfg.Workers),
+		jobs.WithMaxPending(cfg.MaxPending),
+		jobs.WithMaxAttempts(cfg.MaxAttempts),
+		jobs.WithRetryDelay(time.Duration(cfg.RetryDelay)),
+		jobs.WithRetryable(retryableJobError),
+		jobs.WithTtl(time.Duration(cfg.Ttl)),
+		jobs.WithOnExpire(func(job *jobs.Job) {
+			if job.Type == jobTypeDownload {
+				removeDownload(cfg.DownloadDir, job.Id)
+			}
+		}),
+	)
+	queue.Register(jobTypeParse, func(ctx context.Context, job *jobs.Job) (any, error) {
+		var item batchItem
+		if err := json.Unmarshal(job.Params, &item); err != nil {
+			return nil, err
+		}
+		return parseBatchItem(ctx, item)
+	})
+	queue.Register(jobTypeDownload, func(ctx context.Context, job *jobs.Job) (any, error) {
+		return downloadJob(ctx, cfg, job)
+	})
+	return queue, nil
+}
+
+// retryableJobError 网络错误, 被限流和超时的任务可以重试, 其他错误重试也不会成功
+func retryableJobError(err error) bool {
+	if errors.Is(err, safehttp.ErrForbiddenUrl) || errors.Is(err, safehttp.ErrForbiddenAddress) {
+		return false
+	}
+	if errors.Is(err, downloader.ErrRemoteChanged) {
+		return true
+	}
+	switch parseErrorKind(err) {
+	case "rate_limited", "network", "timeout":
+		return true
+	case "canceled":
+		return false
+	}
+	var netErr interface{ Timeout() bool }
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// downloadJob 解析视频后下载到 dir 目录, 文件名为任务id, m3u8 地址下载为 ts 文件
+// B站等 dash 视频流与音频流合并为 mp4; 其他视频支持断点续传, 重试时从上次中断的位置继续
+// 每个视频最多 cfg.MaxFileMB, 下载目录已超过 cfg.MaxDiskMB 时不再下载
+func downloadJob(ctx context.Context, cfg config.JobsConfig, job *jobs.Job) (*downloadResult, error) {
+	dir := cfg.DownloadDir
+	if cfg.MaxDiskMB > 0 {
+		used, err := dirSize(dir)
+		if err != nil {
+			return nil, err
+		}
+		if used >= int64(cfg.MaxDiskMB)<<20 {
+			return nil, errDownloadDirFull
+		}
+	}
+
+	var item batchItem
+	if err := json.Unmarshal(job.Params, &item); err != nil {
+		return nil, err
+	}
+	info, err := parseBatchItem(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.VideoUrl) <= 0 {
+		return nil, errors.New("no video url, images are not downloaded")
+	}
+	// 与 /video/stream 一样只能访问已注册渠道的资源域名; 只下载视频, 文件名为任务id
+	// m3u8 合并分片, dash 视频流与 MusicUrl 音频流合并, 其他视频支持断点续传
+	files, err := downloader.New(dir,
+		downloader.WithHttpClient(streamClient),
+		downloader.WithKinds(downloader.KindVideo),
+		downloader.WithTemplate(downloadTemplate),
+		downloader.WithMaxSize(int64(cfg.MaxFileMB)<<20),
+	).Download(ctx, info, downloader.Vars{"id": job.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	return &downloadResult{
+		Info: info,
+		File: "/jobs/" + job.Id + "/file",
+		Size: files[0].Size,
+	}, nil
+}
+
+// errDownloadDirFull 下载目录超过 jobs.max_disk_mb
+var errDownloadDirFull = errors.New("download dir is full, wait for expired jobs to be removed")
+
+// dirSize 目录中所有文件的总大小, 目录不存在时为0
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// downloadTemplate 下载任务的文件名为任务id, 扩展名由视频格式决定
+var downloadTemplate = downloader.MustParseTemplate("{id}.{ext}")
+
+// downloadPath 返回下载任务的文件路径, 不包括未下载完成的文件
+func downloadPath(dir, jobId string) (string, bool) {
+	matches, _ := filepath.Glob(filepath.Join(dir, jobId+".*"))
+	for _, path := range matches {
+		if strings.Count(filepath.Base(path), ".") == 1 {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// removeDownload 删除下载任务的文件, 包括未下载完成的文件和 dash 合并前的视频流、音频流
+func removeDownload(dir, jobId string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, jobId+".*"))
+	for _, path := range matches {
+		_ = os.Remove(path)
+	}
+}
+
+// jobRequest POST /jobs 请求体
+type jobRequest struct {
+	Type   string    `json:"type"`   // parse 或 download
+	Params batchItem `json:"params"` // 分享文本, 或渠道和视频id, 格式同 /video/batch 的一项
+}
+
+// registerJobRoutes 注册异步任务接口
+// POST /jobs 提交任务, GET /jobs/{id} 查询任务状态和结果, GET /jobs/{id}/file 获取下载任务的文件
+func registerJobRoutes(r gin.IRouter, queue *jobs.Queue, downloadDir string) {
+	r.POST("/jobs", func(c *gin.Context) {
+		var req jobRequest
+		if err := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, 1<<16)).Decode(&req); err != nil {
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  "请求格式错误: " + err.Error(),
+			})
+			return
+		}
+		if req.Type != jobTypeParse && req.Type != jobTypeDownload {
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  fmt.Sprintf("任务类型错误 %q, 需要 parse 或 download", req.Type),
+			})
+			return
+		}
+		if len(req.Params.ShareText) <= 0 && (len(req.Params.Source) <= 0 || len(req.Params.VideoId) <= 0) {
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  "需要分享文本, 或渠道和视频id",
+			})
+			return
+		}
+
+		job, err := queue.Submit(req.Type, req.Params)
+		if errors.Is(err, jobs.ErrQueueFull) {
+			c.JSON(http.StatusTooManyRequests, HttpResponse{
+				Code: 429,
+				Msg:  "未完成的任务过多, 请稍后再试",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, HttpResponse{
+				Code: 500,
+				Msg:  "提交任务失败: " + err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, HttpResponse{
+			Code: 202,
+			Msg:  "已提交",
+			Data: job,
+		})
+	})
+
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		job, err := queue.Get(c.Param("id"))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, jobs.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, HttpResponse{
+				Code: status,
+				Msg:  err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, HttpResponse{
+			Code: 200,
+			Msg:  string(job.Status),
+			Data: job,
+		})
+	})
+
+	r.GET("/jobs/:id/file", func(c *gin.Context) {
+		job, err := queue.Get(c.Param("id"))
+		if err != nil || job.Type != jobTypeDownload || job.Status != jobs.StatusSucceeded {
+			c.JSON(http.StatusNotFound, HttpResponse{
+				Code: 404,
+				Msg:  "任务不存在或未下载完成",
+			})
+			return
+		}
+		if path, ok := downloadPath(downloadDir, job.Id); ok {
+			c.FileAttachment(path, "video"+filepath.Ext(path))
+			return
+		}
+		c.JSON(http.StatusNotFound, HttpResponse{
+			Code: 404,
+			Msg:  "文件已删除",
+		})
+	})
+}
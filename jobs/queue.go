@@ -0,0 +1,426 @@
+// Package jobs 异步任务队列: 提交任务后立即返回任务id, 由后台 worker 执行, 失败时按退避时间重试
+// 任务保存在可替换的 Store 中, 使用 FileStore 时重启后继续执行未完成的任务
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull 未结束的任务数已达到 WithMaxPending 设置的上限
+var ErrQueueFull = errors.New("job queue is full")
+
+// Status 任务状态
+type Status string
+
+const (
+	StatusQueued    Status = "queued"    // 等待执行, 包括等待重试
+	StatusRunning   Status = "running"   // 执行中
+	StatusSucceeded Status = "succeeded" // 执行成功
+	StatusFailed    Status = "failed"    // 执行失败, 且不再重试
+)
+
+// Job 任务
+type Job struct {
+	Id          string          `json:"id"`
+	Type        string          `json:"type"`             // 任务类型, 对应 Queue.Register 注册的 Handler
+	Params      json.RawMessage `json:"params,omitempty"` // 任务参数, 由 Handler 解析
+	Status      Status          `json:"status"`
+	Attempts    int             `json:"attempts"`         // 已执行的次数
+	MaxAttempts int             `json:"max_attempts"`     // 最多执行的次数, 包括第一次
+	Error       string          `json:"error,omitempty"`  // 最近一次执行失败的错误
+	Result      json.RawMessage `json:"result,omitempty"` // 执行成功的结果
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	RunAt       time.Time       `json:"run_at"` // 等待执行时, 最早的执行时间
+}
+
+// clone 复制任务
+func (j *Job) clone() *Job {
+	c := *j
+	return &c
+}
+
+// Finished 任务是否已结束, 不会再执行
+func (j *Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Handler 执行任务, 返回的结果会序列化为 JSON 保存在 Job.Result 中
+// 返回错误时, 如果可以重试且未达到最多执行次数, 会在退避时间后重试
+type Handler func(ctx context.Context, job *Job) (any, error)
+
+// Option Queue 配置项
+type Option func(q *Queue)
+
+// WithWorkers 同时执行的任务数, 默认4
+func WithWorkers(workers int) Option {
+	return func(q *Queue) {
+		q.workers = workers
+	}
+}
+
+// WithMaxAttempts 每个任务最多执行的次数, 包括第一次, 默认3
+func WithMaxAttempts(maxAttempts int) Option {
+	return func(q *Queue) {
+		q.maxAttempts = maxAttempts
+	}
+}
+
+// WithRetryDelay 第一次重试前等待的时间, 之后每次翻倍, 默认5秒
+func WithRetryDelay(delay time.Duration) Option {
+	return func(q *Queue) {
+		q.retryDelay = delay
+	}
+}
+
+// WithRetryable 判断错误是否可以重试, 默认所有错误都重试
+func WithRetryable(retryable func(err error) bool) Option {
+	return func(q *Queue) {
+		q.retryable = retryable
+	}
+}
+
+// WithTtl 结束的任务保留的时间, 之后自动删除, 0 表示不删除
+func WithTtl(ttl time.Duration) Option {
+	return func(q *Queue) {
+		q.ttl = ttl
+	}
+}
+
+// WithMaxPending 未结束(等待执行、执行中、等待重试)的任务最多 maxPending 个, 超过时 Submit 返回 ErrQueueFull, 默认不限制
+func WithMaxPending(maxPending int) Option {
+	return func(q *Queue) {
+		q.maxPending = maxPending
+	}
+}
+
+// WithOnExpire 结束的任务超过 ttl 被删除后调用, 用于清理任务产生的文件等
+func WithOnExpire(onExpire func(job *Job)) Option {
+	return func(q *Queue) {
+		q.onExpire = onExpire
+	}
+}
+
+// Queue 任务队列
+type Queue struct {
+	store       Store
+	workers     int
+	maxAttempts int
+	retryDelay  time.Duration
+	retryable   func(err error) bool
+	ttl         time.Duration
+	maxPending  int
+	onExpire    func(job *Job)
+	handlers    map[string]Handler
+	now         func() time.Time
+
+	mu         sync.Mutex
+	ready      []string        // 等待执行的任务id
+	pending    map[string]bool // ready 中的任务id, 避免同一任务重复加入
+	wake       chan struct{}   // 有新任务时通知 worker
+	unfinished int             // 未结束的任务数
+}
+
+// NewQueue 创建任务队列, 调用 Register 注册任务类型后, 调用 Run 开始执行
+func NewQueue(store Store, opts ...Option) *Queue {
+	q := &Queue{
+		store:       store,
+		workers:     4,
+		maxAttempts: 3,
+		retryDelay:  5 * time.Second,
+		retryable:   func(error) bool { return true },
+		handlers:    make(map[string]Handler),
+		now:         time.Now,
+		pending:     make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	q.workers = max(q.workers, 1)
+	q.maxAttempts = max(q.maxAttempts, 1)
+	return q
+}
+
+// Register 注册任务类型, 需在 Run 之前调用
+func (q *Queue) Register(jobType string, handler Handler) {
+	q.handlers[jobType] = handler
+}
+
+// Submit 提交任务, params 序列化为 JSON 保存在 Job.Params 中
+// 未结束的任务数已达到 WithMaxPending 设置的上限时返回 ErrQueueFull
+func (q *Queue) Submit(jobType string, params any) (*Job, error) {
+	if _, ok := q.handlers[jobType]; !ok {
+		return nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("marshal job params: %w", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return nil, err
+	}
+	now := q.now()
+	job := &Job{
+		Id:          hex.EncodeToString(id),
+		Type:        jobType,
+		Params:      data,
+		Status:      StatusQueued,
+		MaxAttempts: q.maxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		RunAt:       now,
+	}
+	if !q.addUnfinished(1) {
+		return nil, ErrQueueFull
+	}
+	if err = q.store.Put(job); err != nil {
+		q.addUnfinished(-1)
+		return nil, err
+	}
+	q.enqueue(job.Id)
+	return job, nil
+}
+
+// Get 获取任务, 不存在时返回 ErrNotFound
+func (q *Queue) Get(id string) (*Job, error) {
+	return q.store.Get(id)
+}
+
+// Run 恢复未完成的任务, 并启动 worker 执行任务, ctx 取消后等待执行中的任务结束后返回
+// 因 ctx 取消而中断的任务不计入执行次数, 下次 Run 时重新执行
+func (q *Queue) Run(ctx context.Context) error {
+	jobs, err := q.store.List()
+	if err != nil {
+		return err
+	}
+	unfinished := 0
+	for _, job := range jobs {
+		switch job.Status {
+		case StatusQueued, StatusRunning:
+			// 上次退出时未执行完的任务
+			unfinished++
+			job.Status = StatusQueued
+			if err = q.store.Put(job); err != nil {
+				return err
+			}
+			q.schedule(ctx, job.Id, job.RunAt.Sub(q.now()))
+		}
+	}
+	// worker 还未启动, 存储中的未结束任务包括 Run 之前提交的任务
+	q.mu.Lock()
+	q.unfinished = unfinished
+	q.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	if q.ttl > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.cleanup(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// addUnfinished 增加未结束的任务数, 增加后超过 WithMaxPending 设置的上限时不增加, 返回 false
+func (q *Queue) addUnfinished(n int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > 0 && q.maxPending > 0 && q.unfinished+n > q.maxPending {
+		return false
+	}
+	q.unfinished += n
+	return true
+}
+
+// enqueue 任务加入等待执行的列表
+func (q *Queue) enqueue(id string) {
+	q.mu.Lock()
+	if !q.pending[id] {
+		q.pending[id] = true
+		q.ready = append(q.ready, id)
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule delay 后将任务加入等待执行的列表, ctx 取消后不再加入
+func (q *Queue) schedule(ctx context.Context, id string, delay time.Duration) {
+	if delay <= 0 {
+		q.enqueue(id)
+		return
+	}
+	timer := time.AfterFunc(delay, func() {
+		if ctx.Err() == nil {
+			q.enqueue(id)
+		}
+	})
+	context.AfterFunc(ctx, func() { timer.Stop() })
+}
+
+// next 取出一个等待执行的任务id
+func (q *Queue) next() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.ready) <= 0 {
+		return "", false
+	}
+	id := q.ready[0]
+	q.ready = q.ready[1:]
+	delete(q.pending, id)
+	return id, true
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		id, ok := q.next()
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		// 可能还有其他等待的任务, 唤醒其他 worker
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+		if err := q.execute(ctx, id); err != nil {
+			log.Printf("执行任务 %s 失败: %v", id, err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// execute 执行一次任务并保存结果, 返回的错误为存储错误
+func (q *Queue) execute(ctx context.Context, id string) error {
+	job, err := q.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.Status != StatusQueued {
+		return nil
+	}
+	handler, ok := q.handlers[job.Type]
+	if !ok {
+		return q.finish(job, nil, fmt.Errorf("unknown job type %q", job.Type))
+	}
+
+	job.Status = StatusRunning
+	job.Attempts++
+	job.UpdatedAt = q.now()
+	if err = q.store.Put(job); err != nil {
+		return err
+	}
+
+	result, runErr := q.run(ctx, handler, job)
+	if runErr != nil && ctx.Err() != nil {
+		// 服务退出导致的中断, 下次启动后重新执行
+		job.Status = StatusQueued
+		job.Attempts--
+		job.UpdatedAt = q.now()
+		return q.store.Put(job)
+	}
+	if runErr != nil && job.Attempts < job.MaxAttempts && q.retryable(runErr) {
+		delay := q.retryDelay << (job.Attempts - 1)
+		job.Status = StatusQueued
+		job.Error = runErr.Error()
+		job.UpdatedAt = q.now()
+		job.RunAt = job.UpdatedAt.Add(delay)
+		if err = q.store.Put(job); err != nil {
+			return err
+		}
+		q.schedule(ctx, job.Id, delay)
+		return nil
+	}
+	return q.finish(job, result, runErr)
+}
+
+// run 调用 Handler, handler panic 时返回错误
+func (q *Queue) run(ctx context.Context, handler Handler, job *Job) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panic: %v", r)
+		}
+	}()
+	return handler(ctx, job.clone())
+}
+
+// finish 保存任务的最终状态
+func (q *Queue) finish(job *Job, result any, runErr error) error {
+	q.addUnfinished(-1)
+	job.UpdatedAt = q.now()
+	if runErr != nil {
+		job.Status = StatusFailed
+		job.Error = runErr.Error()
+		return q.store.Put(job)
+	}
+
+	job.Status = StatusSucceeded
+	job.Error = ""
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = fmt.Sprintf("marshal job result: %v", err)
+		}
+		job.Result = data
+	}
+	return q.store.Put(job)
+}
+
+// cleanup 定期删除结束超过 ttl 的任务
+func (q *Queue) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(min(q.ttl, time.Hour))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		jobs, err := q.store.List()
+		if err != nil {
+			log.Printf("清理任务失败: %v", err)
+			continue
+		}
+		for _, job := range jobs {
+			if job.Finished() && q.now().Sub(job.UpdatedAt) > q.ttl {
+				if err = q.store.Delete(job.Id); err != nil {
+					log.Printf("删除任务 %s 失败: %v", job.Id, err)
+					continue
+				}
+				if q.onExpire != nil {
+					q.onExpire(job)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFinished 等待任务结束
+func waitFinished(t *testing.T, q *Queue, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Finished() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s not finished, status = %s", id, job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startQueue 在后台运行队列, 返回停止并等待队列退出的方法
+func startQueue(q *Queue) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = q.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestQueue(t *testing.T) {
+	var calls atomic.Int32
+	errTemporary, errPermanent := errors.New("temporary"), errors.New("permanent")
+	q := NewQueue(NewMemoryStore(),
+		WithRetryDelay(time.Millisecond),
+		WithRetryable(func(err error) bool { return errors.Is(err, errTemporary) }),
+	)
+	q.Register("echo", func(ctx context.Context, job *Job) (any, error) {
+		return map[string]string{"params": string(job.Params)}, nil
+	})
+	q.Register("flaky", func(ctx context.Context, job *Job) (any, error) {
+		if calls.Add(1) < 3 {
+			return nil, errTemporary
+		}
+		return "ok", nil
+	})
+	q.Register("broken", func(ctx context.Context, job *Job) (any, error) {
+		return nil, errPermanent
+	})
+	q.Register("panic", func(ctx context.Context, job *Job) (any, error) {
+		panic("boom")
+	})
+	stop := startQueue(q)
+	defer stop()
+
+	if _, err := q.Submit("nope", nil); err == nil {
+		t.Errorf("Submit unknown job type should fail")
+	}
+
+	for _, tt := range []struct {
+		jobType  string
+		status   Status
+		attempts int
+		result   string
+		err      string
+	}{
+		{jobType: "echo", status: StatusSucceeded, attempts: 1, result: `{"params":"{\"a\":1}"}`},
+		{jobType: "flaky", status: StatusSucceeded, attempts: 3, result: `"ok"`},
+		{jobType: "broken", status: StatusFailed, attempts: 1, err: "permanent"},
+		{jobType: "panic", status: StatusFailed, attempts: 1, err: "job panic: boom"},
+	} {
+		t.Run(tt.jobType, func(t *testing.T) {
+			job, err := q.Submit(tt.jobType, map[string]int{"a": 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			job = waitFinished(t, q, job.Id)
+			if job.Status != tt.status || job.Attempts != tt.attempts || string(job.Result) != tt.result || job.Error != tt.err {
+				t.Errorf("job = %s attempts %d result %s error %q, want %s attempts %d result %s error %q",
+					job.Status, job.Attempts, job.Result, job.Error, tt.status, tt.attempts, tt.result, tt.err)
+			}
+		})
+	}
+}
+
+func TestQueue_restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次运行: 任务执行到一半时退出
+	started := make(chan struct{})
+	q := NewQueue(store)
+	q.Register("slow", func(ctx context.Context, job *Job) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	stop := startQueue(q)
+	job, err := q.Submit("slow", "params")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	stop()
+
+	// 重启后从文件恢复并继续执行, 中断的那次不计入执行次数
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q = NewQueue(store)
+	q.Register("slow", func(ctx context.Context, job *Job) (any, error) {
+		return string(job.Params), nil
+	})
+	stop = startQueue(q)
+	defer stop()
+	job = waitFinished(t, q, job.Id)
+	if job.Status != StatusSucceeded || job.Attempts != 1 || string(job.Result) != `"\"params\""` {
+		t.Errorf("job after restart = %s attempts %d result %s", job.Status, job.Attempts, job.Result)
+	}
+}
+
+func TestQueue_ttl(t *testing.T) {
+	expired := make(chan string, 1)
+	q := NewQueue(NewMemoryStore(), WithTtl(20*time.Millisecond), WithOnExpire(func(job *Job) { expired <- job.Id }))
+	q.Register("echo", func(ctx context.Context, job *Job) (any, error) {
+		return nil, nil
+	})
+	stop := startQueue(q)
+	defer stop()
+
+	job, err := q.Submit("echo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFinished(t, q, job.Id)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err = q.Get(job.Id); errors.Is(err, ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("finished job not deleted after ttl, err = %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if id := <-expired; id != job.Id {
+		t.Errorf("expired job = %s, want %s", id, job.Id)
+	}
+}
+
+func TestQueue_maxPending(t *testing.T) {
+	q := NewQueue(NewMemoryStore(), WithMaxPending(2))
+	q.Register("echo", func(ctx context.Context, job *Job) (any, error) {
+		return nil, nil
+	})
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		job, err := q.Submit("echo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.Id)
+	}
+	if _, err := q.Submit("echo", nil); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Submit over limit error = %v, want ErrQueueFull", err)
+	}
+
+	stop := startQueue(q)
+	defer stop()
+	for _, id := range ids {
+		waitFinished(t, q, id)
+	}
+	if _, err := q.Submit("echo", nil); err != nil {
+		t.Errorf("Submit after jobs finished error = %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotFound 任务不存在
+var ErrNotFound = errors.New("job not found")
+
+// Store 任务存储, 实现需要并发安全; Put 和 Get 需要复制任务, 调用方修改返回的任务不影响存储中的任务
+type Store interface {
+	Put(job *Job) error          // 新建或更新任务
+	Get(id string) (*Job, error) // 获取任务, 不存在时返回 ErrNotFound
+	List() ([]*Job, error)       // 所有任务, 用于重启后恢复未完成的任务和清理过期任务
+	Delete(id string) error      // 删除任务, 不存在时不返回错误
+}
+
+// MemoryStore 保存在内存中的任务存储, 重启后丢失
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// NewMemoryStore 创建内存任务存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]*Job)}
+}
+
+func (s *MemoryStore) Put(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.Id] = job.clone()
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return job.clone(), nil
+}
+
+func (s *MemoryStore) List() ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.clone())
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return nil
+}
+
+// compactMinRecords 日志记录数不少于该值, 且超过任务数的2倍时压缩日志
+const compactMinRecords = 64
+
+// logRecord FileStore 日志中的一条记录, 每行一条 JSON
+type logRecord struct {
+	Put    *Job   `json:"put,omitempty"`    // 新建或更新任务
+	Delete string `json:"delete,omitempty"` // 删除任务的id
+}
+
+// FileStore 保存在文件中的任务存储, 重启后恢复
+// 所有任务保存在内存中, 每次修改只在文件末尾追加一行记录, 写入耗时与任务总数无关;
+// 记录数远多于任务数时, 将当前任务写入临时文件再重命名, 压缩日志, 写入过程中进程退出也不会损坏原文件
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	memory  *MemoryStore
+	file    *os.File
+	records int // 文件中的记录数
+}
+
+// NewFileStore 创建文件任务存储, 文件不存在时自动创建
+// 兼容旧版本保存的 JSON 数组; 进程退出时未写完的最后一行会被忽略
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, memory: NewMemoryStore()}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read job store: %w", err)
+	}
+	if err = s.load(data); err != nil {
+		return nil, fmt.Errorf("parse job store %s: %w", path, err)
+	}
+	// 打开时压缩一次, 去掉已删除的任务和未写完的记录
+	if err = s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load 从文件内容恢复任务, 跳过为 null 的任务
+func (s *FileStore) load(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var jobs []*Job
+		if err := json.Unmarshal(data, &jobs); err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if job != nil {
+				s.memory.jobs[job.Id] = job
+			}
+		}
+		return nil
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) <= 0 {
+			continue
+		}
+		var record logRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			if i == len(lines)-1 {
+				// 追加最后一条记录时进程退出
+				break
+			}
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch {
+		case record.Put != nil:
+			s.memory.jobs[record.Put.Id] = record.Put
+		case len(record.Delete) > 0:
+			delete(s.memory.jobs, record.Delete)
+		}
+	}
+	return nil
+}
+
+func (s *FileStore) Put(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(logRecord{Put: job}); err != nil {
+		return err
+	}
+	_ = s.memory.Put(job)
+	return s.compactIfNeeded()
+}
+
+func (s *FileStore) Get(id string) (*Job, error) {
+	return s.memory.Get(id)
+}
+
+func (s *FileStore) List() ([]*Job, error) {
+	return s.memory.List()
+}
+
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(logRecord{Delete: id}); err != nil {
+		return err
+	}
+	_ = s.memory.Delete(id)
+	return s.compactIfNeeded()
+}
+
+// Close 关闭文件, 之后不能再修改任务
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// append 在文件末尾追加一条记录, 写入成功后调用方才能修改内存中的任务, 调用方需持有锁
+func (s *FileStore) append(record logRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = s.file.Write(append(data, '\n')); err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("save job store: %w", err)
+	}
+	s.records++
+	return nil
+}
+
+// compactIfNeeded 记录过多时压缩日志, 调用方需持有锁
+func (s *FileStore) compactIfNeeded() error {
+	if s.records >= compactMinRecords && s.records > 2*len(s.memory.jobs) {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact 将当前所有任务写入临时文件再重命名替换日志, 调用方需持有锁
+func (s *FileStore) compact() error {
+	var buf bytes.Buffer
+	for _, job := range s.memory.jobs {
+		data, err := json.Marshal(logRecord{Put: job})
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save job store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(buf.Bytes()); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("save job store: %w", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open job store: %w", err)
+	}
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file, s.records = file, len(s.memory.jobs)
+	return nil
+}
@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing job error = %v, want ErrNotFound", err)
+	}
+
+	job := &Job{Id: "a", Type: "parse", Status: StatusQueued}
+	if err = store.Put(job); err != nil {
+		t.Fatal(err)
+	}
+	// 修改传入的任务不影响存储
+	job.Status = StatusFailed
+	if err = store.Put(&Job{Id: "b", Type: "parse", Status: StatusSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Id != "a" || jobs[0].Status != StatusQueued {
+		t.Errorf("jobs after reopen = %+v", jobs)
+	}
+
+	_ = store.Close()
+	_ = reopened.Close()
+
+	// 写入文件失败时不修改内存中的任务
+	if err = store.Put(&Job{Id: "c", Type: "parse", Status: StatusQueued}); err == nil {
+		t.Errorf("Put after Close should fail")
+	}
+	if _, err = store.Get("c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get job failed to save error = %v, want ErrNotFound", err)
+	}
+	if err = store.Delete("a"); err == nil {
+		t.Errorf("Delete after Close should fail")
+	}
+	if _, err = store.Get("a"); err != nil {
+		t.Errorf("Get job failed to delete error = %v", err)
+	}
+
+	if err = os.WriteFile(path, []byte("{broken\n{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewFileStore(path); err == nil {
+		t.Errorf("NewFileStore with broken file should fail")
+	}
+}
+
+func TestFileStore_load(t *testing.T) {
+	for _, tt := range []struct {
+		name, data string
+		want       []string
+	}{
+		{name: "legacy array with null", data: `[{"id": "a"}, null, {"id": "b"}]`, want: []string{"a", "b"}},
+		{name: "truncated last record", data: `{"put": {"id": "a"}}` + "\n" + `{"put": {"id": "b"`, want: []string{"a"}},
+		{name: "deleted", data: `{"put": {"id": "a"}}` + "\n" + `{"put": {"id": "b"}}` + "\n" + `{"delete": "a"}` + "\n", want: []string{"b"}},
+	} {
+		path := filepath.Join(t.TempDir(), "jobs.json")
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		store, err := NewFileStore(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		jobs, _ := store.List()
+		var ids []string
+		for _, job := range jobs {
+			ids = append(ids, job.Id)
+		}
+		sort.Strings(ids)
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: jobs = %v, want %v", tt.name, ids, tt.want)
+		}
+		_ = store.Close()
+	}
+}
+
+func TestFileStore_compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for i := 0; i < 10*compactMinRecords; i++ {
+		if err = store.Put(&Job{Id: "a", Status: StatusRunning, Attempts: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines >= compactMinRecords {
+		t.Errorf("log has %d records after compaction, want < %d", lines, compactMinRecords)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if job, err := reopened.Get("a"); err != nil || job.Attempts != 10*compactMinRecords-1 {
+		t.Errorf("job after reopen = %+v, %v", job, err)
+	}
+}
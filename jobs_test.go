@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wujunwei928/parse-video/config"
+	"github.com/wujunwei928/parse-video/jobs"
+	"github.com/wujunwei928/parse-video/parser"
+)
+
+func TestJobRoutes(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	const source = "jobs_test"
+	if err := parser.Register(source, parser.SourceInfo{VideoIdParser: fakeIdParser{&running, &maxRunning}}); err != nil {
+		t.Fatal(err)
+	}
+	defer parser.Unregister(source)
+
+	queue, err := newJobQueue(config.JobsConfig{Store: "memory", Workers: 2, MaxAttempts: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = queue.Run(ctx) }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerJobRoutes(r, queue, t.TempDir())
+	do := func(method, path, body string) (int, *jobs.Job) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var res struct {
+			HttpResponse
+			Data *jobs.Job `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("response %s: %v", w.Body.String(), err)
+		}
+		return w.Code, res.Data
+	}
+
+	for _, body := range []string{
+		`{"type": "convert", "params": "share"}`,
+		`{"type": "parse"}`,
+		`{"type": "parse", "params": {"source": "jobs_test"}}`,
+		`not json`,
+	} {
+		if status, _ := do(http.MethodPost, "/jobs", body); status != http.StatusBadRequest {
+			t.Errorf("POST /jobs %s status = %d, want 400", body, status)
+		}
+	}
+	if status, _ := do(http.MethodGet, "/jobs/unknown", ""); status != http.StatusNotFound {
+		t.Errorf("GET unknown job status = %d, want 404", status)
+	}
+
+	for _, tt := range []struct {
+		videoId string
+		status  jobs.Status
+		result  string
+	}{
+		{videoId: "1", status: jobs.StatusSucceeded, result: "title 1"},
+		{videoId: "missing", status: jobs.StatusFailed},
+	} {
+		status, job := do(http.MethodPost, "/jobs", `{"type": "parse", "params": {"source": "jobs_test", "video_id": "`+tt.videoId+`"}}`)
+		if status != http.StatusAccepted || job == nil || job.Status != jobs.StatusQueued {
+			t.Fatalf("POST /jobs status = %d, job = %+v", status, job)
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for !job.Finished() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+			_, job = do(http.MethodGet, "/jobs/"+job.Id, "")
+		}
+		if job.Status != tt.status {
+			t.Fatalf("job %s status = %s, want %s, error %q", tt.videoId, job.Status, tt.status, job.Error)
+		}
+		// 视频不存在不重试
+		if job.Attempts != 1 {
+			t.Errorf("job %s attempts = %d, want 1", tt.videoId, job.Attempts)
+		}
+		if len(tt.result) > 0 {
+			var info parser.VideoParseInfo
+			if err := json.Unmarshal(job.Result, &info); err != nil || info.Title != tt.result {
+				t.Errorf("job %s result = %s, want title %q", tt.videoId, job.Result, tt.result)
+			}
+		}
+		if status, _ := do(http.MethodGet, "/jobs/"+job.Id+"/file", ""); status != http.StatusNotFound {
+			t.Errorf("GET parse job file status = %d, want 404", status)
+		}
+	}
+}
+
+func TestDownloadPath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"abc.mp4.video.m4s", "abc.mp4.part", "abc.mp4.part.json", "abcd.mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if path, ok := downloadPath(dir, "abc"); ok {
+		t.Errorf("downloadPath with unfinished files = %s", path)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "abc.mp4"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path, ok := downloadPath(dir, "abc"); !ok || filepath.Base(path) != "abc.mp4" {
+		t.Errorf("downloadPath = %s, %v, want abc.mp4", path, ok)
+	}
+
+	removeDownload(dir, "abc")
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "abcd.mp4" {
+		t.Errorf("files after removeDownload = %v, want only abcd.mp4", entries)
+	}
+}
+
+func TestJobRoutes_maxPending(t *testing.T) {
+	queue, err := newJobQueue(config.JobsConfig{Store: "memory", Workers: 1, MaxAttempts: 1, MaxPending: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	registerJobRoutes(r, queue, t.TempDir())
+
+	// 队列未运行, 第一个任务一直未结束
+	for _, status := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(`{"type": "parse", "params": "share"}`)))
+		if w.Code != status {
+			t.Errorf("POST /jobs status = %d, want %d: %s", w.Code, status, w.Body.String())
+		}
+	}
+}
+
+func TestRetryableJobError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{err: &parser.ParseError{Kind: parser.ErrNetwork}, want: true},
+		{err: &parser.ParseError{Kind: parser.ErrVideoNotFound}, want: false},
+		{err: &url.Error{Op: "Get", URL: "https://example.com", Err: context.DeadlineExceeded}, want: true},
+		{err: &url.Error{Op: "Get", URL: "https://example.com", Err: context.Canceled}, want: false},
+		{err: &parser.ParseError{Err: &url.Error{Op: "Get", URL: "https://example.com", Err: context.Canceled}}, want: false},
+	} {
+		if got := retryableJobError(tt.err); got != tt.want {
+			t.Errorf("retryableJobError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
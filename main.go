@@ -2,21 +2,35 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/wujunwei928/parse-video/config"
+	"github.com/wujunwei928/parse-video/dash"
+	"github.com/wujunwei928/parse-video/hls"
 	"github.com/wujunwei928/parse-video/parser"
+	"github.com/wujunwei928/parse-video/safehttp"
+	"github.com/wujunwei928/parse-video/streamtoken"
+	"github.com/wujunwei928/parse-video/tlscert"
 )
 
 type HttpResponse struct {
@@ -25,11 +39,313 @@ type HttpResponse struct {
 	Data interface{} `json:"data"`
 }
 
+// parseErrorStatus 根据解析错误分类返回对应的http状态码
+func parseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, parser.ErrUnsupportedSource), errors.Is(err, parser.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, parser.ErrVideoNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, parser.ErrVideoPrivate):
+		return http.StatusForbidden
+	case errors.Is(err, parser.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		// 网络错误, 上游页面结构变化及其他未分类的上游错误
+		return http.StatusBadGateway
+	}
+}
+
+// streamClient 代理视频资源使用的客户端, 只能访问已注册渠道的资源域名, 且不能访问内网地址
+var streamClient = safehttp.NewClient(mediaHostAllowed)
+
+// streamForwardHeaders /video/stream 转发给视频源的客户端请求头
+var streamForwardHeaders = []string{
+	"Range", "If-Range", "If-None-Match", "If-Modified-Since",
+	"Accept", "Accept-Encoding", "Accept-Language", "User-Agent",
+}
+
+// streamSigner /video/stream 令牌签名, 在 main 中初始化
+var streamSigner *streamtoken.Signer
+
+// applyConfig 根据配置初始化令牌签名、默认解析客户端、启用的渠道和渠道的速率限制
+func applyConfig(cfg *config.Config) error {
+	key := []byte(cfg.Stream.Secret)
+	if len(key) <= 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		log.Println("未设置 stream.secret, 使用随机密钥, 重启后代理链接失效")
+	}
+	signer, err := streamtoken.NewSigner(key, time.Duration(cfg.Stream.Ttl))
+	if err != nil {
+		return err
+	}
+	streamSigner = signer
+
+	opts := []parser.ClientOption{parser.WithBatchConcurrency(cfg.Batch.Concurrency)}
+	if len(cfg.Proxy.Url) > 0 {
+		opts = append(opts, parser.WithProxy(cfg.Proxy.Url))
+	}
+	if cfg.Timeouts.Parse > 0 {
+		opts = append(opts, parser.WithTimeout(time.Duration(cfg.Timeouts.Parse)))
+	}
+	client, err := parser.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	parser.SetDefaultClient(client)
+
+	// 只启用部分渠道或禁用部分渠道
+	disabled := make(map[string]bool)
+	if len(cfg.Sources.Enabled) > 0 {
+		for _, item := range parser.Sources() {
+			disabled[item.Source] = true
+		}
+		for _, source := range cfg.Sources.Enabled {
+			delete(disabled, source)
+		}
+	}
+	for _, source := range cfg.Sources.Disabled {
+		disabled[source] = true
+	}
+	for source := range disabled {
+		parser.Unregister(source)
+	}
+
+	if cfg.Sources.RateLimit > 0 {
+		for _, item := range parser.Sources() {
+			parser.SetSourceRateLimit(item.Source, cfg.Sources.RateLimit, cfg.Sources.RateBurst)
+		}
+	}
+
+	return nil
+}
+
+// corsMiddleware 按配置设置跨域响应头, allowOrigins 包含 * 时允许所有来源
+func corsMiddleware(allowOrigins []string) gin.HandlerFunc {
+	allowAll := false
+	allowed := make(map[string]bool)
+	for _, origin := range allowOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(origin) <= 0 || (!allowAll && !allowed[origin]) {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		if allowAll {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+		}
+		header.Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, Content-Type, Accept-Ranges")
+		if c.Request.Method == http.MethodOptions {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "Range, Content-Type")
+			header.Set("Access-Control-Max-Age", "86400")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// server http 或 https 服务
+type server struct {
+	*http.Server
+	name  string
+	start func() error
+}
+
+// newServers 根据配置创建启用的 http 和 https 服务
+// https 使用证书文件时返回证书的 Reloader, 使用 ACME 时返回 nil
+func newServers(cfg *config.Config, handler http.Handler) ([]*server, *tlscert.Reloader, error) {
+	newHttpServer := func(addr string, handler http.Handler) *http.Server {
+		return &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: time.Duration(cfg.Timeouts.Read),
+			ReadTimeout:       time.Duration(cfg.Timeouts.Read),
+			WriteTimeout:      time.Duration(cfg.Timeouts.Write),
+			IdleTimeout:       time.Duration(cfg.Timeouts.Idle),
+		}
+	}
+
+	var servers []*server
+	var reloader *tlscert.Reloader
+	httpHandler := handler
+	if cfg.Https.Enabled {
+		srv := &server{Server: newHttpServer(cfg.Https.Addr, handler), name: "HTTPS"}
+		if acmeCfg := cfg.Https.Acme; acmeCfg.Enabled {
+			m, err := tlscert.NewAcmeManager(tlscert.AcmeOptions{
+				DirectoryUrl: acmeCfg.DirectoryUrl,
+				Domains:      acmeCfg.Domains,
+				Email:        acmeCfg.Email,
+				CacheDir:     acmeCfg.CacheDir,
+				CaFile:       acmeCfg.CaFile,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			srv.TLSConfig = m.TLSConfig()
+			// http 服务处理 http-01 验证请求
+			httpHandler = m.HTTPHandler(handler)
+		} else {
+			var err error
+			if reloader, err = tlscert.NewReloader(cfg.Https.CertFile, cfg.Https.KeyFile); err != nil {
+				return nil, nil, err
+			}
+			srv.TLSConfig = &tls.Config{GetCertificate: reloader.GetCertificate}
+		}
+		srv.start = func() error {
+			// 证书由 TLSConfig 提供
+			return srv.ListenAndServeTLS("", "")
+		}
+		servers = append(servers, srv)
+	}
+	if cfg.Http.Enabled {
+		srv := &server{Server: newHttpServer(cfg.Http.Addr, httpHandler), name: "HTTP"}
+		srv.start = srv.ListenAndServe
+		servers = append([]*server{srv}, servers...)
+	}
+	return servers, reloader, nil
+}
+
+// watchCertificate 文件变化或收到 SIGHUP 时重新加载证书, interval 为 0 时只响应 SIGHUP
+func watchCertificate(ctx context.Context, reloader *tlscert.Reloader, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		reloader.Watch(ctx, interval, hup)
+	}()
+}
+
+// streamLink 返回资源地址的代理链接 /video/stream?t=<令牌>, m3u8 地址返回 /video/hls?t=<令牌>
+// 不属于已注册渠道的地址原样返回
+func streamLink(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err == nil && strings.EqualFold(path.Ext(u.Path), ".m3u8") {
+		return signedLink("/video/hls", rawUrl)
+	}
+	return signedLink("/video/stream", rawUrl)
+}
+
+// signedLink 返回资源地址的代理链接 prefix?t=<令牌>, 不属于已注册渠道的地址原样返回
+func signedLink(prefix, rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || safehttp.CheckUrl(u, mediaHostAllowed) != nil {
+		return rawUrl
+	}
+	source, _ := parser.MatchMediaHost(u.Hostname())
+	headers := parser.MediaHeaders(source)
+	token, err := streamSigner.Sign(streamtoken.Claims{
+		Url:       rawUrl,
+		Source:    source,
+		Referer:   headers.Get(parser.HttpHeaderReferer),
+		UserAgent: headers.Get(parser.HttpHeaderUserAgent),
+	})
+	if err != nil {
+		return rawUrl
+	}
+	return prefix + "?t=" + token
+}
+
+// hlsTarget /video/hls 只接受 signedLink 签发的令牌, 返回令牌中的上游地址
+func hlsTarget(r *http.Request) (string, error) {
+	token := r.URL.Query().Get("t")
+	if token == "" {
+		return "", errors.New("令牌不能为空")
+	}
+	claims, err := streamSigner.Verify(token)
+	if err != nil {
+		return "", fmt.Errorf("令牌无效: %w", err)
+	}
+	return claims.Url, nil
+}
+
+// proxyParseInfo 将解析结果中的视频、音频、封面、图集等地址替换为代理链接
+func proxyParseInfo(info *parser.VideoParseInfo) {
+	proxyStreams := func(streams []parser.StreamVariant) {
+		for i := range streams {
+			streams[i].Url = streamLink(streams[i].Url)
+			for j := range streams[i].BackupUrls {
+				streams[i].BackupUrls[j] = streamLink(streams[i].BackupUrls[j])
+			}
+		}
+	}
+
+	info.VideoUrl = streamLink(info.VideoUrl)
+	info.MusicUrl = streamLink(info.MusicUrl)
+	info.CoverUrl = streamLink(info.CoverUrl)
+	info.Author.Avatar = streamLink(info.Author.Avatar)
+	for i := range info.Images {
+		info.Images[i] = streamLink(info.Images[i])
+	}
+	for i := range info.ImageItems {
+		item := &info.ImageItems[i]
+		item.Url = streamLink(item.Url)
+		item.NoWatermarkUrl = streamLink(item.NoWatermarkUrl)
+		item.LiveVideoUrl = streamLink(item.LiveVideoUrl)
+	}
+	if info.Music != nil {
+		info.Music.Url = streamLink(info.Music.Url)
+	}
+	proxyStreams(info.Streams)
+	for i := range info.Pages {
+		info.Pages[i].VideoUrl = streamLink(info.Pages[i].VideoUrl)
+		info.Pages[i].MusicUrl = streamLink(info.Pages[i].MusicUrl)
+		proxyStreams(info.Pages[i].Streams)
+	}
+}
+
+// mediaRequestHeader 请求资源地址时需要带上的请求头, 即资源域名所属渠道的 MediaHeaders
+func mediaRequestHeader(rawUrl string) http.Header {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return make(http.Header)
+	}
+	source, _ := parser.MatchMediaHost(u.Hostname())
+	return parser.MediaHeaders(source)
+}
+
+// mediaHostAllowed 域名是否属于已注册渠道的资源域名
+func mediaHostAllowed(host string) bool {
+	_, ok := parser.MatchMediaHost(host)
+	return ok
+}
+
 //go:embed templates/*
 var files embed.FS
 
 func main() {
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(config.Usage())
+		return
+	}
+	if err != nil {
+		log.Fatalf("配置错误:\n%v", err)
+	}
+	if err = applyConfig(cfg); err != nil {
+		log.Fatalf("配置错误: %v", err)
+	}
+
+	gin.SetMode(cfg.Mode)
 	r := gin.Default()
+	r.Use(corsMiddleware(cfg.Cors.AllowOrigins))
 
 	sub, err := fs.Sub(files, "templates")
 	if err != nil {
@@ -45,52 +361,87 @@ func main() {
 
 	r.GET("/video/share/url/parse", func(c *gin.Context) {
 		paramUrl := c.Query("url")
-		parseRes, err := parser.ParseVideoShareUrlByRegexp(paramUrl)
-		jsonRes := HttpResponse{
-			Code: 200,
-			Msg:  "解析成功",
-			Data: parseRes,
-		}
+		parseRes, err := parser.ParseVideoShareUrlByRegexpContext(c.Request.Context(), paramUrl)
 		if err != nil {
-			jsonRes = HttpResponse{
-				Code: 201,
+			status := parseErrorStatus(err)
+			c.JSON(status, HttpResponse{
+				Code: status,
 				Msg:  err.Error(),
-			}
+			})
+			return
+		}
+		if c.Query("proxy") == "1" {
+			proxyParseInfo(parseRes)
 		}
 
-		c.JSON(http.StatusOK, jsonRes)
+		c.JSON(http.StatusOK, HttpResponse{
+			Code: 200,
+			Msg:  "解析成功",
+			Data: parseRes,
+		})
 	})
 
 	r.GET("/video/id/parse", func(c *gin.Context) {
 		videoId := c.Query("video_id")
 		source := c.Query("source")
 
-		parseRes, err := parser.ParseVideoId(source, videoId)
-		jsonRes := HttpResponse{
-			Code: 200,
-			Msg:  "解析成功",
-			Data: parseRes,
-		}
+		parseRes, err := parser.ParseVideoIdContext(c.Request.Context(), source, videoId)
 		if err != nil {
-			jsonRes = HttpResponse{
-				Code: 201,
+			status := parseErrorStatus(err)
+			c.JSON(status, HttpResponse{
+				Code: status,
 				Msg:  err.Error(),
-			}
+			})
+			return
+		}
+		if c.Query("proxy") == "1" {
+			proxyParseInfo(parseRes)
 		}
 
-		c.JSON(200, jsonRes)
+		c.JSON(http.StatusOK, HttpResponse{
+			Code: 200,
+			Msg:  "解析成功",
+			Data: parseRes,
+		})
 	})
 
+	r.POST("/video/batch", batchHandler(cfg.Batch))
+	r.GET("/video/batch/:job/events", batchEventsHandler)
+
+	jobQueue, err := newJobQueue(cfg.Jobs)
+	if err != nil {
+		log.Fatalf("创建任务队列失败: %v", err)
+	}
+	registerJobRoutes(r, jobQueue, cfg.Jobs.DownloadDir)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		if err := jobQueue.Run(jobsCtx); err != nil {
+			log.Printf("任务队列退出: %v", err)
+		}
+	}()
+
 	// 新增: 直接返回视频流的接口
 	r.GET("/video/stream", func(c *gin.Context) {
-		videoUrl := c.Query("url")
-		if videoUrl == "" {
+		// 只接受解析接口返回的签名令牌, 不接受客户端直接传入的上游地址
+		token := c.Query("t")
+		if token == "" {
 			c.JSON(http.StatusBadRequest, HttpResponse{
 				Code: 400,
-				Msg:  "视频URL不能为空",
+				Msg:  "令牌不能为空",
 			})
 			return
 		}
+		claims, err := streamSigner.Verify(token)
+		if err != nil {
+			c.JSON(http.StatusForbidden, HttpResponse{
+				Code: 403,
+				Msg:  "令牌无效: " + err.Error(),
+			})
+			return
+		}
+		videoUrl := claims.Url
 
 		// 检测是否来自微信环境
 		userAgent := c.Request.UserAgent()
@@ -107,27 +458,20 @@ func main() {
 			}
 		}
 
-		// 创建HTTP客户端, 微信环境可能需要更短的超时时间
-		client := &http.Client{
-			Timeout: 20 * time.Second, // 缩短超时时间
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // 跳过证书验证
-				// 增加传输层超时设置
-				ResponseHeaderTimeout: 10 * time.Second,
-				ExpectContinueTimeout: 10 * time.Second,
-				// 允许重用连接
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     30 * time.Second,
-			},
-		}
-
 		// 发送请求获取视频
-		req, err := http.NewRequest("GET", videoUrl, nil)
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, videoUrl, nil)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, HttpResponse{
-				Code: 500,
-				Msg:  "创建请求失败: " + err.Error(),
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  "视频URL格式错误: " + err.Error(),
+			})
+			return
+		}
+		// 只代理已注册渠道的资源域名, 防止被用作访问内网的代理
+		if err = safehttp.CheckUrl(req.URL, mediaHostAllowed); err != nil {
+			c.JSON(http.StatusForbidden, HttpResponse{
+				Code: 403,
+				Msg:  "不允许代理该地址: " + err.Error(),
 			})
 			return
 		}
@@ -144,27 +488,45 @@ func main() {
 			req.Header.Set("Accept-Encoding", "gzip, deflate")
 			req.Header.Set("Connection", "keep-alive")
 		} else {
-			// 在非微信环境下，转发所有请求头
-			for name, values := range c.Request.Header {
-				// 跳过一些可能导致问题的头
-				if name != "Connection" && name != "Sec-Fetch-Mode" {
-					for _, value := range values {
-						req.Header.Add(name, value)
-					}
+			// 在非微信环境下，只转发与视频内容相关的请求头, 不转发 Cookie 等客户端凭证
+			for _, name := range streamForwardHeaders {
+				for _, value := range c.Request.Header.Values(name) {
+					req.Header.Add(name, value)
 				}
 			}
 		}
 
+		// 渠道要求的请求头: 先使用令牌中的, 再使用资源域名所属渠道当前配置的, Cookie 等不写入令牌
+		if claims.Referer != "" {
+			req.Header.Set("Referer", claims.Referer)
+		}
+		if claims.UserAgent != "" {
+			req.Header.Set("User-Agent", claims.UserAgent)
+		}
+		if source, ok := parser.MatchMediaHost(req.URL.Hostname()); ok {
+			for name, values := range parser.MediaHeaders(source) {
+				req.Header[name] = values
+			}
+		}
+
 		// 确保有User-Agent头
 		if req.Header.Get("User-Agent") == "" {
 			req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 13_2_3 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.3 Mobile/15E148 Safari/604.1")
 		}
 
 		log.Printf("请求视频URL: %s, 是否微信环境: %v", videoUrl, isWechat)
-		resp, err := client.Do(req)
+		resp, err := streamClient.Do(req)
 		if err != nil {
 			errMsg := fmt.Sprintf("获取视频失败: %s", err.Error())
 			log.Println(errMsg)
+			// 重定向到了不允许的地址
+			if errors.Is(err, safehttp.ErrForbiddenUrl) || errors.Is(err, safehttp.ErrForbiddenAddress) {
+				c.JSON(http.StatusForbidden, HttpResponse{
+					Code: 403,
+					Msg:  errMsg,
+				})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, HttpResponse{
 				Code: 500,
 				Msg:  errMsg,
@@ -184,11 +546,6 @@ func main() {
 			return
 		}
 
-		// 清除之前可能设置的所有响应头
-		for k := range c.Writer.Header() {
-			c.Writer.Header().Del(k)
-		}
-
 		// 微信环境下，只设置必要的响应头
 		if isWechat {
 			// 根据内容类型设置
@@ -205,27 +562,18 @@ func main() {
 			if resp.Header.Get("Content-Length") != "" {
 				c.Writer.Header().Set("Content-Length", resp.Header.Get("Content-Length"))
 			}
-
-			// 必要的跨域设置
-			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET")
 			c.Writer.Header().Set("Accept-Ranges", "bytes")
 		} else {
-			// 非微信环境，转发所有响应头
+			// 非微信环境，转发所有响应头, 跨域头由 corsMiddleware 按配置设置
 			for name, values := range resp.Header {
 				// 跳过一些可能导致问题的响应头
-				if name != "Connection" && name != "Transfer-Encoding" {
+				if name != "Connection" && name != "Transfer-Encoding" && name != "Set-Cookie" &&
+					!strings.HasPrefix(name, "Access-Control-") {
 					for _, value := range values {
 						c.Writer.Header().Add(name, value)
 					}
 				}
 			}
-
-			// 设置跨域头
-			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "*")
-			c.Writer.Header().Set("Access-Control-Expose-Headers", "*")
 		}
 
 		// 设置状态码
@@ -240,54 +588,164 @@ func main() {
 		}
 	})
 
-	// 证书文件路径
-	certFile := "full_chain_rsa.crt"
-	keyFile := "redjue.top.key"
-
-	// HTTP服务器配置
-	httpSrv := &http.Server{
-		Addr:    ":7777",
-		Handler: r,
+	// HLS 代理, 改写播放列表中的地址, 浏览器可直接播放 m3u8, 参数: t 解析接口 proxy=1 时返回的令牌
+	// 不接受客户端传入的上游地址, 播放列表中的地址同样改写为带令牌的代理链接
+	// 播放列表、分片和密钥都带上资源域名所属渠道的 MediaHeaders
+	hlsHeader := hls.WithHeaderFunc(func(u *url.URL) http.Header {
+		return mediaRequestHeader(u.String())
+	})
+	hlsLink := func(uri string) string {
+		return signedLink("/video/hls", uri)
 	}
+	r.GET("/video/hls", gin.WrapH(hls.NewProxy(hlsTarget, hlsLink, hls.WithHttpClient(streamClient), hlsHeader)))
 
-	// HTTPS服务器配置
-	httpsSrv := &http.Server{
-		Addr:    ":7778", // 使用HTTPS端口
-		Handler: r,
-	}
+	// 下载 m3u8 的所有分片拼接为一个文件返回
+	// 参数: url 分享链接; height 选择不超过该高度的最高码率; 不接受客户端传入的 m3u8 地址
+	r.GET("/video/hls/download", func(c *gin.Context) {
+		parseRes, err := parser.ParseVideoShareUrlByRegexpContext(c.Request.Context(), c.Query("url"))
+		if err != nil {
+			status := parseErrorStatus(err)
+			c.JSON(status, HttpResponse{
+				Code: status,
+				Msg:  err.Error(),
+			})
+			return
+		}
+		playlistUrl := parseRes.VideoUrl
+		if playlistUrl == "" {
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  "该链接没有m3u8地址",
+			})
+			return
+		}
 
-	// 启动HTTP服务
-	go func() {
-		log.Println("HTTP Server starting on :7777...")
-		if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP listen error: %s\n", err)
+		opts := []hls.Option{hls.WithHttpClient(streamClient), hlsHeader}
+		if height, err := strconv.ParseInt(c.Query("height"), 10, 64); err == nil {
+			opts = append(opts, hls.WithMaxHeight(height))
 		}
-	}()
+		playlist, err := hls.Resolve(c.Request.Context(), playlistUrl, opts...)
+		if err != nil {
+			log.Printf("获取m3u8失败: %v", err)
+			c.JSON(http.StatusBadGateway, HttpResponse{
+				Code: 502,
+				Msg:  "获取m3u8失败: " + err.Error(),
+			})
+			return
+		}
+		// fmp4 分片拼接为 mp4, ts 分片拼接为 ts
+		contentType, name := "video/mp2t", "video.ts"
+		if playlist.IsFmp4() {
+			contentType, name = "video/mp4", "video.mp4"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+		c.Status(http.StatusOK)
 
-	// 启动HTTPS服务，使用SSL证书
-	go func() {
-		log.Println("HTTPS Server starting on :7778...")
-		if err := httpsSrv.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTPS listen error: %s\n", err)
+		err = hls.DownloadPlaylist(c.Request.Context(), c.Writer, playlist, opts...)
+		if err == nil {
+			return
 		}
-	}()
+		log.Printf("下载m3u8失败: %v", err)
+		// 已开始传输时只能中断, 否则返回错误信息
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("Content-Type")
+			c.JSON(http.StatusBadGateway, HttpResponse{
+				Code: 502,
+				Msg:  "下载m3u8失败: " + err.Error(),
+			})
+		}
+	})
+
+	// 合并 dash 格式的视频流和音频流(如B站), 返回带声音的 mp4
+	// 参数: url 分享链接; 不接受客户端传入的视频流地址, 请求头使用资源域名所属渠道的 MediaHeaders
+	r.GET("/video/merge", func(c *gin.Context) {
+		parseRes, err := parser.ParseVideoShareUrlByRegexpContext(c.Request.Context(), c.Query("url"))
+		if err != nil {
+			status := parseErrorStatus(err)
+			c.JSON(status, HttpResponse{
+				Code: status,
+				Msg:  err.Error(),
+			})
+			return
+		}
+		videoUrl, audioUrl := parseRes.VideoUrl, parseRes.MusicUrl
+		if videoUrl == "" || audioUrl == "" {
+			c.JSON(http.StatusBadRequest, HttpResponse{
+				Code: 400,
+				Msg:  "该链接没有单独的视频流和音频流",
+			})
+			return
+		}
+
+		opts := []dash.Option{dash.WithHttpClient(streamClient)}
+		header := mediaRequestHeader(videoUrl)
+		for name := range header {
+			opts = append(opts, dash.WithHeader(name, header.Get(name)))
+		}
+		c.Header("Content-Type", "video/mp4")
+		c.Header("Content-Disposition", `attachment; filename="video.mp4"`)
+		c.Status(http.StatusOK)
+
+		err = dash.MergeUrl(c.Request.Context(), c.Writer, videoUrl, audioUrl, opts...)
+		if err == nil {
+			return
+		}
+		log.Printf("合并视频流失败: %v", err)
+		// 已开始传输时只能中断, 否则返回错误信息
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("Content-Type")
+			c.JSON(http.StatusBadGateway, HttpResponse{
+				Code: 502,
+				Msg:  "合并视频流失败: " + err.Error(),
+			})
+		}
+	})
+
+	// 图集打包为 zip 下载, 参数: url 分享链接, cover=1 时包含封面
+	r.GET("/video/gallery.zip", galleryHandler(streamClient, int64(cfg.Gallery.MaxSizeMB)<<20))
 
-	// 等待中断信号以优雅地关闭服务器 (设置 5 秒的超时时间)
+	servers, reloader, err := newServers(cfg, r)
+	if err != nil {
+		log.Fatalf("create servers: %v", err)
+	}
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if reloader != nil {
+		watchCertificate(watchCtx, reloader, time.Duration(cfg.Https.WatchInterval))
+	}
+	for _, srv := range servers {
+		go func(srv *server) {
+			log.Printf("%s Server starting on %s...", srv.name, srv.Addr)
+			if err := srv.start(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("%s listen error: %s", srv.name, err)
+			}
+		}(srv)
+	}
+
+	// 等待中断信号以优雅地关闭服务器
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutdown Servers ...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeouts.Shutdown))
 	defer cancel()
 
-	// 关闭两个服务器
-	if err := httpSrv.Shutdown(ctx); err != nil {
-		log.Fatal("HTTP Server Shutdown:", err)
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Fatalf("%s Server Shutdown: %v", srv.name, err)
+		}
 	}
 
-	if err := httpsSrv.Shutdown(ctx); err != nil {
-		log.Fatal("HTTPS Server Shutdown:", err)
+	// 等待执行中的任务中断并保存状态, 下次启动后重新执行
+	stopJobs()
+	select {
+	case <-jobsDone:
+	case <-ctx.Done():
+		log.Println("等待任务队列退出超时")
 	}
 
 	log.Println("Servers exiting")
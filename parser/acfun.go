@@ -1,20 +1,21 @@
 package parser
 
 import (
+	"context"
 	"regexp"
 	"strings"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type acFun struct {
 }
 
-func (a acFun) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (a acFun) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourceAcFun)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, "User-Agent:Mozilla/5.0 (iPhone; CPU iPhone OS 11_0 like Mac OS X) AppleWebKit/604.1.38 (KHTML, like Gecko) Version/11.0 Mobile/15A372 Safari/604.1").
+		SetContext(ctx).
+		SetHeader(HttpHeaderUserAgent, sourceUserAgent(ctx, SourceAcFun, "User-Agent:Mozilla/5.0 (iPhone; CPU iPhone OS 11_0 like Mac OS X) AppleWebKit/604.1.38 (KHTML, like Gecko) Version/11.0 Mobile/15A372 Safari/604.1")).
 		Get(shareUrl)
 	if err != nil {
 		return nil, err
@@ -27,19 +28,34 @@ func (a acFun) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 		jsonStr := strings.TrimSpace(string(findRes[1]))
 		parseInfo.Title = gjson.Get(jsonStr, "title").String()
 		parseInfo.CoverUrl = gjson.Get(jsonStr, "cover").String()
+		if dougaId := gjson.Get(jsonStr, "dougaId").String(); len(dougaId) > 0 {
+			parseInfo.VideoId = "ac" + dougaId
+		}
+		parseInfo.Duration = millisToSeconds(gjson.Get(jsonStr, "durationMillis").Int())
+		parseInfo.PublishedAt = gjson.Get(jsonStr, "createTimeMillis").Int() / 1000
+		for _, tag := range gjson.Get(jsonStr, "tagList").Array() {
+			parseInfo.Tags = appendTags(parseInfo.Tags, tag.Get("name").String())
+		}
+		parseInfo.Stats = newVideoStats(
+			gjson.Get(jsonStr, "viewCount").Int(),
+			gjson.Get(jsonStr, "likeCount").Int(),
+			gjson.Get(jsonStr, "commentCount").Int(),
+			gjson.Get(jsonStr, "shareCount").Int(),
+			gjson.Get(jsonStr, "stowCount").Int(),
+		)
 	}
 	playInfoRe := regexp.MustCompile(`var playInfo =\s(.*?);`)
 	if findRes := playInfoRe.FindSubmatch(res.Body()); len(findRes) >= 2 {
 		jsonStr := strings.TrimSpace(string(findRes[1]))
 		parseInfo.VideoUrl = gjson.Get(jsonStr, "streams.0.playUrls.0").String()
-		// 视频地址是m3u8, 可以使用网站 https://tools.thatwind.com/tool/m3u8downloader 下载
+		// 视频地址是m3u8, 可以使用 /video/hls 代理播放, /video/hls/download 下载
 	}
 
 	return parseInfo, nil
 }
 
-func (a acFun) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (a acFun) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	// acid, 格式: ac36935385
 	reqUrl := "https://www.acfun.cn/v/" + videoId
-	return a.parseShareUrl(reqUrl)
+	return a.ParseShareUrl(ctx, reqUrl)
 }
@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/wujunwei928/parse-video/utils"
+)
+
+// BatchResult BatchParseShareUrls 单条分享链接的解析结果
+type BatchResult struct {
+	Index      int             // 在输入中的位置
+	Duplicates []int           // 规范化后与该条相同的其他输入位置, 只解析一次
+	ShareUrl   string          // 从输入中提取的分享链接
+	Source     string          // 渠道, 无法识别时为空
+	ParseInfo  *VideoParseInfo // 视频解析信息
+	Error      error           // 解析失败的错误
+}
+
+// runWorkers 启动 concurrency 个 worker, 依次处理 0 到 n-1, ctx 取消时不再开始新的任务
+// 等待进行中的任务结束后返回, 返回值为已开始的任务数
+func runWorkers(ctx context.Context, n, concurrency int, work func(i int)) int {
+	concurrency = min(max(concurrency, 1), n)
+
+	var mu sync.Mutex
+	next := 0
+	take := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= n || ctx.Err() != nil {
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ok := take(); ok; i, ok = take() {
+				work(i)
+			}
+		}()
+	}
+	wg.Wait()
+	return next
+}
+
+func batchParseVideoId(ctx context.Context, source string, videoIds []string) (map[string]BatchParseItem, error) {
+	if len(videoIds) <= 0 || len(source) <= 0 {
+		return nil, newParseError(source, "", ErrInvalidInput, errors.New("videos id or source is empty"))
+	}
+
+	sourceInfo, _ := getSourceInfo(source)
+	idParser := sourceInfo.VideoIdParser
+	if idParser == nil {
+		return nil, newParseError(source, "", ErrUnsupportedSource, errors.New("source has no video id parser"))
+	}
+
+	// 去重, 保持原顺序
+	uniqueIds := make([]string, 0, len(videoIds))
+	seen := make(map[string]bool, len(videoIds))
+	for _, videoId := range videoIds {
+		if !seen[videoId] {
+			seen[videoId] = true
+			uniqueIds = append(uniqueIds, videoId)
+		}
+	}
+
+	var mu sync.Mutex
+	parseMap := make(map[string]BatchParseItem, len(uniqueIds))
+	started := runWorkers(ctx, len(uniqueIds), ClientFromContext(ctx).batchConcurrency, func(i int) {
+		parseInfo, parseErr := parseVideoId(ctx, source, uniqueIds[i])
+		mu.Lock()
+		defer mu.Unlock()
+		parseMap[uniqueIds[i]] = BatchParseItem{
+			ParseInfo: parseInfo,
+			Error:     parseErr,
+		}
+	})
+
+	// 取消时未开始解析的id不在结果中
+	if started < len(uniqueIds) {
+		return parseMap, ctx.Err()
+	}
+	return parseMap, nil
+}
+
+// BatchParseShareUrls 批量解析分享链接, 可混合不同渠道, 每条解析完成后立即从返回的 channel 中输出, 全部输出后关闭
+// 输入可以是分享链接或包含分享链接的分享文本, 规范化后相同的链接只解析一次
+// 同时最多解析 DefaultBatchConcurrency 条; ctx 取消时不再开始新的解析, 未开始的条目返回 ctx.Err()
+// 返回的 channel 有足够的缓冲, 调用方不读取也不会阻塞解析
+func BatchParseShareUrls(ctx context.Context, shareUrls []string) <-chan BatchResult {
+	return DefaultClient().BatchParseShareUrls(ctx, shareUrls)
+}
+
+func batchParseShareUrls(ctx context.Context, shareUrls []string) <-chan BatchResult {
+	var invalid, unique []*BatchResult
+	byKey := make(map[string]*BatchResult, len(shareUrls))
+	for i, shareMsg := range shareUrls {
+		shareUrl, err := utils.RegexpMatchUrlFromString(shareMsg)
+		if err != nil {
+			invalid = append(invalid, &BatchResult{Index: i, Error: newParseError("", "", ErrInvalidInput, err)})
+			continue
+		}
+		key, err := normalizeShareUrl(shareUrl)
+		if err != nil {
+			invalid = append(invalid, &BatchResult{Index: i, ShareUrl: shareUrl, Error: newParseError("", "", ErrInvalidInput, err)})
+			continue
+		}
+		if first, ok := byKey[key]; ok {
+			first.Duplicates = append(first.Duplicates, i)
+			continue
+		}
+		source, _, _ := matchShareUrlSource(shareUrl)
+		result := &BatchResult{Index: i, ShareUrl: shareUrl, Source: source}
+		byKey[key] = result
+		unique = append(unique, result)
+	}
+
+	results := make(chan BatchResult, len(invalid)+len(unique))
+	for _, result := range invalid {
+		results <- *result
+	}
+	go func() {
+		defer close(results)
+		started := runWorkers(ctx, len(unique), ClientFromContext(ctx).batchConcurrency, func(i int) {
+			result := unique[i]
+			result.ParseInfo, result.Error = parseVideoShareUrl(ctx, result.ShareUrl)
+			results <- *result
+		})
+		for _, result := range unique[started:] {
+			result.Error = newParseError(result.Source, "", nil, ctx.Err())
+			results <- *result
+		}
+	}()
+	return results
+}
+
+// normalizeShareUrl 规范化分享链接, 用于去重: 统一为 https, 域名小写, 去掉默认端口, 末尾的 /, 锚点和 utm_ 参数, 参数排序
+func normalizeShareUrl(shareUrl string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(shareUrl))
+	if err != nil {
+		return "", err
+	}
+	if len(u.Host) <= 0 {
+		return "", errors.New("share url has no host")
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = u.Host, ""
+	}
+	u.Host = strings.ToLower(host)
+	if len(port) > 0 && port != "80" && port != "443" {
+		u.Host = net.JoinHostPort(u.Host, port)
+	}
+	u.Scheme = "https"
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+	u.Path, u.RawPath = strings.TrimRight(u.Path, "/"), ""
+
+	query := u.Query()
+	for name := range query {
+		if strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
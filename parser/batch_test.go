@@ -0,0 +1,233 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowIdParser 每次解析耗时 delay, 记录解析次数和最大并发数
+type slowIdParser struct {
+	delay time.Duration
+
+	mu                      sync.Mutex
+	calls, running, maxSeen int
+}
+
+func (p *slowIdParser) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
+	p.mu.Lock()
+	p.calls++
+	p.running++
+	p.maxSeen = max(p.maxSeen, p.running)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.running--
+		p.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(p.delay):
+		return &VideoParseInfo{Title: videoId}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestBatchParseVideoId_concurrency(t *testing.T) {
+	const source = "fake_batch"
+	p := &slowIdParser{delay: 5 * time.Millisecond}
+	if err := Register(source, SourceInfo{VideoIdParser: p}); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(source)
+
+	client, err := NewClient(WithBatchConcurrency(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"1", "2", "3", "4", "5", "6", "7", "8", "1", "2"}
+	res, err := client.BatchParseVideoId(context.Background(), source, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 8 {
+		t.Errorf("got %d results, want 8", len(res))
+	}
+	for id, item := range res {
+		if item.Error != nil || item.ParseInfo.Title != id {
+			t.Errorf("res[%s] = %+v", id, item)
+		}
+	}
+	// 重复的id只解析一次
+	if p.calls != 8 {
+		t.Errorf("parsed %d times, want 8", p.calls)
+	}
+	if p.maxSeen > 3 {
+		t.Errorf("max concurrency = %d, want <= 3", p.maxSeen)
+	}
+}
+
+func TestBatchParseVideoId_canceled(t *testing.T) {
+	const source = "fake_batch"
+	p := &slowIdParser{delay: 20 * time.Millisecond}
+	if err := Register(source, SourceInfo{VideoIdParser: p}); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(source)
+
+	client, err := NewClient(WithBatchConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	ids := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+	res, err := client.BatchParseVideoId(ctx, source, ids)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// 前两条已完成, 之后开始的被中断, 其余未开始
+	var done int
+	for _, item := range res {
+		if item.Error == nil {
+			done++
+		}
+	}
+	if done < 2 || len(res) >= len(ids) {
+		t.Errorf("got %d results, %d done, want partial results", len(res), done)
+	}
+}
+
+func TestRunWorkers(t *testing.T) {
+	var count atomic.Int32
+	if started := runWorkers(context.Background(), 100, 7, func(int) { count.Add(1) }); started != 100 || count.Load() != 100 {
+		t.Errorf("runWorkers() started %d, ran %d, want 100", started, count.Load())
+	}
+	if started := runWorkers(context.Background(), 0, 7, func(int) { t.Error("work called") }); started != 0 {
+		t.Errorf("runWorkers() with no work started %d", started)
+	}
+}
+
+// slowShareParser 分享链接解析, 路径为 /missing 时返回不存在
+type slowShareParser struct {
+	slowIdParser
+}
+
+func (p *slowShareParser) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	if strings.HasSuffix(shareUrl, "/missing") {
+		return nil, newParseError("", "", ErrVideoNotFound, errors.New("missing"))
+	}
+	return p.ParseVideoID(ctx, shareUrl)
+}
+
+func TestBatchParseShareUrls(t *testing.T) {
+	a, b := &slowShareParser{slowIdParser{delay: time.Millisecond}}, &slowShareParser{slowIdParser{delay: 2 * time.Millisecond}}
+	for source, p := range map[string]*slowShareParser{"fake_a": a, "fake_b": b} {
+		if err := Register(source, SourceInfo{VideoShareUrlDomain: []string{"v." + source + ".example.com"}, VideoShareUrlParser: p}); err != nil {
+			t.Fatal(err)
+		}
+		defer Unregister(source)
+	}
+
+	inputs := []string{
+		"https://v.fake_a.example.com/1/",
+		"看看这个 https://v.fake_b.example.com/2?utm_source=x 视频",
+		"no url here",
+		"http://V.FAKE_A.EXAMPLE.COM/1#share",
+		"https://v.fake_b.example.com/missing",
+		"https://v.unknown.example.com/3",
+		"https://v.fake_b.example.com/2",
+	}
+	got := make(map[int]BatchResult)
+	for result := range BatchParseShareUrls(context.Background(), inputs) {
+		if _, ok := got[result.Index]; ok {
+			t.Errorf("index %d emitted twice", result.Index)
+		}
+		got[result.Index] = result
+	}
+
+	want := []struct {
+		index      int
+		source     string
+		duplicates []int
+		kind       error
+	}{
+		{index: 0, source: "fake_a", duplicates: []int{3}},
+		{index: 1, source: "fake_b", duplicates: []int{6}},
+		{index: 2, kind: ErrInvalidInput},
+		{index: 4, source: "fake_b", kind: ErrVideoNotFound},
+		{index: 5, kind: ErrUnsupportedSource},
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d results, want %d", len(got), len(want))
+	}
+	for _, w := range want {
+		result, ok := got[w.index]
+		if !ok {
+			t.Errorf("missing result for index %d", w.index)
+			continue
+		}
+		if result.Source != w.source || !reflect.DeepEqual(result.Duplicates, w.duplicates) {
+			t.Errorf("result[%d] = source %q, duplicates %v, want %q, %v", w.index, result.Source, result.Duplicates, w.source, w.duplicates)
+		}
+		if w.kind != nil {
+			if !errors.Is(result.Error, w.kind) {
+				t.Errorf("result[%d].Error = %v, want %v", w.index, result.Error, w.kind)
+			}
+		} else if result.Error != nil || result.ParseInfo == nil {
+			t.Errorf("result[%d] = %+v, want success", w.index, result)
+		}
+	}
+	if a.calls != 1 || b.calls != 1 {
+		t.Errorf("parsed fake_a %d times, fake_b %d times, want 1 each", a.calls, b.calls)
+	}
+}
+
+func TestBatchParseShareUrls_canceled(t *testing.T) {
+	p := &slowShareParser{slowIdParser{delay: time.Hour}}
+	if err := Register("fake_a", SourceInfo{VideoShareUrlDomain: []string{"v.fake_a.example.com"}, VideoShareUrlParser: p}); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister("fake_a")
+
+	client, err := NewClient(WithBatchConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	results := client.BatchParseShareUrls(ctx, []string{"https://v.fake_a.example.com/1", "https://v.fake_a.example.com/2", "https://v.fake_a.example.com/3"})
+	cancel()
+
+	var n int
+	for result := range results {
+		n++
+		if !errors.Is(result.Error, context.Canceled) {
+			t.Errorf("result[%d].Error = %v, want context.Canceled", result.Index, result.Error)
+		}
+	}
+	if n != 3 {
+		t.Errorf("got %d results, want 3", n)
+	}
+}
+
+func TestNormalizeShareUrl(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"https://v.douyin.com/iRNBho6u/", "https://v.douyin.com/iRNBho6u"},
+		{"http://V.Douyin.com:80/iRNBho6u#x", "https://v.douyin.com/iRNBho6u"},
+		{"https://example.com:8443/a?b=2&a=1&utm_medium=share", "https://example.com:8443/a?a=1&b=2"},
+	} {
+		if got, err := normalizeShareUrl(tt.in); err != nil || got != tt.want {
+			t.Errorf("normalizeShareUrl(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := normalizeShareUrl("/path/only"); err == nil {
+		t.Errorf("normalizeShareUrl without host should fail")
+	}
+}
@@ -1,28 +1,38 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
-
+	"strconv"
 	"strings"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
+// BV号与av号互转使用的常量, 参考: https://github.com/SocialSisterYi/bilibili-API-collect
+const (
+	biliBiliXorCode  = 23442827791579
+	biliBiliMaskCode = 2251799813685247
+	biliBiliMaxAid   = 1 << 51
+	biliBiliBase     = 58
+	biliBiliAlphabet = "FcwAPNKTMug3GV5Lj7EJnHpWsx4tb8haYeviqBz6rkCy12mUSDQX9RdoZf"
+)
+
 type bilibili struct{}
 
-func (b bilibili) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (b bilibili) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	// 处理短链接重定向
 	if strings.Contains(shareUrl, "b23.tv") {
-		client := resty.New()
+		client := newRestyClient(ctx, SourceBiliBili)
 		client.SetRedirectPolicy(resty.NoRedirectPolicy())
 		resp, err := client.R().
-			SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+			SetContext(ctx).
 			Get(shareUrl)
-		
-		if !errors.Is(err, resty.ErrAutoRedirectDisabled) {
+
+		if err = redirectError(SourceBiliBili, err); err != nil {
 			return nil, err
 		}
 
@@ -36,30 +46,74 @@ func (b bilibili) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	// 解析视频ID
 	urlObj, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(SourceBiliBili, "", ErrInvalidInput, err)
 	}
 
-	var bvid string
+	var videoId string
 	pathParts := strings.Split(strings.Trim(urlObj.Path, "/"), "/")
 	for i, part := range pathParts {
 		if strings.HasPrefix(part, "BV") {
-			bvid = part
+			videoId = part
 			break
 		}
 		if part == "video" && i+1 < len(pathParts) {
-			bvid = pathParts[i+1]
+			videoId = pathParts[i+1]
 			break
 		}
 	}
 
-	if bvid == "" {
-		return nil, errors.New("无法解析视频ID")
+	if videoId == "" {
+		return nil, newParseError(SourceBiliBili, "", ErrInvalidInput, errors.New("无法解析视频ID"))
+	}
+	bvid, err := b.toBvid(videoId)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多P视频, 分享链接中的 p 参数为分P序号, 从1开始
+	page := int64(1)
+	if p := urlObj.Query().Get("p"); len(p) > 0 {
+		page, err = strconv.ParseInt(p, 10, 64)
+		if err != nil || page < 1 {
+			return nil, newParseError(SourceBiliBili, bvid, ErrInvalidInput, fmt.Errorf("分P参数错误: %s", p))
+		}
+	}
+
+	return b.parseVideo(ctx, bvid, page)
+}
+
+// ParseVideoID 根据视频id解析, 支持BV号(BV1xx411c7mD)和av号(av2, 或纯数字2)
+func (b bilibili) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
+	bvid, err := b.toBvid(videoId)
+	if err != nil {
+		return nil, err
 	}
+	return b.parseVideo(ctx, bvid, 1)
+}
 
+// toBvid 将BV号或av号统一转换为BV号
+func (b bilibili) toBvid(videoId string) (string, error) {
+	if strings.HasPrefix(strings.ToUpper(videoId), "BV") {
+		if _, err := BiliBiliBvToAv(videoId); err != nil {
+			return "", newParseError(SourceBiliBili, videoId, ErrInvalidInput, err)
+		}
+		return "BV" + videoId[2:], nil
+	}
+
+	aid, err := strconv.ParseInt(strings.TrimPrefix(strings.ToLower(videoId), "av"), 10, 64)
+	if err != nil || aid <= 0 || aid >= biliBiliMaxAid {
+		return "", newParseError(SourceBiliBili, videoId, ErrInvalidInput, errors.New("视频ID不是有效的BV号或av号"))
+	}
+	return BiliBiliAvToBv(aid), nil
+}
+
+// parseVideo 解析视频信息, page 为分P序号
+// 配置 WithAllPages 时, 同时返回所有分P的播放地址
+func (b bilibili) parseVideo(ctx context.Context, bvid string, page int64) (*VideoParseInfo, error) {
 	// 使用API获取视频信息
-	client := resty.New()
+	client := newRestyClient(ctx, SourceBiliBili)
 	apiResp, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		SetHeader(HttpHeaderReferer, "https://www.bilibili.com").
 		Get(fmt.Sprintf("https://api.bilibili.com/x/web-interface/view?bvid=%s", bvid))
 	if err != nil {
@@ -68,40 +122,175 @@ func (b bilibili) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 
 	data := gjson.Parse(string(apiResp.Body()))
 	if data.Get("code").Int() != 0 {
-		return nil, fmt.Errorf("获取视频信息失败: %s", data.Get("message").String())
+		return nil, newParseError(SourceBiliBili, bvid, b.apiCodeKind(data.Get("code").Int()), fmt.Errorf("获取视频信息失败: %s", data.Get("message").String()))
 	}
 
 	videoData := data.Get("data")
-	cid := videoData.Get("cid").String()
 
+	// 分P列表, 接口未返回时视为只有一P
+	pages := make([]VideoPage, 0)
+	for _, item := range videoData.Get("pages").Array() {
+		pages = append(pages, VideoPage{
+			Page:     item.Get("page").Int(),
+			Cid:      item.Get("cid").String(),
+			Title:    item.Get("part").String(),
+			Duration: item.Get("duration").Int(),
+		})
+	}
+	if len(pages) <= 0 {
+		pages = append(pages, VideoPage{
+			Page:     1,
+			Cid:      videoData.Get("cid").String(),
+			Title:    videoData.Get("title").String(),
+			Duration: videoData.Get("duration").Int(),
+		})
+	}
+	if page > int64(len(pages)) {
+		return nil, newParseError(SourceBiliBili, bvid, ErrVideoNotFound, fmt.Errorf("分P不存在: %d, 共 %d P", page, len(pages)))
+	}
+
+	// 获取分P的播放地址
+	if err = b.pagePlayUrl(ctx, client, bvid, &pages[page-1]); err != nil {
+		return nil, err
+	}
+	current := pages[page-1]
+
+	info := &VideoParseInfo{
+		Title:    videoData.Get("title").String(),
+		VideoUrl: current.VideoUrl,
+		MusicUrl: current.MusicUrl, // 添加音频地址
+		CoverUrl: videoData.Get("pic").String(),
+		Streams:  current.Streams,
+	}
+
+	info.Author.Name = videoData.Get("owner.name").String()
+	info.Author.Uid = videoData.Get("owner.mid").String()
+	info.Author.Avatar = videoData.Get("owner.face").String()
+	info.VideoId = bvid
+	info.Duration = videoData.Get("duration").Int()
+	info.PublishedAt = videoData.Get("pubdate").Int()
+	info.Stats = newVideoStats(
+		videoData.Get("stat.view").Int(),
+		videoData.Get("stat.like").Int(),
+		videoData.Get("stat.reply").Int(),
+		videoData.Get("stat.share").Int(),
+		videoData.Get("stat.favorite").Int(),
+	)
+
+	if parseAllPages(ctx) {
+		for i := range pages {
+			if len(pages[i].VideoUrl) > 0 {
+				continue
+			}
+			if err = b.pagePlayUrl(ctx, client, bvid, &pages[i]); err != nil {
+				return nil, err
+			}
+		}
+		info.Pages = pages
+	}
+
+	return info, nil
+}
+
+// pagePlayUrl 获取分P的播放地址
+func (b bilibili) pagePlayUrl(ctx context.Context, client *resty.Client, bvid string, page *VideoPage) error {
 	// 获取播放地址（添加了cid参数）
 	playResp, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		SetHeader(HttpHeaderReferer, fmt.Sprintf("https://www.bilibili.com/video/%s", bvid)).
-		Get(fmt.Sprintf("https://api.bilibili.com/x/player/wbi/playurl?bvid=%s&cid=%s&qn=80&fnval=4048&fourk=1", bvid, cid))
+		Get(fmt.Sprintf("https://api.bilibili.com/x/player/wbi/playurl?bvid=%s&cid=%s&qn=80&fnval=4048&fourk=1", bvid, page.Cid))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	playData := gjson.Parse(string(playResp.Body()))
 	if playData.Get("code").Int() != 0 {
-		return nil, fmt.Errorf("获取播放地址失败: %s", playData.Get("message").String())
+		return newParseError(SourceBiliBili, bvid, b.apiCodeKind(playData.Get("code").Int()), fmt.Errorf("获取播放地址失败: %s", playData.Get("message").String()))
 	}
 
 	// 获取最高质量的视频地址
-	videoUrl := playData.Get("data.dash.video.0.baseUrl").String()
-	audioUrl := playData.Get("data.dash.audio.0.baseUrl").String()
+	page.VideoUrl = playData.Get("data.dash.video.0.baseUrl").String()
+	page.MusicUrl = playData.Get("data.dash.audio.0.baseUrl").String()
+	page.Streams = b.dashStreams(playData.Get("data"))
+	sortStreams(page.Streams)
 
-	info := &VideoParseInfo{
-		Title:    videoData.Get("title").String(),
-		VideoUrl: videoUrl,
-		MusicUrl: audioUrl,  // 添加音频地址
-		CoverUrl: videoData.Get("pic").String(),
+	return nil
+}
+
+// dashStreams 解析 dash 格式的视频流, 视频流不含音频, 音频地址为 MusicUrl
+func (b bilibili) dashStreams(playData gjson.Result) []StreamVariant {
+	// 清晰度id与名称的对应关系, 如: 80 => 1080P 高清
+	qualityNames := make(map[int64]string)
+	acceptDesc := playData.Get("accept_description").Array()
+	for i, item := range playData.Get("accept_quality").Array() {
+		if i < len(acceptDesc) {
+			qualityNames[item.Int()] = acceptDesc[i].String()
+		}
 	}
 
-	info.Author.Name = videoData.Get("owner.name").String()
-	info.Author.Uid = videoData.Get("owner.mid").String()
-	info.Author.Avatar = videoData.Get("owner.face").String()
+	var streams []StreamVariant
+	for _, item := range playData.Get("dash.video").Array() {
+		var backupUrls []string
+		for _, backupUrl := range item.Get("backupUrl").Array() {
+			backupUrls = append(backupUrls, backupUrl.String())
+		}
+		streams = append(streams, StreamVariant{
+			Quality:    qualityNames[item.Get("id").Int()],
+			Width:      item.Get("width").Int(),
+			Height:     item.Get("height").Int(),
+			Bitrate:    item.Get("bandwidth").Int(),
+			Codec:      item.Get("codecs").String(),
+			Container:  "m4s",
+			Url:        item.Get("baseUrl").String(),
+			BackupUrls: backupUrls,
+		})
+	}
+	return streams
+}
 
-	return info, nil
+// apiCodeKind 根据B站接口返回的错误码判断错误分类
+func (b bilibili) apiCodeKind(code int64) error {
+	switch code {
+	case -404, 62002, 62004: // 视频不存在, 稿件不可见, 稿件审核中
+		return ErrVideoNotFound
+	case -403, 62012: // 权限不足, 仅UP主自己可见
+		return ErrVideoPrivate
+	case -412, -509, -799: // 请求被拦截, 请求过于频繁
+		return ErrRateLimited
+	default:
+		return ErrLayoutChanged
+	}
+}
+
+// BiliBiliAvToBv av号转BV号, 如: 170001 => BV17x411w7KC
+func BiliBiliAvToBv(aid int64) string {
+	buf := []byte("BV1000000000")
+	idx := len(buf) - 1
+	for tmp := (biliBiliMaxAid | aid) ^ biliBiliXorCode; tmp > 0; tmp /= biliBiliBase {
+		buf[idx] = biliBiliAlphabet[tmp%biliBiliBase]
+		idx--
+	}
+	buf[3], buf[9] = buf[9], buf[3]
+	buf[4], buf[7] = buf[7], buf[4]
+	return string(buf)
+}
+
+// BiliBiliBvToAv BV号转av号, 如: BV17x411w7KC => 170001
+func BiliBiliBvToAv(bvid string) (int64, error) {
+	if len(bvid) != 12 || !strings.EqualFold(bvid[:3], "BV1") {
+		return 0, fmt.Errorf("BV号格式错误: %s", bvid)
+	}
+	buf := []byte(bvid)
+	buf[3], buf[9] = buf[9], buf[3]
+	buf[4], buf[7] = buf[7], buf[4]
+
+	var tmp int64
+	for _, c := range buf[3:] {
+		idx := strings.IndexByte(biliBiliAlphabet, c)
+		if idx < 0 {
+			return 0, fmt.Errorf("BV号格式错误: %s", bvid)
+		}
+		tmp = tmp*biliBiliBase + int64(idx)
+	}
+	return (tmp & biliBiliMaskCode) ^ biliBiliXorCode, nil
 }
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBiliBiliAvBv(t *testing.T) {
+	tests := []struct {
+		aid  int64
+		bvid string
+	}{
+		{170001, "BV17x411w7KC"},
+		{2, "BV1xx411c7mD"},
+		{1054803170, "BV1mH4y1u7UA"},
+	}
+	for _, tt := range tests {
+		if got := BiliBiliAvToBv(tt.aid); got != tt.bvid {
+			t.Errorf("BiliBiliAvToBv(%d) = %s, want %s", tt.aid, got, tt.bvid)
+		}
+		got, err := BiliBiliBvToAv(tt.bvid)
+		if err != nil || got != tt.aid {
+			t.Errorf("BiliBiliBvToAv(%s) = %d, %v, want %d", tt.bvid, got, err, tt.aid)
+		}
+	}
+
+	for _, bvid := range []string{"", "BV17x411w7K", "AV17x411w7KC", "BV17x411w7K0"} {
+		if _, err := BiliBiliBvToAv(bvid); err == nil {
+			t.Errorf("BiliBiliBvToAv(%q) should fail", bvid)
+		}
+	}
+}
+
+func TestBiliBili_toBvid(t *testing.T) {
+	tests := []struct {
+		videoId string
+		want    string
+	}{
+		{"BV17x411w7KC", "BV17x411w7KC"},
+		{"bv17x411w7KC", "BV17x411w7KC"},
+		{"av170001", "BV17x411w7KC"},
+		{"AV170001", "BV17x411w7KC"},
+		{"170001", "BV17x411w7KC"},
+	}
+	for _, tt := range tests {
+		got, err := bilibili{}.toBvid(tt.videoId)
+		if err != nil || got != tt.want {
+			t.Errorf("toBvid(%s) = %s, %v, want %s", tt.videoId, got, err, tt.want)
+		}
+	}
+
+	for _, videoId := range []string{"av", "av-1", "ep12345", "BV1"} {
+		if _, err := (bilibili{}).toBvid(videoId); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("toBvid(%s) error = %v, want %v", videoId, err, ErrInvalidInput)
+		}
+	}
+}
+
+func TestBiliBili_allPages(t *testing.T) {
+	f := loadFixtures(t)["bilibili/pages"]
+	if f == nil {
+		t.Fatal("fixture bilibili/pages not found")
+	}
+	got, err := f.run(context.Background(), newFixtureClient(t, f, WithAllPages(true), WithPreferredQuality("720p")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// p=2 的分P作为主视频
+	if want := "https://upos-sz-mirrorcos.bilivideo.com/upgcxcode/279787-1-100048.m4s"; got.VideoUrl != want {
+		t.Errorf("VideoUrl = %s, want %s", got.VideoUrl, want)
+	}
+	if len(got.Pages) != 3 {
+		t.Fatalf("len(Pages) = %d, want 3", len(got.Pages))
+	}
+	for i, want := range []VideoPage{
+		{Page: 1, Cid: "279786", Title: "第一集", Duration: 200, VideoUrl: "https://upos-sz-mirrorcos.bilivideo.com/upgcxcode/279786-1-100048.m4s"},
+		{Page: 2, Cid: "279787", Title: "第二集", Duration: 180, VideoUrl: "https://upos-sz-mirrorcos.bilivideo.com/upgcxcode/279787-1-100048.m4s"},
+		{Page: 3, Cid: "279788", Title: "第三集", Duration: 220, VideoUrl: "https://upos-sz-mirrorcos.bilivideo.com/upgcxcode/279788-1-100048.m4s"},
+	} {
+		page := got.Pages[i]
+		if page.Page != want.Page || page.Cid != want.Cid || page.Title != want.Title || page.Duration != want.Duration || page.VideoUrl != want.VideoUrl {
+			t.Errorf("Pages[%d] = %+v, want %+v", i, page, want)
+		}
+		if len(page.Streams) != 2 || len(page.MusicUrl) <= 0 {
+			t.Errorf("Pages[%d] streams = %d, music url = %s", i, len(page.Streams), page.MusicUrl)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Client 视频解析客户端
+// 所有渠道共享同一个 http 连接池, 可配置代理, UserAgent, cookie 和超时时间
+type Client struct {
+	httpClient       *http.Client
+	transport        http.RoundTripper
+	proxyUrl         string
+	userAgent        string
+	timeout          time.Duration
+	preferredQuality string
+	allPages         bool
+	batchConcurrency int
+	sourceUserAgents map[string]string
+	sourceCookieJars map[string]http.CookieJar
+
+	cookieMu      sync.RWMutex
+	sourceCookies map[string]string
+}
+
+// ClientOption Client 配置项
+type ClientOption func(c *Client) error
+
+// WithHttpClient 使用自定义的 http.Client, 其 Transport 会在所有请求间共享
+func WithHttpClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) error {
+		if httpClient == nil {
+			return errors.New("http client is nil")
+		}
+		c.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithTransport 使用自定义的 http.RoundTripper, 与 WithHttpClient 同时使用时与顺序无关
+// 替换的是 http.Client 副本的 Transport, 不修改调用方传入的 http.Client
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) error {
+		if transport == nil {
+			return errors.New("transport is nil")
+		}
+		c.transport = transport
+		return nil
+	}
+}
+
+// WithProxy 设置代理地址, 支持 http, https, socks5 代理, 例: socks5://127.0.0.1:1080
+// 仅在 Transport 为 *http.Transport 时生效
+func WithProxy(proxyUrl string) ClientOption {
+	return func(c *Client) error {
+		c.proxyUrl = proxyUrl
+		return nil
+	}
+}
+
+// WithUserAgent 设置默认 UserAgent, 未单独配置 UserAgent 的渠道使用该值
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) error {
+		c.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithSourceUserAgent 设置指定渠道的 UserAgent, 优先级高于渠道内置的 UserAgent
+func WithSourceUserAgent(source, userAgent string) ClientOption {
+	return func(c *Client) error {
+		c.sourceUserAgents[source] = userAgent
+		return nil
+	}
+}
+
+// WithSourceCookie 设置指定渠道请求时携带的 Cookie 请求头, 会替换渠道内置的 cookie
+func WithSourceCookie(source, cookie string) ClientOption {
+	return func(c *Client) error {
+		c.sourceCookies[source] = cookie
+		return nil
+	}
+}
+
+// WithSourceCookieJar 设置指定渠道的 cookie jar, 同一渠道的多次请求间共享 cookie
+func WithSourceCookieJar(source string, jar http.CookieJar) ClientOption {
+	return func(c *Client) error {
+		c.sourceCookieJars[source] = jar
+		return nil
+	}
+}
+
+// WithTimeout 设置单次 http 请求的超时时间
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// WithPreferredQuality 设置首选清晰度, 渠道返回多个清晰度时, VideoUrl 取最匹配的一条
+// 可取 QualityBest, QualityWorst, 清晰度名称(如: 高清), 或高度(如: 720p), 不设置时 VideoUrl 使用渠道默认的清晰度
+func WithPreferredQuality(quality string) ClientOption {
+	return func(c *Client) error {
+		c.preferredQuality = quality
+		return nil
+	}
+}
+
+// WithAllPages 多P视频(如B站分P)返回所有分P的信息和播放地址, 每个分P会多一次请求
+func WithAllPages(allPages bool) ClientOption {
+	return func(c *Client) error {
+		c.allPages = allPages
+		return nil
+	}
+}
+
+// WithBatchConcurrency 设置批量解析时同时解析的条数, 默认 DefaultBatchConcurrency
+func WithBatchConcurrency(concurrency int) ClientOption {
+	return func(c *Client) error {
+		if concurrency <= 0 {
+			return errors.New("batch concurrency must be positive")
+		}
+		c.batchConcurrency = concurrency
+		return nil
+	}
+}
+
+// NewClient 创建视频解析客户端
+func NewClient(opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		httpClient: &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		},
+		userAgent:        DefaultUserAgent,
+		batchConcurrency: DefaultBatchConcurrency,
+		sourceUserAgents: make(map[string]string),
+		sourceCookieJars: make(map[string]http.CookieJar),
+		sourceCookies:    make(map[string]string),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.transport != nil {
+		httpClient := *c.httpClient
+		httpClient.Transport = c.transport
+		c.httpClient = &httpClient
+	}
+	if len(c.proxyUrl) > 0 {
+		proxyUrl, err := url.Parse(c.proxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy url fail: %w", err)
+		}
+		transport, ok := c.httpClient.Transport.(*http.Transport)
+		if !ok {
+			return nil, errors.New("proxy requires transport to be *http.Transport")
+		}
+		// 复制一份 Transport, 避免修改调用方传入的 Transport
+		transport = transport.Clone()
+		transport.Proxy = http.ProxyURL(proxyUrl)
+		httpClient := *c.httpClient
+		httpClient.Transport = transport
+		c.httpClient = &httpClient
+	}
+
+	return c, nil
+}
+
+// SetSourceCookie 运行时替换指定渠道的 Cookie 请求头, 用于轮换 cookie
+func (c *Client) SetSourceCookie(source, cookie string) {
+	c.cookieMu.Lock()
+	defer c.cookieMu.Unlock()
+	c.sourceCookies[source] = cookie
+}
+
+// ParseVideoShareUrlByRegexp 将分享链接信息, 进行正则表达式匹配到分享链接后, 再解析视频信息
+func (c *Client) ParseVideoShareUrlByRegexp(ctx context.Context, shareMsg string) (*VideoParseInfo, error) {
+	return parseVideoShareUrlByRegexp(c.withContext(ctx), shareMsg)
+}
+
+// ParseVideoShareUrl 根据视频分享链接解析视频信息: 分享链接需是正常http链接
+func (c *Client) ParseVideoShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	return parseVideoShareUrl(c.withContext(ctx), shareUrl)
+}
+
+// ParseVideoId 根据视频id解析视频信息
+func (c *Client) ParseVideoId(ctx context.Context, source, videoId string) (*VideoParseInfo, error) {
+	return parseVideoId(c.withContext(ctx), source, videoId)
+}
+
+// BatchParseVideoId 根据视频id批量解析视频信息, 见 BatchParseVideoIdContext
+func (c *Client) BatchParseVideoId(ctx context.Context, source string, videoIds []string) (map[string]BatchParseItem, error) {
+	return batchParseVideoId(c.withContext(ctx), source, videoIds)
+}
+
+// BatchParseShareUrls 批量解析分享链接, 见 parser.BatchParseShareUrls
+func (c *Client) BatchParseShareUrls(ctx context.Context, shareUrls []string) <-chan BatchResult {
+	return batchParseShareUrls(c.withContext(ctx), shareUrls)
+}
+
+// RestyClient 返回指定渠道使用的 resty 客户端
+// 共享连接池, 并已设置该渠道的 UserAgent, cookie 和超时时间, 供自定义渠道的解析方法使用
+// 上游返回 404, 429, 5xx 状态码时, 请求返回对应分类的 *ParseError; 每次请求前等待 SetSourceRateLimit 设置的速率限制
+func (c *Client) RestyClient(source string) *resty.Client {
+	// 浅拷贝 http.Client, 共享 Transport, resty 对重定向策略等的修改不影响其他请求
+	httpClient := *c.httpClient
+	if jar, ok := c.sourceCookieJars[source]; ok {
+		httpClient.Jar = jar
+	} else {
+		// 与 resty.New 保持一致, 单次解析内的多个请求共享 cookie
+		httpClient.Jar, _ = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	}
+
+	client := resty.NewWithClient(&httpClient)
+	client.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+		return waitSourceRateLimit(req.Context(), source)
+	})
+	client.OnAfterResponse(checkResponseStatus)
+	client.SetHeader(HttpHeaderUserAgent, c.sourceUserAgent(source, ""))
+	if cookie := c.sourceCookie(source, ""); len(cookie) > 0 {
+		client.SetHeader(HttpHeaderCookie, cookie)
+	}
+	if c.timeout > 0 {
+		client.SetTimeout(c.timeout)
+	}
+
+	return client
+}
+
+// sourceUserAgent 获取渠道的 UserAgent: 渠道配置 > 渠道内置 > 默认配置
+func (c *Client) sourceUserAgent(source, builtin string) string {
+	if userAgent, ok := c.sourceUserAgents[source]; ok {
+		return userAgent
+	}
+	if len(builtin) > 0 {
+		return builtin
+	}
+	return c.userAgent
+}
+
+// sourceCookie 获取渠道的 Cookie 请求头: 渠道配置 > 渠道内置
+func (c *Client) sourceCookie(source, builtin string) string {
+	c.cookieMu.RLock()
+	defer c.cookieMu.RUnlock()
+	if cookie, ok := c.sourceCookies[source]; ok {
+		return cookie
+	}
+	return builtin
+}
+
+// clientCtxKey context 中保存 Client 的 key
+type clientCtxKey struct{}
+
+// withContext 将 Client 保存到 context 中, 供各渠道解析方法获取
+func (c *Client) withContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, clientCtxKey{}, c)
+}
+
+// ClientFromContext 获取当前解析使用的 Client, context 中没有时返回默认 Client
+func ClientFromContext(ctx context.Context) *Client {
+	if c, ok := ctx.Value(clientCtxKey{}).(*Client); ok {
+		return c
+	}
+	return DefaultClient()
+}
+
+// newRestyClient 获取当前解析使用的指定渠道 resty 客户端
+func newRestyClient(ctx context.Context, source string) *resty.Client {
+	return ClientFromContext(ctx).RestyClient(source)
+}
+
+// sourceUserAgent 获取当前解析使用的渠道 UserAgent, builtin 为渠道内置 UserAgent
+func sourceUserAgent(ctx context.Context, source, builtin string) string {
+	return ClientFromContext(ctx).sourceUserAgent(source, builtin)
+}
+
+// sourceCookie 获取当前解析使用的渠道 Cookie 请求头, builtin 为渠道内置 cookie
+func sourceCookie(ctx context.Context, source, builtin string) string {
+	return ClientFromContext(ctx).sourceCookie(source, builtin)
+}
+
+// parseAllPages 当前解析是否需要返回所有分P
+func parseAllPages(ctx context.Context) bool {
+	return ClientFromContext(ctx).allPages
+}
+
+// defaultClient 包级别解析方法使用的默认 Client
+var defaultClient atomic.Pointer[Client]
+
+func init() {
+	c, _ := NewClient()
+	defaultClient.Store(c)
+}
+
+// DefaultClient 返回包级别解析方法使用的默认 Client
+func DefaultClient() *Client {
+	return defaultClient.Load()
+}
+
+// SetDefaultClient 替换包级别解析方法使用的默认 Client
+func SetDefaultClient(c *Client) {
+	if c != nil {
+		defaultClient.Store(c)
+	}
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// proxyFetchParser 通过当前 Client 请求分享链接, 返回收到的响应内容
+type proxyFetchParser struct{}
+
+func (p proxyFetchParser) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	res, err := newRestyClient(ctx, "fake").R().SetContext(ctx).Get(shareUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &VideoParseInfo{Title: res.String()}, nil
+}
+
+func TestClient_options(t *testing.T) {
+	var gotHost, gotUserAgent, gotCookie string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 代理服务器收到的是完整的目标地址
+		gotHost = r.URL.Host
+		gotUserAgent = r.UserAgent()
+		gotCookie = r.Header.Get(HttpHeaderCookie)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+
+	if err := Register("fake", SourceInfo{
+		VideoShareUrlDomain: []string{"v.fake.example.com"},
+		VideoShareUrlParser: proxyFetchParser{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister("fake")
+
+	client, err := NewClient(
+		WithProxy(proxy.URL),
+		WithUserAgent("default-ua"),
+		WithSourceUserAgent("fake", "fake-ua"),
+		WithSourceCookie("fake", "a=1"),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	res, err := client.ParseVideoShareUrl(context.Background(), "http://v.fake.example.com/abc")
+	if err != nil {
+		t.Fatalf("ParseVideoShareUrl() error = %v", err)
+	}
+	if res.Title != "ok" || gotHost != "v.fake.example.com" {
+		t.Errorf("request not sent through proxy: title = %q, host = %q", res.Title, gotHost)
+	}
+	if gotUserAgent != "fake-ua" || gotCookie != "a=1" {
+		t.Errorf("got user agent = %q, cookie = %q", gotUserAgent, gotCookie)
+	}
+
+	client.SetSourceCookie("fake", "a=2")
+	if _, err = client.ParseVideoShareUrl(context.Background(), "http://v.fake.example.com/abc"); err != nil {
+		t.Fatal(err)
+	}
+	if gotCookie != "a=2" {
+		t.Errorf("got cookie after SetSourceCookie = %q", gotCookie)
+	}
+}
+
+func TestClient_sourceUserAgent(t *testing.T) {
+	client, err := NewClient(WithUserAgent("default-ua"), WithSourceUserAgent(SourceWeiBo, "weibo-ua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		source  string
+		builtin string
+		want    string
+	}{
+		{"渠道配置优先", SourceWeiBo, "builtin-ua", "weibo-ua"},
+		{"渠道内置", SourceHuYa, "builtin-ua", "builtin-ua"},
+		{"默认配置", SourceHuYa, "", "default-ua"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := client.sourceUserAgent(tt.source, tt.builtin); got != tt.want {
+				t.Errorf("sourceUserAgent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_optionsKeepHttpClient(t *testing.T) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	httpClient := &http.Client{Transport: transport}
+	client, err := NewClient(
+		WithHttpClient(httpClient),
+		WithTransport(http.DefaultTransport.(*http.Transport).Clone()),
+		WithProxy("http://127.0.0.1:1080"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.httpClient == httpClient {
+		t.Error("client shares the caller's http.Client")
+	}
+	if httpClient.Transport != transport {
+		t.Error("options modified the caller's http.Client")
+	}
+}
+
+func TestClient_transportOptionOrder(t *testing.T) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	httpClient := &http.Client{Timeout: time.Second}
+	client, err := NewClient(WithTransport(transport), WithHttpClient(httpClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.httpClient.Transport != transport || client.httpClient.Timeout != time.Second {
+		t.Errorf("http client = %+v, want transport from WithTransport", client.httpClient)
+	}
+	if httpClient.Transport != nil {
+		t.Error("WithTransport modified the caller's http.Client")
+	}
+}
@@ -1,38 +1,34 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type douPai struct {
 }
 
-func (d douPai) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (d douPai) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlInfo, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, errors.New("parse share url fail")
+		return nil, newParseError(SourceDouPai, "", ErrInvalidInput, errors.New("parse share url fail"))
 	}
 	if len(urlInfo.Query()["id"]) <= 0 {
-		return nil, errors.New("can not parse video id from share url")
+		return nil, newParseError(SourceDouPai, "", ErrInvalidInput, errors.New("can not parse video id from share url"))
 	}
 
-	return d.parseVideoID(urlInfo.Query()["id"][0])
+	return d.ParseVideoID(ctx, urlInfo.Query()["id"][0])
 }
 
-func (d douPai) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (d douPai) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := fmt.Sprintf("https://v2.doupai.cc/topic/%s.json", videoId)
-	headers := map[string]string{
-		HttpHeaderUserAgent: DefaultUserAgent,
-	}
-
-	client := resty.New()
+	client := newRestyClient(ctx, SourceDouPai)
 	res, err := client.R().
-		SetHeaders(headers).
+		SetContext(ctx).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
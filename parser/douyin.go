@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -61,14 +62,14 @@ func isValidDouyinUrl(videoUrl string) bool {
 	return false
 }
 
-func (d douYin) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (d douYin) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	var videoInfo *VideoParseInfo
 	var err error
 	maxRetries := 1000
 
 	// 尝试最多30次，直到获取到包含允许域名的视频链接
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		videoInfo, err = d.parseVideoIDOnce(videoId)
+		videoInfo, err = d.parseVideoIDOnce(ctx, videoId)
 		if err != nil {
 			// 如果解析出错，直接返回错误
 			return nil, err
@@ -86,26 +87,33 @@ func (d douYin) parseVideoID(videoId string) (*VideoParseInfo, error) {
 
 		// 如果不是最后一次尝试，则休眠一小段时间后重试
 		if attempt < maxRetries {
-			// 增加随机性，避免被限制
-			time.Sleep(time.Duration(100+rand.Intn(200)) * time.Millisecond)
+			// 增加随机性，避免被限制; ctx 取消或超时时立即退出重试
+			timer := time.NewTimer(time.Duration(100+rand.Intn(200)) * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
 		}
 	}
 
 	// 如果所有尝试都失败了，返回最后一次获取的结果和提示
 	if videoInfo != nil {
-		return videoInfo, fmt.Errorf("video URL does not contain any allowed domains after %d attempts", maxRetries)
+		return videoInfo, newParseError(SourceDouYin, videoId, ErrLayoutChanged, fmt.Errorf("video URL does not contain any allowed domains after %d attempts", maxRetries))
 	}
 
-	return nil, errors.New("failed to get valid video URL after 30 attempts")
+	return nil, newParseError(SourceDouYin, videoId, ErrLayoutChanged, errors.New("failed to get valid video URL"))
 }
 
 // parseVideoIDOnce 是原来的parseVideoID函数的实现，只尝试解析一次
-func (d douYin) parseVideoIDOnce(videoId string) (*VideoParseInfo, error) {
+func (d douYin) parseVideoIDOnce(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := fmt.Sprintf("https://www.iesdouyin.com/share/video/%s", videoId)
 
-	client := resty.New()
+	client := newRestyClient(ctx, SourceDouYin)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1 Edg/122.0.0.0").
+		SetContext(ctx).
+		SetHeader(HttpHeaderUserAgent, sourceUserAgent(ctx, SourceDouYin, "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1 Edg/122.0.0.0")).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
@@ -114,7 +122,7 @@ func (d douYin) parseVideoIDOnce(videoId string) (*VideoParseInfo, error) {
 	re := regexp.MustCompile(`window._ROUTER_DATA\s*=\s*(.*?)</script>`)
 	findRes := re.FindSubmatch(res.Body())
 	if len(findRes) < 2 {
-		return nil, errors.New("parse video json info from html fail")
+		return nil, newParseError(SourceDouYin, videoId, ErrLayoutChanged, errors.New("parse video json info from html fail"))
 	}
 
 	jsonBytes := bytes.TrimSpace(findRes[1])
@@ -126,30 +134,40 @@ func (d douYin) parseVideoIDOnce(videoId string) (*VideoParseInfo, error) {
 			fmt.Sprintf(`loaderData.video_(id)/page.videoInfoRes.filter_list.#(aweme_id=="%s")`, videoId),
 		)
 
-		return nil, fmt.Errorf(
+		filterReason := filterObj.Get("filter_reason").String()
+		return nil, newParseError(SourceDouYin, videoId, d.filterReasonKind(filterReason), fmt.Errorf(
 			"get video info fail: %s - %s",
-			filterObj.Get("filter_reason"),
+			filterReason,
 			filterObj.Get("detail_msg"),
-		)
+		))
 	}
 
-	// 获取图集图片地址
+	// 获取图集图片地址, url_list 无水印, download_url_list 带水印
+	// 实况照片的视频在 video 中, 格式与普通视频相同
 	imagesObjArr := data.Get("images").Array()
 	images := make([]string, 0, len(imagesObjArr))
+	var imageItems []ImageItem
 	for _, imageItem := range imagesObjArr {
 		imageUrl := imageItem.Get("url_list.0").String()
 		if len(imageUrl) > 0 {
 			images = append(images, imageUrl)
+			item := ImageItem{
+				Url:            imageItem.Get("download_url_list.0").String(),
+				NoWatermarkUrl: imageUrl,
+				LiveVideoUrl:   strings.ReplaceAll(imageItem.Get("video.play_addr.url_list.0").String(), "playwm", "play"),
+				Width:          imageItem.Get("width").Int(),
+				Height:         imageItem.Get("height").Int(),
+			}
+			if len(item.Url) <= 0 {
+				item.Url = imageUrl
+			}
+			imageItems = append(imageItems, item)
 		}
 	}
 
 	// 获取视频播放地址
 	videoUrl := data.Get("video.play_addr.url_list.0").String()
 	videoUrl = strings.ReplaceAll(videoUrl, "playwm", "play")
-	data.Get("video.play_addr.url_list").ForEach(func(key, value gjson.Result) bool {
-		fmt.Println(strings.ReplaceAll(value.String(), "playwm", "play"))
-		return true
-	})
 
 	// 如果图集地址不为空时，因为没有视频，上面抖音返回的视频地址无法访问，置空处理
 	if len(images) > 0 {
@@ -157,53 +175,103 @@ func (d douYin) parseVideoIDOnce(videoId string) (*VideoParseInfo, error) {
 	}
 
 	videoInfo := &VideoParseInfo{
-		Title:    data.Get("desc").String(),
-		VideoUrl: videoUrl,
-		MusicUrl: "",
-		CoverUrl: data.Get("video.cover.url_list.0").String(),
-		Images:   images,
+		Title:      data.Get("desc").String(),
+		VideoUrl:   videoUrl,
+		MusicUrl:   "",
+		CoverUrl:   data.Get("video.cover.url_list.0").String(),
+		Images:     images,
+		ImageItems: imageItems,
 	}
 	videoInfo.Author.Uid = data.Get("author.sec_uid").String()
 	videoInfo.Author.Name = data.Get("author.nickname").String()
 	videoInfo.Author.Avatar = data.Get("author.avatar_thumb.url_list.0").String()
+	videoInfo.VideoId = videoId
+	douYinItemMeta(videoInfo, data)
 
 	// 视频地址非空时，获取302重定向之后的视频地址
 	// 图集时，视频地址为空，不处理
 	if len(videoInfo.VideoUrl) > 0 {
-		d.getRedirectUrl(videoInfo)
+		d.getRedirectUrl(ctx, videoInfo)
+
+		// 抖音分享页只返回一种清晰度, url_list 中的其他地址为备用线路
+		var backupUrls []string
+		for _, item := range data.Get("video.play_addr.url_list").Array()[1:] {
+			backupUrls = append(backupUrls, strings.ReplaceAll(item.String(), "playwm", "play"))
+		}
+		videoInfo.Streams = []StreamVariant{{
+			Quality:    data.Get("video.ratio").String(),
+			Width:      data.Get("video.width").Int(),
+			Height:     data.Get("video.height").Int(),
+			Container:  "mp4",
+			Url:        videoInfo.VideoUrl,
+			BackupUrls: backupUrls,
+		}}
 	}
 
 	return videoInfo, nil
 }
 
-func (d douYin) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+// douYinItemMeta 从抖音作品数据中获取发布信息和互动数据, 西瓜视频的抖音分享页格式相同
+func douYinItemMeta(info *VideoParseInfo, data gjson.Result) {
+	info.Duration = millisToSeconds(data.Get("video.duration").Int())
+	info.PublishedAt = data.Get("create_time").Int()
+	for _, item := range data.Get("text_extra").Array() {
+		info.Tags = appendTags(info.Tags, item.Get("hashtag_name").String())
+	}
+	info.Music = newMusicInfo(
+		data.Get("music.title").String(),
+		data.Get("music.author").String(),
+		data.Get("music.play_url.url_list.0").String(),
+	)
+	info.Stats = newVideoStats(
+		data.Get("statistics.play_count").Int(),
+		data.Get("statistics.digg_count").Int(),
+		data.Get("statistics.comment_count").Int(),
+		data.Get("statistics.share_count").Int(),
+		data.Get("statistics.collect_count").Int(),
+	)
+}
+
+// filterReasonKind 根据 filter_reason 判断视频无法获取的原因, 如: status_self_see 仅作者可见
+func (d douYin) filterReasonKind(filterReason string) error {
+	switch {
+	case len(filterReason) <= 0:
+		return ErrLayoutChanged
+	case strings.Contains(filterReason, "self_see"), strings.Contains(filterReason, "friend"), strings.Contains(filterReason, "private"):
+		return ErrVideoPrivate
+	default:
+		return ErrVideoNotFound
+	}
+}
+
+func (d douYin) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlRes, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(SourceDouYin, "", ErrInvalidInput, err)
 	}
 
 	switch urlRes.Host {
 	case "www.iesdouyin.com", "www.douyin.com":
-		return d.parsePcShareUrl(shareUrl) // 解析电脑网页端链接
+		return d.parsePcShareUrl(ctx, shareUrl) // 解析电脑网页端链接
 	case "v.douyin.com":
-		return d.parseAppShareUrl(shareUrl) // 解析App分享链接
+		return d.parseAppShareUrl(ctx, shareUrl) // 解析App分享链接
 	}
 
-	return nil, fmt.Errorf("douyin not support this host: %s", urlRes.Host)
+	return nil, newParseError(SourceDouYin, "", ErrInvalidInput, fmt.Errorf("douyin not support this host: %s", urlRes.Host))
 }
 
-func (d douYin) parseAppShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (d douYin) parseAppShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	// 适配App分享链接类型:
 	// https://v.douyin.com/xxxxxx/
 
-	client := resty.New()
+	client := newRestyClient(ctx, SourceDouYin)
 	// disable redirects in the HTTP client, get params before redirects
 	client.SetRedirectPolicy(resty.NoRedirectPolicy())
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(shareUrl)
-	// 非 resty.ErrAutoRedirectDisabled 错误时，返回错误
-	if !errors.Is(err, resty.ErrAutoRedirectDisabled) {
+	// 未获取到跳转地址时，返回错误
+	if err = redirectError(SourceDouYin, err); err != nil {
 		return nil, err
 	}
 
@@ -217,18 +285,22 @@ func (d douYin) parseAppShareUrl(shareUrl string) (*VideoParseInfo, error) {
 		return nil, err
 	}
 	if len(videoId) <= 0 {
-		return nil, errors.New("parse video id from share url fail")
+		return nil, newParseError(SourceDouYin, "", ErrInvalidInput, errors.New("parse video id from share url fail"))
 	}
 
 	// 西瓜视频解析方式不一样
 	if strings.Contains(locationRes.Host, "ixigua.com") {
-		return xiGua{}.parseVideoID(videoId)
+		videoInfo, err := xiGua{}.ParseVideoID(ctx, videoId)
+		if videoInfo != nil {
+			videoInfo.Source = SourceXiGua
+		}
+		return videoInfo, err
 	}
 
-	return d.parseVideoID(videoId)
+	return d.ParseVideoID(ctx, videoId)
 }
 
-func (d douYin) parsePcShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (d douYin) parsePcShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	// 适配电脑网页端链接类型
 	// https://www.iesdouyin.com/share/video/xxxxxx/
 	// https://www.douyin.com/video/xxxxxx
@@ -236,12 +308,12 @@ func (d douYin) parsePcShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return d.parseVideoID(videoId)
+	return d.ParseVideoID(ctx, videoId)
 }
 
 func (d douYin) parseVideoIdFromPath(urlPath string) (string, error) {
 	if len(urlPath) <= 0 {
-		return "", errors.New("url path is empty")
+		return "", newParseError(SourceDouYin, "", ErrInvalidInput, errors.New("url path is empty"))
 	}
 
 	urlPath = strings.Trim(urlPath, "/")
@@ -252,15 +324,18 @@ func (d douYin) parseVideoIdFromPath(urlPath string) (string, error) {
 		return urlSplit[len(urlSplit)-1], nil
 	}
 
-	return "", errors.New("parse video id from path fail")
+	return "", newParseError(SourceDouYin, "", ErrInvalidInput, errors.New("parse video id from path fail"))
 }
 
-func (d douYin) getRedirectUrl(videoInfo *VideoParseInfo) {
-	client := resty.New()
+func (d douYin) getRedirectUrl(ctx context.Context, videoInfo *VideoParseInfo) {
+	client := newRestyClient(ctx, SourceDouYin)
 	client.SetRedirectPolicy(resty.NoRedirectPolicy())
 	res2, _ := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(videoInfo.VideoUrl)
+	if res2 == nil || res2.RawResponse == nil {
+		return
+	}
 	locationRes, _ := res2.RawResponse.Location()
 	if locationRes != nil {
 		(*videoInfo).VideoUrl = locationRes.String()
@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// 解析错误分类, 可通过 errors.Is 判断
+var (
+	ErrUnsupportedSource = errors.New("unsupported source")       // 不支持的渠道, 或渠道不支持该解析方式
+	ErrInvalidInput      = errors.New("invalid share url or id")  // 分享链接或视频id格式错误
+	ErrVideoNotFound     = errors.New("video not found")          // 视频不存在或已删除
+	ErrVideoPrivate      = errors.New("video is private")         // 视频仅作者可见或需要登录
+	ErrRateLimited       = errors.New("rate limited by upstream") // 请求过于频繁, 被上游限制
+	ErrLayoutChanged     = errors.New("upstream layout changed")  // 上游页面或接口结构变化, 无法提取视频信息
+	ErrNetwork           = errors.New("upstream network error")   // 网络错误或上游服务异常
+)
+
+// ParseError 解析错误, 携带渠道, 视频id和错误分类, 可通过 errors.As 获取
+type ParseError struct {
+	Source  string // 渠道
+	VideoId string // 视频id, 分享链接解析时可能为空
+	Kind    error  // 错误分类, 为上面定义的 Err* 之一, 未分类时为 nil
+	Err     error  // 原始错误
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Source)
+	if len(e.VideoId) > 0 {
+		b.WriteString(" [" + e.VideoId + "]")
+	}
+	if e.Kind != nil {
+		b.WriteString(": " + e.Kind.Error())
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap 同时返回错误分类和原始错误, errors.Is 可以匹配两者
+func (e *ParseError) Unwrap() []error {
+	errs := make([]error, 0, 2)
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// newParseError 创建解析错误
+func newParseError(source, videoId string, kind, err error) *ParseError {
+	return &ParseError{
+		Source:  source,
+		VideoId: videoId,
+		Kind:    kind,
+		Err:     err,
+	}
+}
+
+// wrapParseError 包装解析方法返回的错误, 补充渠道和视频id, 未分类的网络错误归类为 ErrNetwork
+// context 取消或超时不归类为 ErrNetwork, 调用方可通过 errors.Is 判断 context.Canceled, context.DeadlineExceeded
+func wrapParseError(source, videoId string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		if len(parseErr.Source) <= 0 {
+			parseErr.Source = source
+		}
+		if len(parseErr.VideoId) <= 0 {
+			parseErr.VideoId = videoId
+		}
+		return err
+	}
+
+	var kind error
+	var netErr net.Error
+	if errors.As(err, &netErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		kind = ErrNetwork
+	}
+	return newParseError(source, videoId, kind, err)
+}
+
+// checkResponseStatus resty 响应钩子, 将上游的异常状态码转换为对应分类的错误
+func checkResponseStatus(_ *resty.Client, res *resty.Response) error {
+	var kind error
+	switch code := res.StatusCode(); {
+	case code == http.StatusNotFound:
+		kind = ErrVideoNotFound
+	case code == http.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case code >= http.StatusInternalServerError:
+		kind = ErrNetwork
+	default:
+		return nil
+	}
+
+	return newParseError("", "", kind, fmt.Errorf("upstream %s response status: %s", res.Request.URL, res.Status()))
+}
+
+// redirectError 处理禁止重定向请求返回的错误, 返回 nil 表示已获取到跳转地址
+func redirectError(source string, err error) error {
+	if errors.Is(err, resty.ErrAutoRedirectDisabled) {
+		return nil
+	}
+	if err == nil {
+		return newParseError(source, "", ErrLayoutChanged, errors.New("share url did not redirect"))
+	}
+	return err
+}
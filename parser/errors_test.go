@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// statusParser 请求分享链接, 用于测试上游状态码的错误分类
+type statusParser struct{}
+
+func (s statusParser) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	_, err := newRestyClient(ctx, "fake").R().SetContext(ctx).Get(shareUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &VideoParseInfo{}, nil
+}
+
+func TestParseError(t *testing.T) {
+	cause := errors.New("status_self_see")
+	var err error = newParseError(SourceDouYin, "123", ErrVideoPrivate, cause)
+
+	if !errors.Is(err, ErrVideoPrivate) || !errors.Is(err, cause) || errors.Is(err, ErrVideoNotFound) {
+		t.Errorf("errors.Is() mismatch for %v", err)
+	}
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Source != SourceDouYin || parseErr.VideoId != "123" {
+		t.Errorf("errors.As() = %+v", parseErr)
+	}
+	if want := "douyin [123]: video is private: status_self_see"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestParseVideoShareUrl_errorKind(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/deleted":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	if err := Register("fake", SourceInfo{
+		VideoShareUrlDomain: []string{server.Listener.Addr().String()},
+		VideoShareUrlParser: statusParser{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister("fake")
+
+	tests := []struct {
+		name     string
+		shareUrl string
+		want     error
+	}{
+		{"限流", server.URL + "/limited", ErrRateLimited},
+		{"不存在", server.URL + "/deleted", ErrVideoNotFound},
+		{"上游异常", server.URL + "/broken", ErrNetwork},
+		{"未知渠道", "https://unknown.example.com/abc", ErrUnsupportedSource},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseVideoShareUrl(tt.shareUrl)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ParseVideoShareUrl() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVideoShareUrl_contextError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if err := Register("fake", SourceInfo{
+		VideoShareUrlDomain: []string{server.Listener.Addr().String()},
+		VideoShareUrlParser: statusParser{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister("fake")
+
+	// 已超时和已取消的 context 不归类为网络错误
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range []struct {
+		ctx  context.Context
+		want error
+	}{
+		{expired, context.DeadlineExceeded},
+		{canceled, context.Canceled},
+	} {
+		_, err := ParseVideoShareUrlContext(tt.ctx, server.URL+"/ok")
+		if !errors.Is(err, tt.want) || errors.Is(err, ErrNetwork) {
+			t.Errorf("ParseVideoShareUrlContext() error = %v, want %v", err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var updateFixtures = flag.Bool("update", false, "更新离线测试用例的期望结果 want.json")
+
+// fixtureUrlHeader 请求被转发到本地测试服务器时, 记录原始请求地址的请求头
+const fixtureUrlHeader = "X-Fixture-Url"
+
+// fixtureErrorKinds 用例中 want_kind 与错误分类的对应关系
+var fixtureErrorKinds = map[string]error{
+	"unsupported_source": ErrUnsupportedSource,
+	"invalid_input":      ErrInvalidInput,
+	"not_found":          ErrVideoNotFound,
+	"private":            ErrVideoPrivate,
+	"rate_limited":       ErrRateLimited,
+	"layout_changed":     ErrLayoutChanged,
+	"network":            ErrNetwork,
+}
+
+// fixture 离线测试用例: 上游请求的录制响应, 及待解析的分享链接或视频id
+// 期望的解析结果保存在同目录的 want.json 中
+type fixture struct {
+	ShareUrl  string            `json:"share_url,omitempty"` // 分享链接, 与 source + video_id 二选一
+	Source    string            `json:"source,omitempty"`
+	VideoId   string            `json:"video_id,omitempty"`
+	WantKind  string            `json:"want_kind,omitempty"` // 期望的错误分类, 为空时期望解析成功
+	Responses []fixtureResponse `json:"responses"`
+
+	dir  string
+	mu   sync.Mutex
+	used map[int]bool // 已返回过的录制响应
+}
+
+// fixtureResponse 单个上游请求的录制响应
+type fixtureResponse struct {
+	Method   string        `json:"method,omitempty"` // 默认 GET
+	Url      string        `json:"url"`              // 匹配 host + path, 及 url 中列出的 query 参数
+	Status   int           `json:"status,omitempty"` // 默认 200
+	Header   fixtureHeader `json:"header,omitempty"`
+	Body     string        `json:"body,omitempty"`
+	BodyFile string        `json:"body_file,omitempty"` // 响应内容文件, 相对用例目录
+}
+
+// fixtureHeader 响应头, json 中单个值可直接写字符串, 多个值写数组
+type fixtureHeader map[string][]string
+
+func (h fixtureHeader) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(h))
+	for key, values := range h {
+		if len(values) == 1 {
+			m[key] = values[0]
+		} else {
+			m[key] = values
+		}
+	}
+	return json.Marshal(m)
+}
+
+func (h *fixtureHeader) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*h = make(fixtureHeader, len(m))
+	for key, raw := range m {
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			(*h)[key] = []string{value}
+			continue
+		}
+		var values []string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return err
+		}
+		(*h)[key] = values
+	}
+	return nil
+}
+
+// loadFixtures 加载 testdata/fixtures/<source>/<case>/fixture.json 用例
+func loadFixtures(t *testing.T) map[string]*fixture {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*", "*", "fixture.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := make(map[string]*fixture, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &fixture{dir: filepath.Dir(path)}
+		if err = json.Unmarshal(content, f); err != nil {
+			t.Fatalf("parse %s fail: %v", path, err)
+		}
+		name, _ := filepath.Rel(filepath.Join("testdata", "fixtures"), f.dir)
+		fixtures[filepath.ToSlash(name)] = f
+	}
+
+	return fixtures
+}
+
+// match 查找与请求匹配的录制响应
+// 同一地址录制了多个响应时(如重试), 按录制顺序依次返回, 用完后重复返回最后一个
+func (f *fixture) match(method string, reqUrl *url.URL) *fixtureResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.used == nil {
+		f.used = make(map[int]bool)
+	}
+
+	last := -1
+	for i, res := range f.Responses {
+		resMethod := res.Method
+		if len(resMethod) <= 0 {
+			resMethod = http.MethodGet
+		}
+		resUrl, err := url.Parse(res.Url)
+		if err != nil || resMethod != method || resUrl.Host != reqUrl.Host {
+			continue
+		}
+		if strings.TrimSuffix(resUrl.Path, "/") != strings.TrimSuffix(reqUrl.Path, "/") {
+			continue
+		}
+
+		queryMatch := true
+		for key := range resUrl.Query() {
+			if resUrl.Query().Get(key) != reqUrl.Query().Get(key) {
+				queryMatch = false
+				break
+			}
+		}
+		if !queryMatch {
+			continue
+		}
+		last = i
+		if !f.used[i] {
+			f.used[i] = true
+			return &f.Responses[i]
+		}
+	}
+
+	if last < 0 {
+		return nil
+	}
+	return &f.Responses[last]
+}
+
+// ServeHTTP 根据原始请求地址返回录制的响应
+func (f *fixture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reqUrl, err := url.Parse(r.Header.Get(fixtureUrlHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := f.match(r.Method, reqUrl)
+	if res == nil {
+		http.Error(w, "fixture not found: "+r.Method+" "+reqUrl.String(), http.StatusNotImplemented)
+		return
+	}
+
+	body := []byte(res.Body)
+	if len(res.BodyFile) > 0 {
+		if body, err = os.ReadFile(filepath.Join(f.dir, res.BodyFile)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for key, values := range res.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	status := res.Status
+	if status <= 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// fixtureTransport 将所有上游请求转发到本地测试服务器
+type fixtureTransport struct {
+	server *httptest.Server
+}
+
+func (f fixtureTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(f.server.URL)
+	r = r.Clone(r.Context())
+	r.Header.Set(fixtureUrlHeader, r.URL.String())
+	r.URL.Scheme = target.Scheme
+	r.URL.Host = target.Host
+	r.Host = ""
+	return f.server.Client().Transport.RoundTrip(r)
+}
+
+// newFixtureServer 创建返回录制响应的本地测试服务器
+func newFixtureServer(t *testing.T, f *fixture) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newFixtureClient 创建请求全部由本地测试服务器响应的 Client
+func newFixtureClient(t *testing.T, f *fixture, opts ...ClientOption) *Client {
+	t.Helper()
+	opts = append([]ClientOption{WithTransport(fixtureTransport{server: newFixtureServer(t, f)})}, opts...)
+	client, err := NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// fixtureUrlRe 匹配解析结果中的资源地址域名
+var fixtureUrlRe = regexp.MustCompile(`"https?://([^/"]+)`)
+
+// run 执行用例中的解析
+func (f *fixture) run(ctx context.Context, client *Client) (*VideoParseInfo, error) {
+	if len(f.ShareUrl) > 0 {
+		return client.ParseVideoShareUrl(ctx, f.ShareUrl)
+	}
+	return client.ParseVideoId(ctx, f.Source, f.VideoId)
+}
+
+func TestParse_fixtures(t *testing.T) {
+	fixtures := loadFixtures(t)
+	for name, f := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			var (
+				got *VideoParseInfo
+				err error
+			)
+			if recordFixtures {
+				got, err = f.record(t)
+			} else {
+				got, err = f.run(context.Background(), newFixtureClient(t, f))
+			}
+
+			if len(f.WantKind) > 0 {
+				wantKind, ok := fixtureErrorKinds[f.WantKind]
+				if !ok {
+					t.Fatalf("unknown want_kind %q", f.WantKind)
+				}
+				if !errors.Is(err, wantKind) {
+					t.Errorf("parse error = %v, want %v", err, wantKind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse error = %v", err)
+			}
+
+			gotJson, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJson = append(gotJson, '\n')
+			wantPath := filepath.Join(f.dir, "want.json")
+			if *updateFixtures || recordFixtures {
+				if err = os.WriteFile(wantPath, gotJson, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			wantJson, err := os.ReadFile(wantPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(gotJson, wantJson) {
+				t.Errorf("parse result mismatch\ngot:\n%s\nwant:\n%s", gotJson, wantJson)
+			}
+
+			// 解析出的资源地址需在渠道的 MediaDomains 中, 否则无法通过 /video/stream 代理
+			source, _, _ := strings.Cut(name, "/")
+			sourceInfo, _ := getSourceInfo(source)
+			for _, match := range fixtureUrlRe.FindAllSubmatch(gotJson, -1) {
+				allowed := false
+				for _, domain := range sourceInfo.MediaDomains {
+					allowed = allowed || hostMatchDomain(string(match[1]), domain)
+				}
+				if !allowed {
+					t.Errorf("media host %s not in %s media domains", match[1], source)
+				}
+			}
+		})
+	}
+}
+
+// TestParse_fixturesCoverage 每个内置渠道至少要有一个离线测试用例
+func TestParse_fixturesCoverage(t *testing.T) {
+	fixtures := loadFixtures(t)
+	for _, item := range Sources() {
+		found := false
+		for name := range fixtures {
+			if strings.HasPrefix(name, item.Source+"/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("source %s has no fixture under testdata/fixtures", item.Source)
+		}
+	}
+}
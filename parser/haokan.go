@@ -1,32 +1,32 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"net/url"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type haoKan struct {
 }
 
-func (h haoKan) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (h haoKan) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlInfo, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, errors.New("parse share url fail")
+		return nil, newParseError(SourceHaoKan, "", ErrInvalidInput, errors.New("parse share url fail"))
 	}
 	if len(urlInfo.Query()["vid"]) <= 0 {
-		return nil, errors.New("can not parse video id from share url")
+		return nil, newParseError(SourceHaoKan, "", ErrInvalidInput, errors.New("can not parse video id from share url"))
 	}
-	return h.parseVideoID(urlInfo.Query()["vid"][0])
+	return h.ParseVideoID(ctx, urlInfo.Query()["vid"][0])
 }
 
-func (h haoKan) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (h haoKan) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://haokan.baidu.com/v?_format=json&vid=" + videoId
-	client := resty.New()
+	client := newRestyClient(ctx, SourceHaoKan)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
@@ -34,7 +34,7 @@ func (h haoKan) parseVideoID(videoId string) (*VideoParseInfo, error) {
 
 	// 接口返回错误
 	if gjson.GetBytes(res.Body(), "errno").Int() != 0 {
-		return nil, errors.New(gjson.GetBytes(res.Body(), "error").String())
+		return nil, newParseError(SourceHaoKan, videoId, ErrVideoNotFound, errors.New(gjson.GetBytes(res.Body(), "error").String()))
 	}
 
 	data := gjson.GetBytes(res.Body(), "data.apiData.curVideoMeta")
@@ -46,10 +46,14 @@ func (h haoKan) parseVideoID(videoId string) (*VideoParseInfo, error) {
 		Title:    title,
 		VideoUrl: videoUrl,
 		CoverUrl: cover,
+		Streams:  clarityStreams(data.Get("clarityUrl")),
 	}
 	parseRes.Author.Uid = data.Get("mth.mthid").String()
 	parseRes.Author.Avatar = data.Get("mth.author_photo").String()
 	parseRes.Author.Name = data.Get("mth.author_name").String()
+	parseRes.VideoId = videoId
+	parseRes.Duration = data.Get("duration").Int()
+	parseRes.Stats = newVideoStats(data.Get("playcnt").Int(), 0, 0, 0, 0)
 
 	return parseRes, nil
 }
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"context"
 	"errors"
 
 	"github.com/go-resty/resty/v2"
@@ -10,11 +11,11 @@ import (
 type huoShan struct {
 }
 
-func (h huoShan) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (h huoShan) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://share.huoshan.com/api/item/info?item_id=" + videoId
-	client := resty.New()
+	client := newRestyClient(ctx, SourceHuoShan)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
@@ -32,15 +33,15 @@ func (h huoShan) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	return parseRes, nil
 }
 
-func (h huoShan) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (h huoShan) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourceHuoShan)
 	// disable redirects in the HTTP client, get params before redirects
 	client.SetRedirectPolicy(resty.NoRedirectPolicy())
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(shareUrl)
-	// 非 resty.ErrAutoRedirectDisabled 错误时，返回错误
-	if !errors.Is(err, resty.ErrAutoRedirectDisabled) {
+	// 未获取到跳转地址时，返回错误
+	if err = redirectError(SourceHuoShan, err); err != nil {
 		return nil, err
 	}
 
@@ -51,8 +52,8 @@ func (h huoShan) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 
 	videoId := locationRes.Query().Get("item_id")
 	if len(videoId) <= 0 {
-		return nil, errors.New("parse video id from share url fail")
+		return nil, newParseError(SourceHuoShan, "", ErrInvalidInput, errors.New("parse video id from share url fail"))
 	}
 
-	return h.parseVideoID(videoId)
+	return h.ParseVideoID(ctx, videoId)
 }
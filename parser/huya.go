@@ -1,46 +1,59 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"regexp"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type huYa struct {
 }
 
-func (h huYa) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (h huYa) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	re := regexp.MustCompile(`\/(\d+).html`)
 
 	findRes := re.FindSubmatch([]byte(shareUrl))
 	if len(findRes) < 2 {
-		return nil, errors.New("parse video from share url fail")
+		return nil, newParseError(SourceHuYa, "", ErrInvalidInput, errors.New("parse video from share url fail"))
 	}
 
-	return h.parseVideoID(string(findRes[1]))
+	return h.ParseVideoID(ctx, string(findRes[1]))
 }
 
-func (h huYa) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (h huYa) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://liveapi.huya.com/moment/getMomentContent?videoId=" + videoId
 	headers := map[string]string{
-		HttpHeaderUserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.102 Safari/537.36",
+		HttpHeaderUserAgent: sourceUserAgent(ctx, SourceHuYa, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.102 Safari/537.36"),
 		HttpHeaderReferer:   "https://v.huya.com/",
 	}
 
-	client := resty.New()
+	client := newRestyClient(ctx, SourceHuYa)
 	res, err := client.R().
+		SetContext(ctx).
 		SetHeaders(headers).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
 	}
 	videoData := gjson.GetBytes(res.Body(), "data.moment.videoInfo")
+	var streams []StreamVariant
+	for _, item := range videoData.Get("definitions").Array() {
+		streams = append(streams, StreamVariant{
+			Quality:   item.Get("defName").String(),
+			Width:     item.Get("width").Int(),
+			Height:    item.Get("height").Int(),
+			Container: urlContainer(item.Get("url").String()),
+			Size:      item.Get("size").Int(),
+			Url:       item.Get("url").String(),
+		})
+	}
 	parseRes := &VideoParseInfo{
 		Title:    videoData.Get("videoTitle").String(),
 		VideoUrl: videoData.Get("definitions.0.url").String(),
 		CoverUrl: videoData.Get("videoCover").String(),
+		Streams:  streams,
 	}
 	parseRes.Author.Uid = videoData.Get("uid").String()
 	parseRes.Author.Avatar = videoData.Get("actorAvatarUrl").String()
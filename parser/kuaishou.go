@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -13,16 +14,16 @@ import (
 
 type kuaiShou struct{}
 
-func (k kuaiShou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (k kuaiShou) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourceKuaiShou)
 	// disable redirects in the HTTP client, get params before redirects
 	client.SetRedirectPolicy(resty.NoRedirectPolicy())
 	shareRes, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		SetHeader("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7").
 		Get(shareUrl)
-	// 非 resty.ErrAutoRedirectDisabled 错误时，返回错误
-	if !errors.Is(err, resty.ErrAutoRedirectDisabled) {
+	// 未获取到跳转地址时，返回错误
+	if err = redirectError(SourceKuaiShou, err); err != nil {
 		return nil, err
 	}
 
@@ -36,7 +37,7 @@ func (k kuaiShou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	locationUrl = strings.ReplaceAll(locationUrl, "/fw/long-video/", "/fw/photo/")
 
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		SetHeader("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7").
 		Get(locationUrl)
 	if err != nil {
@@ -46,7 +47,7 @@ func (k kuaiShou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	re := regexp.MustCompile(`window.INIT_STATE\s*=\s*(.*?)</script>`)
 	findRes := re.FindSubmatch(res.Body())
 	if len(findRes) < 2 {
-		return nil, errors.New("parse video json info from html fail")
+		return nil, newParseError(SourceKuaiShou, "", ErrLayoutChanged, errors.New("parse video json info from html fail"))
 	}
 	jsonBytes := bytes.TrimSpace(findRes[1])
 
@@ -67,11 +68,11 @@ func (k kuaiShou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	}
 
 	if !isFindInfo {
-		return nil, errors.New("parse video json fail")
+		return nil, newParseError(SourceKuaiShou, "", ErrLayoutChanged, errors.New("parse video json fail"))
 	}
 
 	if resultCode := videoRes.Get("result").Int(); resultCode != 1 {
-		return nil, fmt.Errorf("获取作品信息失败:result=%d", resultCode)
+		return nil, newParseError(SourceKuaiShou, "", ErrVideoNotFound, fmt.Errorf("获取作品信息失败:result=%d", resultCode))
 	}
 
 	data := videoRes.Get("photo")
@@ -85,21 +86,42 @@ func (k kuaiShou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	imageCdnHost := data.Get("ext_params.atlas.cdn.0").String()
 	imagesObjArr := data.Get("ext_params.atlas.list").Array()
 	images := make([]string, 0, len(imagesObjArr))
+	var imageItems []ImageItem
 	if len(imageCdnHost) > 0 && len(imagesObjArr) > 0 {
 		for _, imageItem := range imagesObjArr {
 			imageUrl := fmt.Sprintf("https://%s/%s", imageCdnHost, imageItem.String())
 			images = append(images, imageUrl)
+			imageItems = append(imageItems, ImageItem{Url: imageUrl})
 		}
 	}
 
 	parseRes := &VideoParseInfo{
-		Title:    title,
-		VideoUrl: videoUrl,
-		CoverUrl: cover,
-		Images:   images,
+		Title:      title,
+		VideoUrl:   videoUrl,
+		CoverUrl:   cover,
+		Images:     images,
+		ImageItems: imageItems,
 	}
 	parseRes.Author.Name = author
 	parseRes.Author.Avatar = avatar
 
+	// 时长和发布时间为毫秒
+	parseRes.VideoId = data.Get("photoId").String()
+	parseRes.Duration = millisToSeconds(data.Get("duration").Int())
+	parseRes.PublishedAt = data.Get("timestamp").Int() / 1000
+	parseRes.Tags = parseHashtags(title)
+	parseRes.Music = newMusicInfo(
+		data.Get("soundTrack.name").String(),
+		data.Get("soundTrack.artist").String(),
+		data.Get("soundTrack.audioUrls.0.url").String(),
+	)
+	parseRes.Stats = newVideoStats(
+		data.Get("viewCount").Int(),
+		data.Get("likeCount").Int(),
+		data.Get("commentCount").Int(),
+		data.Get("shareCount").Int(),
+		0,
+	)
+
 	return parseRes, nil
 }
@@ -1,28 +1,29 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
 	"strings"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type liShiPin struct {
 }
 
-func (l liShiPin) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (l liShiPin) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := fmt.Sprintf("https://www.pearvideo.com/videoStatus.jsp?contId=%s&mrd=%d", videoId, time.Now().Unix())
 	headers := map[string]string{
 		HttpHeaderReferer:   fmt.Sprintf("https://www.pearvideo.com/detail_%s", videoId),
-		HttpHeaderUserAgent: "Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/74.0.3729.169 Safari/537.36",
+		HttpHeaderUserAgent: sourceUserAgent(ctx, SourceLiShiPin, "Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/74.0.3729.169 Safari/537.36"),
 	}
 
-	client := resty.New()
+	client := newRestyClient(ctx, SourceLiShiPin)
 	res, err := client.R().
+		SetContext(ctx).
 		SetHeaders(headers).
 		Get(reqUrl)
 	if err != nil {
@@ -43,16 +44,16 @@ func (l liShiPin) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	return parseRes, nil
 }
 
-func (l liShiPin) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (l liShiPin) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlRes, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(SourceLiShiPin, "", ErrInvalidInput, err)
 	}
 
 	videoId := strings.ReplaceAll(urlRes.Path, "/detail_", "")
 	if len(videoId) <= 0 {
-		return nil, errors.New("parse video_id from share url fail")
+		return nil, newParseError(SourceLiShiPin, "", ErrInvalidInput, errors.New("parse video_id from share url fail"))
 	}
 
-	return l.parseVideoID(videoId)
+	return l.ParseVideoID(ctx, videoId)
 }
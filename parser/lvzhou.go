@@ -2,19 +2,19 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"regexp"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/go-resty/resty/v2"
 )
 
 type lvZhou struct {
 }
 
-func (l lvZhou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (l lvZhou) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourceLvZhou)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(shareUrl)
 	if err != nil {
 		return nil, err
@@ -44,7 +44,7 @@ func (l lvZhou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	return parseRes, nil
 }
 
-func (l lvZhou) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (l lvZhou) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	shareUrl := "https://m.oasis.weibo.cn/v1/h5/share?sid=" + videoId
-	return l.parseShareUrl(shareUrl)
+	return l.ParseShareUrl(ctx, shareUrl)
 }
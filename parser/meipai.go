@@ -2,22 +2,23 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/go-resty/resty/v2"
 )
 
 type meiPai struct {
 }
 
-func (m meiPai) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (m meiPai) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourceMeiPai)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.88 Safari/537.36").
+		SetContext(ctx).
+		SetHeader(HttpHeaderUserAgent, sourceUserAgent(ctx, SourceMeiPai, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.88 Safari/537.36")).
 		Get(shareUrl)
 	if err != nil {
 		return nil, err
@@ -29,11 +30,11 @@ func (m meiPai) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	}
 	videoBs64, ok := doc.Find("#shareMediaBtn").Attr("data-video")
 	if !ok {
-		return nil, errors.New("parse video base64 from share url fail")
+		return nil, newParseError(SourceMeiPai, "", ErrLayoutChanged, errors.New("parse video base64 from share url fail"))
 	}
 	videoUrl, err := m.parseVideoBs64(videoBs64)
 	if err != nil {
-		return nil, errors.New("parse video play url fail")
+		return nil, newParseError(SourceMeiPai, "", ErrLayoutChanged, errors.New("parse video play url fail"))
 	}
 	coverUrl, _ := doc.Find("#detailVideo img").Attr("src")
 	userName, _ := doc.Find(".detail-avatar").Attr("alt")
@@ -51,9 +52,9 @@ func (m meiPai) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 
 }
 
-func (m meiPai) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (m meiPai) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://www.meipai.com/video/" + videoId
-	return m.parseShareUrl(reqUrl)
+	return m.ParseShareUrl(ctx, reqUrl)
 }
 
 func (m meiPai) parseVideoBs64(videoBs64 string) (string, error) {
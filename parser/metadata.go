@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hashtagRe 文本中的话题标签, 如: #话题, 微博格式 #话题#, 小红书格式 #话题[话题]#
+var hashtagRe = regexp.MustCompile(`#([^#\s\[\]@]+)`)
+
+// parseHashtags 提取文本中的话题标签, 去掉 # 并去重, 保持出现的顺序
+func parseHashtags(text string) []string {
+	var tags []string
+	for _, match := range hashtagRe.FindAllStringSubmatch(text, -1) {
+		tags = appendTags(tags, match[1])
+	}
+	return tags
+}
+
+// appendTags 追加标签, 忽略空标签和已存在的标签
+func appendTags(tags []string, names ...string) []string {
+	for _, name := range names {
+		name = strings.TrimSpace(strings.Trim(name, "#"))
+		if len(name) <= 0 {
+			continue
+		}
+		exists := false
+		for _, tag := range tags {
+			exists = exists || tag == name
+		}
+		if !exists {
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+// millisToSeconds 毫秒转为秒, 四舍五入
+func millisToSeconds(ms int64) int64 {
+	return (ms + 500) / 1000
+}
+
+// countUnits 互动数据的中文单位
+var countUnits = map[string]float64{"万": 1e4, "w": 1e4, "W": 1e4, "亿": 1e8}
+
+// parseCount 解析带单位的数量, 如: 1234, 1,234, 1.2万, 10w+, 无法解析时返回0
+func parseCount(text string) int64 {
+	text = strings.TrimSuffix(strings.ReplaceAll(strings.TrimSpace(text), ",", ""), "+")
+	multiplier := float64(1)
+	for unit, value := range countUnits {
+		if strings.HasSuffix(text, unit) {
+			text, multiplier = strings.TrimSuffix(text, unit), value
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int64(n*multiplier + 0.5)
+}
+
+// newVideoStats 创建互动数据, 全部为0时视为渠道未返回, 返回 nil
+func newVideoStats(plays, likes, comments, shares, collects int64) *VideoStats {
+	if plays == 0 && likes == 0 && comments == 0 && shares == 0 && collects == 0 {
+		return nil
+	}
+	return &VideoStats{Plays: plays, Likes: likes, Comments: comments, Shares: shares, Collects: collects}
+}
+
+// newMusicInfo 创建背景音乐信息, 名称和地址都为空时返回 nil
+func newMusicInfo(title, author, url string) *MusicInfo {
+	if len(title) <= 0 && len(url) <= 0 {
+		return nil
+	}
+	return &MusicInfo{Title: title, Author: author, Url: url}
+}
+
+// fillSource 补充解析结果的渠道和视频id, 渠道解析方法已设置时不覆盖
+func fillSource(info *VideoParseInfo, source, videoId string) {
+	if info == nil {
+		return
+	}
+	if len(info.Source) <= 0 {
+		info.Source = source
+	}
+	if len(info.VideoId) <= 0 {
+		info.VideoId = videoId
+	}
+}
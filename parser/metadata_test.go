@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseHashtags(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want []string
+	}{
+		{text: "记录美好生活#峡谷天花板 #旅行", want: []string{"峡谷天花板", "旅行"}},
+		{text: "微博 #话题一##话题二# 内容", want: []string{"话题一", "话题二"}},
+		{text: "小红书 #穿搭[话题]# #穿搭[话题]#", want: []string{"穿搭"}},
+		{text: "没有话题 # 空格", want: nil},
+	} {
+		if got := parseHashtags(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHashtags(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func Test_parseCount(t *testing.T) {
+	for text, want := range map[string]int64{
+		"1234":  1234,
+		"1,234": 1234,
+		"1.2万":  12000,
+		"10w+":  100000,
+		"3亿":    300000000,
+		"":      0,
+		"很多":    0,
+	} {
+		if got := parseCount(text); got != want {
+			t.Errorf("parseCount(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
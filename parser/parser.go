@@ -1,98 +1,97 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"strings"
-	"sync"
 
 	"github.com/wujunwei928/parse-video/utils"
 )
 
 // ParseVideoShareUrlByRegexp 将分享链接信息, 进行正则表达式匹配到分享链接后, 再解析视频信息
 func ParseVideoShareUrlByRegexp(shareMsg string) (*VideoParseInfo, error) {
+	return ParseVideoShareUrlByRegexpContext(context.Background(), shareMsg)
+}
+
+// ParseVideoShareUrlByRegexpContext 同 ParseVideoShareUrlByRegexp, ctx 取消或超时时中断解析
+func ParseVideoShareUrlByRegexpContext(ctx context.Context, shareMsg string) (*VideoParseInfo, error) {
+	return DefaultClient().ParseVideoShareUrlByRegexp(ctx, shareMsg)
+}
+
+func parseVideoShareUrlByRegexp(ctx context.Context, shareMsg string) (*VideoParseInfo, error) {
 	videoShareUrl, err := utils.RegexpMatchUrlFromString(shareMsg)
 	if err != nil {
-		return nil, err
+		return nil, newParseError("", "", ErrInvalidInput, err)
 	}
 
-	return ParseVideoShareUrl(videoShareUrl)
+	return parseVideoShareUrl(ctx, videoShareUrl)
 }
 
 // ParseVideoShareUrl 根据视频分享链接解析视频信息: 分享链接需是正常http链接
 func ParseVideoShareUrl(shareUrl string) (*VideoParseInfo, error) {
+	return ParseVideoShareUrlContext(context.Background(), shareUrl)
+}
+
+// ParseVideoShareUrlContext 同 ParseVideoShareUrl, ctx 取消或超时时中断所有进行中的http请求和重试
+func ParseVideoShareUrlContext(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	return DefaultClient().ParseVideoShareUrl(ctx, shareUrl)
+}
+
+func parseVideoShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	// 根据分享url判断source
-	source := ""
-	for itemSource, itemSourceInfo := range videoSourceInfoMapping {
-		for _, itemUrlDomain := range itemSourceInfo.VideoShareUrlDomain {
-			if strings.Contains(shareUrl, itemUrlDomain) {
-				source = itemSource
-				break
-			}
-		}
-		if len(source) > 0 {
-			break
-		}
-	}
+	source, sourceInfo, ok := matchShareUrlSource(shareUrl)
 
 	// 没有找到对应source
-	if len(source) <= 0 {
-		return nil, fmt.Errorf("share url [%s] not have source config", shareUrl)
+	if !ok {
+		return nil, newParseError("", "", ErrUnsupportedSource, fmt.Errorf("share url [%s] not have source config", shareUrl))
 	}
 
 	// 没有对应的视频链接解析方法
-	urlParser := videoSourceInfoMapping[source].VideoShareUrlParser
+	urlParser := sourceInfo.VideoShareUrlParser
 	if urlParser == nil {
-		return nil, fmt.Errorf("source %s has no video share url parser", source)
+		return nil, newParseError(source, "", ErrUnsupportedSource, errors.New("source has no video share url parser"))
 	}
 
-	return urlParser.parseShareUrl(shareUrl)
+	parseInfo, err := urlParser.ParseShareUrl(ctx, shareUrl)
+	fillSource(parseInfo, source, "")
+	ClientFromContext(ctx).applyPreferredQuality(parseInfo)
+	return parseInfo, wrapParseError(source, "", err)
 }
 
 // ParseVideoId 根据视频id解析视频信息
 func ParseVideoId(source, videoId string) (*VideoParseInfo, error) {
+	return ParseVideoIdContext(context.Background(), source, videoId)
+}
+
+// ParseVideoIdContext 同 ParseVideoId, ctx 取消或超时时中断所有进行中的http请求和重试
+func ParseVideoIdContext(ctx context.Context, source, videoId string) (*VideoParseInfo, error) {
+	return DefaultClient().ParseVideoId(ctx, source, videoId)
+}
+
+func parseVideoId(ctx context.Context, source, videoId string) (*VideoParseInfo, error) {
 	if len(videoId) <= 0 || len(source) <= 0 {
-		return nil, errors.New("video id or source is empty")
+		return nil, newParseError(source, videoId, ErrInvalidInput, errors.New("video id or source is empty"))
 	}
 
-	idParser := videoSourceInfoMapping[source].VideoIdParser
+	sourceInfo, _ := getSourceInfo(source)
+	idParser := sourceInfo.VideoIdParser
 	if idParser == nil {
-		return nil, fmt.Errorf("source %s has no video id parser", source)
+		return nil, newParseError(source, videoId, ErrUnsupportedSource, errors.New("source has no video id parser"))
 	}
 
-	return idParser.parseVideoID(videoId)
+	parseInfo, err := idParser.ParseVideoID(ctx, videoId)
+	fillSource(parseInfo, source, videoId)
+	ClientFromContext(ctx).applyPreferredQuality(parseInfo)
+	return parseInfo, wrapParseError(source, videoId, err)
 }
 
-// BatchParseVideoId 根据视频id批量解析视频信息
+// BatchParseVideoId 根据视频id批量解析视频信息, 同时最多解析 DefaultBatchConcurrency 条, 重复的id只解析一次
 func BatchParseVideoId(source string, videoIds []string) (map[string]BatchParseItem, error) {
-	if len(videoIds) <= 0 || len(source) <= 0 {
-		return nil, errors.New("videos id or source is empty")
-	}
-
-	idParser := videoSourceInfoMapping[source].VideoIdParser
-	if idParser == nil {
-		return nil, fmt.Errorf("source %s has no video id parser", source)
-	}
-
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	parseMap := make(map[string]BatchParseItem, len(videoIds))
-	for _, v := range videoIds {
-		wg.Add(1)
-		videoId := v
-		go func(videoId string) {
-			defer wg.Done()
-
-			parseInfo, parseErr := ParseVideoId(source, videoId)
-			mu.Lock()
-			parseMap[videoId] = BatchParseItem{
-				ParseInfo: parseInfo,
-				Error:     parseErr,
-			}
-			mu.Unlock()
-		}(videoId)
-	}
-	wg.Wait()
+	return BatchParseVideoIdContext(context.Background(), source, videoIds)
+}
 
-	return parseMap, nil
+// BatchParseVideoIdContext 同 BatchParseVideoId, ctx 会传递给每一条解析
+// ctx 取消时不再开始新的解析, 返回已完成的部分结果和 ctx.Err()
+func BatchParseVideoIdContext(ctx context.Context, source string, videoIds []string) (map[string]BatchParseItem, error) {
+	return DefaultClient().BatchParseVideoId(ctx, source, videoIds)
 }
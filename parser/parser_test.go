@@ -0,0 +1,17 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseVideoIdContext_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ParseVideoIdContext(ctx, SourceDouYin, "7329354490828623130")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ParseVideoIdContext() error = %v, want context.Canceled", err)
+	}
+}
@@ -1,27 +1,28 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"net/url"
 	"strings"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type piPiGaoXiao struct {
 }
 
-func (p piPiGaoXiao) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (p piPiGaoXiao) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://share.ippzone.com/ppapi/share/fetch_content"
 	headers := map[string]string{
 		HttpHeaderReferer:   reqUrl,
-		HttpHeaderUserAgent: "Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/74.0.3729.169 Safari/537.36",
+		HttpHeaderUserAgent: sourceUserAgent(ctx, SourcePiPiGaoXiao, "Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/74.0.3729.169 Safari/537.36"),
 	}
 	postData := "{\"pid\":" + videoId + ",\"type\":\"post\",\"mid\":null}"
 
-	client := resty.New()
+	client := newRestyClient(ctx, SourcePiPiGaoXiao)
 	res, err := client.R().
+		SetContext(ctx).
 		SetHeaders(headers).
 		SetBody([]byte(postData)).
 		Post(reqUrl)
@@ -32,7 +33,7 @@ func (p piPiGaoXiao) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	// 接口返回错误
 	apiErr := gjson.GetBytes(res.Body(), "msg")
 	if apiErr.Exists() {
-		return nil, errors.New(apiErr.String())
+		return nil, newParseError(SourcePiPiGaoXiao, videoId, ErrVideoNotFound, errors.New(apiErr.String()))
 	}
 
 	data := gjson.GetBytes(res.Body(), "data.post")
@@ -50,16 +51,16 @@ func (p piPiGaoXiao) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	return parseRes, nil
 }
 
-func (p piPiGaoXiao) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (p piPiGaoXiao) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlRes, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(SourcePiPiGaoXiao, "", ErrInvalidInput, err)
 	}
 
 	videoId := strings.ReplaceAll(urlRes.Path, "/pp/post/", "")
 	if len(videoId) <= 0 {
-		return nil, errors.New("parse video_id from share url fail")
+		return nil, newParseError(SourcePiPiGaoXiao, "", ErrInvalidInput, errors.New("parse video_id from share url fail"))
 	}
 
-	return p.parseVideoID(videoId)
+	return p.ParseVideoID(ctx, videoId)
 }
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -11,11 +12,11 @@ import (
 type piPiXia struct {
 }
 
-func (p piPiXia) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (p piPiXia) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://h5.pipix.com/bds/webapi/item/detail/?item_id=" + videoId
-	client := resty.New()
+	client := newRestyClient(ctx, SourcePiPiXia)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
@@ -27,10 +28,16 @@ func (p piPiXia) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	// 获取图集图片地址
 	imagesObjArr := data.Get("note.multi_image").Array()
 	images := make([]string, 0, len(imagesObjArr))
+	var imageItems []ImageItem
 	for _, imageItem := range imagesObjArr {
 		imageUrl := imageItem.Get("url_list.0.url").String()
 		if len(imageUrl) > 0 {
 			images = append(images, imageUrl)
+			imageItems = append(imageItems, ImageItem{
+				Url:    imageUrl,
+				Width:  imageItem.Get("width").Int(),
+				Height: imageItem.Get("height").Int(),
+			})
 		}
 	}
 
@@ -57,19 +64,30 @@ func (p piPiXia) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	parseRes.Author.Name = author
 	parseRes.Author.Avatar = avatar
 	parseRes.Images = images
+	parseRes.ImageItems = imageItems
+	parseRes.VideoId = videoId
+	parseRes.Duration = int64(data.Get("video.duration").Float() + 0.5)
+	parseRes.PublishedAt = data.Get("create_time").Int()
+	parseRes.Stats = newVideoStats(
+		data.Get("stats.play_count").Int(),
+		data.Get("stats.like_count").Int(),
+		data.Get("stats.comment_count").Int(),
+		data.Get("stats.share_count").Int(),
+		0,
+	)
 
 	return parseRes, nil
 }
 
-func (p piPiXia) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (p piPiXia) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourcePiPiXia)
 	// disable redirects in the HTTP client, get params before redirects
 	client.SetRedirectPolicy(resty.NoRedirectPolicy())
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(shareUrl)
-	// 非 resty.ErrAutoRedirectDisabled 错误时，返回错误
-	if !errors.Is(err, resty.ErrAutoRedirectDisabled) {
+	// 未获取到跳转地址时，返回错误
+	if err = redirectError(SourcePiPiXia, err); err != nil {
 		return nil, err
 	}
 
@@ -80,8 +98,8 @@ func (p piPiXia) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 
 	videoId := strings.ReplaceAll(strings.Trim(locationRes.Path, "/"), "item/", "")
 	if len(videoId) <= 0 {
-		return nil, errors.New("parse video id from share url fail")
+		return nil, newParseError(SourcePiPiXia, "", ErrInvalidInput, errors.New("parse video id from share url fail"))
 	}
 
-	return p.parseVideoID(videoId)
+	return p.ParseVideoID(ctx, videoId)
 }
@@ -1,34 +1,34 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"net/url"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type quanMin struct{}
 
-func (q quanMin) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (q quanMin) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlRes, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(SourceQuanMin, "", ErrInvalidInput, err)
 	}
 
 	videoId := urlRes.Query().Get("vid")
 	if len(videoId) <= 0 {
-		return nil, errors.New("parse video_id from share url fail")
+		return nil, newParseError(SourceQuanMin, "", ErrInvalidInput, errors.New("parse video_id from share url fail"))
 	}
 
-	return q.parseVideoID(videoId)
+	return q.ParseVideoID(ctx, videoId)
 }
 
-func (q quanMin) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (q quanMin) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://quanmin.hao222.com/wise/growth/api/sv/immerse?source=share-h5&pd=qm_share_mvideo&_format=json&vid=" + videoId
-	client := resty.New()
+	client := newRestyClient(ctx, SourceQuanMin)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
@@ -36,12 +36,12 @@ func (q quanMin) parseVideoID(videoId string) (*VideoParseInfo, error) {
 
 	// 接口返回错误
 	if gjson.GetBytes(res.Body(), "errno").Int() != 0 {
-		return nil, errors.New(gjson.GetBytes(res.Body(), "error").String())
+		return nil, newParseError(SourceQuanMin, videoId, ErrVideoNotFound, errors.New(gjson.GetBytes(res.Body(), "error").String()))
 	}
 	// 视频状态错误
 	metaStatusText := gjson.GetBytes(res.Body(), "data.meta.statusText").String()
 	if len(metaStatusText) > 0 {
-		return nil, errors.New(metaStatusText)
+		return nil, newParseError(SourceQuanMin, videoId, ErrVideoNotFound, errors.New(metaStatusText))
 	}
 
 	data := gjson.GetBytes(res.Body(), "data")
@@ -59,6 +59,7 @@ func (q quanMin) parseVideoID(videoId string) (*VideoParseInfo, error) {
 		Title:    title,
 		VideoUrl: videoUrl,
 		CoverUrl: cover,
+		Streams:  clarityStreams(data.Get("meta.video_info.clarityUrl")),
 	}
 	parseRes.Author.Uid = data.Get("author.id").String()
 	parseRes.Author.Name = author
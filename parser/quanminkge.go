@@ -1,34 +1,35 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"net/url"
 	"regexp"
 	"strings"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type quanMinKGe struct {
 }
 
-func (q quanMinKGe) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (q quanMinKGe) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlInfo, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, errors.New("parse share url fail")
+		return nil, newParseError(SourceQuanMinKGe, "", ErrInvalidInput, errors.New("parse share url fail"))
 	}
 	if len(urlInfo.Query()["s"]) <= 0 {
-		return nil, errors.New("can not parse video id from share url")
+		return nil, newParseError(SourceQuanMinKGe, "", ErrInvalidInput, errors.New("can not parse video id from share url"))
 	}
-	return q.parseVideoID(urlInfo.Query()["s"][0])
+	return q.ParseVideoID(ctx, urlInfo.Query()["s"][0])
 }
 
-func (q quanMinKGe) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (q quanMinKGe) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://kg.qq.com/node/play?s=" + videoId
-	client := resty.New()
+	client := newRestyClient(ctx, SourceQuanMinKGe)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/104.0.5112.102 Safari/537.36 Edg/104.0.1293.70").
+		SetContext(ctx).
+		SetHeader(HttpHeaderUserAgent, sourceUserAgent(ctx, SourceQuanMinKGe, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/104.0.5112.102 Safari/537.36 Edg/104.0.1293.70")).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
@@ -37,7 +38,7 @@ func (q quanMinKGe) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	re := regexp.MustCompile(`window.__DATA__ = (.*?);`)
 	findRes := re.FindSubmatch(res.Body())
 	if len(findRes) < 2 {
-		return nil, errors.New("parse video json info from html fail")
+		return nil, newParseError(SourceQuanMinKGe, videoId, ErrLayoutChanged, errors.New("parse video json info from html fail"))
 	}
 
 	data := gjson.GetBytes([]byte(strings.TrimSpace(string(findRes[1]))), "detail")
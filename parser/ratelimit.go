@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// 渠道请求上游的速率限制, 进程内所有 Client 和所有解析共享
+var (
+	rateLimitMu        sync.RWMutex
+	sourceRateLimiters = make(map[string]*rate.Limiter)
+)
+
+// SetSourceRateLimit 限制渠道请求上游的速率, 令牌桶算法: 每秒生成 perSecond 个令牌, 最多积攒 burst 个
+// 每次 http 请求(包括重试)消耗一个令牌, 没有令牌时等待, 进程内所有 Client 共享; perSecond <= 0 时取消限制
+func SetSourceRateLimit(source string, perSecond float64, burst int) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	if perSecond <= 0 {
+		delete(sourceRateLimiters, source)
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	if limiter, ok := sourceRateLimiters[source]; ok {
+		limiter.SetLimit(rate.Limit(perSecond))
+		limiter.SetBurst(burst)
+		return
+	}
+	sourceRateLimiters[source] = rate.NewLimiter(rate.Limit(perSecond), burst)
+}
+
+// waitSourceRateLimit 等待渠道的请求令牌, 未设置限制时直接返回, ctx 取消或等待会超过 ctx 的截止时间时返回错误
+func waitSourceRateLimit(ctx context.Context, source string) error {
+	rateLimitMu.RLock()
+	limiter, ok := sourceRateLimiters[source]
+	rateLimitMu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// 等待令牌的时间会超过截止时间, 按超时处理
+		return fmt.Errorf("%s rate limit: %v: %w", source, err, context.DeadlineExceeded)
+	}
+	return nil
+}
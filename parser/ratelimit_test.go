@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetSourceRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	const source = "fake_rate"
+	SetSourceRateLimit(source, 50, 2)
+	defer SetSourceRateLimit(source, 0, 0)
+
+	// 两个令牌可以立即使用, 之后每 20ms 一个
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := newRestyClient(context.Background(), source).R().Get(server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("5 requests took %s, want about 60ms", elapsed)
+	}
+
+	// 等待令牌会超过截止时间时直接返回
+	const slowSource = "fake_rate_slow"
+	SetSourceRateLimit(slowSource, 0.1, 1)
+	defer SetSourceRateLimit(slowSource, 0, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client := newRestyClient(ctx, slowSource)
+	if _, err := client.R().SetContext(ctx).Get(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.R().SetContext(ctx).Get(server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// 取消限制后不再等待
+	SetSourceRateLimit(slowSource, 0, 0)
+	if _, err := client.R().SetContext(ctx).Get(server.URL); err != nil {
+		t.Errorf("error = %v after removing rate limit", err)
+	}
+}
@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// recordFixtures 设置环境变量 PARSE_VIDEO_RECORD=1 时, 离线测试用例改为请求真实上游, 并将响应录制到 fixture.json
+var recordFixtures = os.Getenv("PARSE_VIDEO_RECORD") == "1"
+
+// fixtureRecordHeaders 录制时保留的响应头, 其余响应头(Date, Server 等)每次请求都会变化, 不录制
+var fixtureRecordHeaders = []string{"Location", "Content-Type", "Content-Encoding", "Set-Cookie"}
+
+// fixtureVolatileParams 录制时去掉的 query 参数, 这些参数每次请求都会变化(时间戳等), 回放时不参与匹配
+var fixtureVolatileParams = []string{"mrd"}
+
+// fixtureRecorder 录制上游请求响应的 http.RoundTripper
+type fixtureRecorder struct {
+	transport http.RoundTripper
+
+	mu        sync.Mutex
+	responses []fixtureResponse
+	bodies    [][]byte
+}
+
+func (r *fixtureRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	reqUrl := *req.URL
+	query := reqUrl.Query()
+	for _, key := range fixtureVolatileParams {
+		query.Del(key)
+	}
+	reqUrl.RawQuery = query.Encode()
+
+	header := make(fixtureHeader)
+	for _, key := range fixtureRecordHeaders {
+		if values := res.Header.Values(key); len(values) > 0 {
+			header[key] = append([]string(nil), values...)
+		}
+	}
+	if cookies, ok := header["Set-Cookie"]; ok {
+		for i, cookie := range cookies {
+			cookies[i] = redactSetCookie(cookie)
+		}
+	}
+	if len(header) <= 0 {
+		header = nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, fixtureResponse{
+		Method: req.Method,
+		Url:    reqUrl.String(),
+		Status: res.StatusCode,
+		Header: header,
+	})
+	r.bodies = append(r.bodies, body)
+
+	return res, nil
+}
+
+// redactSetCookie 隐藏 Set-Cookie 中的 cookie 值, 保留名称和属性
+func redactSetCookie(cookie string) string {
+	pair, attrs, _ := strings.Cut(cookie, ";")
+	name, _, _ := strings.Cut(pair, "=")
+	redacted := strings.TrimSpace(name) + "=REDACTED"
+	if len(attrs) > 0 {
+		redacted += ";" + attrs
+	}
+	return redacted
+}
+
+// record 请求真实上游执行用例中的解析, 并将所有请求的响应写入 fixture.json
+// 请求头中的 cookie 不会被录制, 响应中的 Set-Cookie 值会被隐藏
+func (f *fixture) record(t *testing.T) (*VideoParseInfo, error) {
+	t.Helper()
+	recorder := &fixtureRecorder{transport: http.DefaultTransport.(*http.Transport).Clone()}
+	client, err := NewClient(WithTransport(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, parseErr := f.run(context.Background(), client)
+	// 网络错误时保留原有录制内容, 避免离线时误覆盖
+	if errors.Is(parseErr, ErrNetwork) || len(recorder.responses) <= 0 {
+		t.Fatalf("record fail, fixture not updated: %v", parseErr)
+	}
+
+	// 删除上次录制的响应内容文件
+	for _, res := range f.Responses {
+		if len(res.BodyFile) > 0 {
+			_ = os.Remove(filepath.Join(f.dir, res.BodyFile))
+		}
+	}
+
+	f.Responses = recorder.responses
+	for i, body := range recorder.bodies {
+		res := &f.Responses[i]
+		if res.Method == http.MethodGet {
+			res.Method = ""
+		}
+		if res.Status == http.StatusOK {
+			res.Status = 0
+		}
+
+		contentType := strings.Join(res.Header["Content-Type"], ";")
+		switch {
+		case len(body) <= 0:
+		case !utf8.Valid(body):
+			res.BodyFile = fmt.Sprintf("response_%d.bin", i)
+		case strings.Contains(contentType, "html"):
+			res.BodyFile = fmt.Sprintf("response_%d.html", i)
+		default:
+			res.Body = string(body)
+		}
+		if len(res.BodyFile) > 0 {
+			if err = os.WriteFile(filepath.Join(f.dir, res.BodyFile), body, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(f.dir, "fixture.json"), append(content, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("recorded %d responses to %s", len(f.Responses), f.dir)
+
+	return got, parseErr
+}
+
+func TestRedactSetCookie(t *testing.T) {
+	tests := []struct {
+		cookie string
+		want   string
+	}{
+		{"ttwid=1%7Cabc; Path=/; Domain=douyin.com; HttpOnly", "ttwid=REDACTED; Path=/; Domain=douyin.com; HttpOnly"},
+		{"did=web_123", "did=REDACTED"},
+		{" a1 = x=y ;Secure", "a1=REDACTED;Secure"},
+	}
+	for _, tt := range tests {
+		if got := redactSetCookie(tt.cookie); got != tt.want {
+			t.Errorf("redactSetCookie(%q) = %q, want %q", tt.cookie, got, tt.want)
+		}
+	}
+}
+
+func TestFixtureRecorder(t *testing.T) {
+	f := &fixture{Responses: []fixtureResponse{
+		{Url: "https://www.pearvideo.com/videoStatus.jsp?contId=1", Header: fixtureHeader{
+			"Content-Type": {"application/json"},
+			"Set-Cookie":   {"JSESSIONID=abc; Path=/", "PEAR_UUID=def"},
+			"Date":         {"Mon, 01 Jan 2024 00:00:00 GMT"},
+		}, Body: `{"resultCode":"1"}`},
+	}}
+	recorder := &fixtureRecorder{transport: fixtureTransport{server: newFixtureServer(t, f)}}
+	client := &http.Client{Transport: recorder}
+
+	res, err := client.Get("https://www.pearvideo.com/videoStatus.jsp?contId=1&mrd=1700000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if string(body) != `{"resultCode":"1"}` {
+		t.Errorf("body = %s", body)
+	}
+
+	if len(recorder.responses) != 1 {
+		t.Fatalf("recorded %d responses, want 1", len(recorder.responses))
+	}
+	got := recorder.responses[0]
+	if got.Url != "https://www.pearvideo.com/videoStatus.jsp?contId=1" {
+		t.Errorf("url = %s, volatile params should be removed", got.Url)
+	}
+	if _, ok := got.Header["Date"]; ok {
+		t.Errorf("header Date should not be recorded")
+	}
+	wantCookies := []string{"JSESSIONID=REDACTED; Path=/", "PEAR_UUID=REDACTED"}
+	if strings.Join(got.Header["Set-Cookie"], "\n") != strings.Join(wantCookies, "\n") {
+		t.Errorf("Set-Cookie = %v, want %v", got.Header["Set-Cookie"], wantCookies)
+	}
+	if string(recorder.bodies[0]) != `{"resultCode":"1"}` {
+		t.Errorf("recorded body = %s", recorder.bodies[0])
+	}
+}
+
+func TestFixture_matchInOrder(t *testing.T) {
+	f := &fixture{Responses: []fixtureResponse{
+		{Url: "https://www.iesdouyin.com/share/video/1", Body: "first"},
+		{Url: "https://www.iesdouyin.com/share/video/1", Body: "second"},
+	}}
+	reqUrl, _ := url.Parse("https://www.iesdouyin.com/share/video/1/?region=CN")
+	for _, want := range []string{"first", "second", "second"} {
+		if got := f.match(http.MethodGet, reqUrl); got == nil || got.Body != want {
+			t.Errorf("match = %v, want %s", got, want)
+		}
+	}
+}
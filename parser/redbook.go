@@ -2,22 +2,22 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 
 	"github.com/tidwall/gjson"
-
-	"github.com/go-resty/resty/v2"
 )
 
 type redBook struct{}
 
-func (r redBook) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (r redBook) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourceRedBook)
 	videoRes, err := client.R().
-		SetHeader(HttpHeaderUserAgent, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0").
+		SetContext(ctx).
+		SetHeader(HttpHeaderUserAgent, sourceUserAgent(ctx, SourceRedBook, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0")).
 		Get(shareUrl)
 	if err != nil {
 		return nil, err
@@ -26,7 +26,7 @@ func (r redBook) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	re := regexp.MustCompile(`window.__INITIAL_STATE__\s*=\s*(.*?)</script>`)
 	findRes := re.FindSubmatch(videoRes.Body())
 	if len(findRes) < 2 {
-		return nil, errors.New("parse video json info from html fail")
+		return nil, newParseError(SourceRedBook, "", ErrLayoutChanged, errors.New("parse video json info from html fail"))
 	}
 
 	jsonBytes := bytes.TrimSpace(findRes[1])
@@ -39,6 +39,7 @@ func (r redBook) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	// 获取图集图片地址
 	imagesObjArr := data.Get("imageList").Array()
 	images := make([]string, 0, len(imagesObjArr))
+	var imageItems []ImageItem
 	if len(videoUrl) <= 0 {
 		for _, imageItem := range imagesObjArr {
 			imageUrl := imageItem.Get("urlDefault").String()
@@ -50,22 +51,71 @@ func (r redBook) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 					spectrumStr = "spectrum/"
 				}
 				newUrl := fmt.Sprintf("https://ci.xiaohongshu.com/%s%s?imageView2/2/w/0/format/jpg", spectrumStr, imgId)
-				fmt.Println(imageUrl)
-				fmt.Println(newUrl)
 				images = append(images, newUrl)
+
+				item := ImageItem{
+					Url:            imageUrl,
+					NoWatermarkUrl: newUrl,
+					Width:          imageItem.Get("width").Int(),
+					Height:         imageItem.Get("height").Int(),
+				}
+				// 实况照片的视频流, 格式与笔记视频相同
+				if imageItem.Get("livePhoto").Bool() {
+					item.LiveVideoUrl = imageItem.Get("stream.h264.0.masterUrl").String()
+				}
+				imageItems = append(imageItems, item)
+			}
+		}
+	}
+
+	// 视频流, h264 兼容性更好, 排在 h265 前面
+	var streams []StreamVariant
+	for _, codec := range []string{"h264", "h265"} {
+		for _, item := range data.Get("video.media.stream." + codec).Array() {
+			var backupUrls []string
+			for _, backupUrl := range item.Get("backupUrls").Array() {
+				backupUrls = append(backupUrls, backupUrl.String())
 			}
+			streams = append(streams, StreamVariant{
+				Quality:    item.Get("qualityType").String(),
+				Width:      item.Get("width").Int(),
+				Height:     item.Get("height").Int(),
+				Bitrate:    item.Get("avgBitrate").Int(),
+				Codec:      codec,
+				Container:  item.Get("format").String(),
+				Size:       item.Get("size").Int(),
+				Url:        item.Get("masterUrl").String(),
+				BackupUrls: backupUrls,
+			})
 		}
 	}
 
 	parseInfo := &VideoParseInfo{
-		Title:    data.Get("title").String(),
-		VideoUrl: data.Get("video.media.stream.h264.0.masterUrl").String(),
-		CoverUrl: data.Get("imageList.0.urlDefault").String(),
-		Images:   images,
+		Title:      data.Get("title").String(),
+		VideoUrl:   data.Get("video.media.stream.h264.0.masterUrl").String(),
+		CoverUrl:   data.Get("imageList.0.urlDefault").String(),
+		Images:     images,
+		Streams:    streams,
+		ImageItems: imageItems,
 	}
 	parseInfo.Author.Uid = data.Get("user.userId").String()
 	parseInfo.Author.Name = data.Get("user.nickname").String()
 	parseInfo.Author.Avatar = data.Get("user.avatar").String()
 
+	// 互动数据是带单位的字符串, 如: 1.2万; 时长为秒, 发布时间为毫秒
+	parseInfo.VideoId = nodeId
+	parseInfo.Duration = data.Get("video.capa.duration").Int()
+	parseInfo.PublishedAt = data.Get("time").Int() / 1000
+	for _, tag := range data.Get("tagList").Array() {
+		parseInfo.Tags = appendTags(parseInfo.Tags, tag.Get("name").String())
+	}
+	parseInfo.Stats = newVideoStats(
+		0,
+		parseCount(data.Get("interactInfo.likedCount").String()),
+		parseCount(data.Get("interactInfo.commentCount").String()),
+		parseCount(data.Get("interactInfo.shareCount").String()),
+		parseCount(data.Get("interactInfo.collectedCount").String()),
+	)
+
 	return parseInfo, nil
 }
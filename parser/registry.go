@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// sourceMu 保护 videoSourceInfoMapping 的并发读写
+var sourceMu sync.RWMutex
+
+// SourceDescriptor 渠道描述信息, 由 Sources 返回
+type SourceDescriptor struct {
+	Source   string   `json:"source"`    // 渠道名称
+	Domains  []string `json:"domains"`   // 视频分享地址域名
+	ShareUrl bool     `json:"share_url"` // 是否支持分享链接解析
+	VideoId  bool     `json:"video_id"`  // 是否支持视频id解析
+	Images   bool     `json:"images"`    // 是否支持图集解析
+	Media    []string `json:"media"`     // 资源CDN域名
+}
+
+// Register 注册视频渠道, source 已存在时覆盖原有配置
+// 可用于在外部模块中扩展新的渠道, 或替换内置渠道的解析实现
+func Register(source string, info SourceInfo) error {
+	if len(source) <= 0 {
+		return errors.New("source is empty")
+	}
+	if info.VideoShareUrlParser == nil && info.VideoIdParser == nil {
+		return errors.New("source " + source + " has no parser")
+	}
+	if info.VideoShareUrlParser != nil && len(info.VideoShareUrlDomain) <= 0 {
+		return errors.New("source " + source + " has share url parser but no share url domain")
+	}
+
+	// 复制一份域名列表, 避免调用方后续修改影响注册信息
+	info.VideoShareUrlDomain = append([]string(nil), info.VideoShareUrlDomain...)
+	info.MediaDomains = append([]string(nil), info.MediaDomains...)
+	mediaHeaders := make(map[string]string, len(info.MediaHeaders))
+	for key, value := range info.MediaHeaders {
+		mediaHeaders[key] = value
+	}
+	info.MediaHeaders = mediaHeaders
+
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	videoSourceInfoMapping[source] = info
+
+	return nil
+}
+
+// Unregister 移除视频渠道, source 不存在时不做处理
+func Unregister(source string) {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	delete(videoSourceInfoMapping, source)
+}
+
+// Sources 返回所有已注册渠道的描述信息, 按渠道名称排序
+func Sources() []SourceDescriptor {
+	sourceMu.RLock()
+	defer sourceMu.RUnlock()
+
+	list := make([]SourceDescriptor, 0, len(videoSourceInfoMapping))
+	for source, info := range videoSourceInfoMapping {
+		list = append(list, SourceDescriptor{
+			Source:   source,
+			Domains:  append([]string(nil), info.VideoShareUrlDomain...),
+			ShareUrl: info.VideoShareUrlParser != nil,
+			VideoId:  info.VideoIdParser != nil,
+			Images:   info.SupportImages,
+			Media:    append([]string(nil), info.MediaDomains...),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Source < list[j].Source
+	})
+
+	return list
+}
+
+// getSourceInfo 获取渠道信息
+func getSourceInfo(source string) (SourceInfo, bool) {
+	sourceMu.RLock()
+	defer sourceMu.RUnlock()
+	info, ok := videoSourceInfoMapping[source]
+	return info, ok
+}
+
+// matchShareUrlSource 根据分享链接匹配渠道, 多个渠道域名都匹配时, 取匹配域名最长的渠道
+func matchShareUrlSource(shareUrl string) (string, SourceInfo, bool) {
+	sourceMu.RLock()
+	defer sourceMu.RUnlock()
+
+	var (
+		source     string
+		sourceInfo SourceInfo
+		matchLen   int
+	)
+	for itemSource, itemSourceInfo := range videoSourceInfoMapping {
+		for _, itemUrlDomain := range itemSourceInfo.VideoShareUrlDomain {
+			if !strings.Contains(shareUrl, itemUrlDomain) {
+				continue
+			}
+			// 域名长度相同时按渠道名称排序, 保证结果稳定
+			if len(itemUrlDomain) > matchLen || (len(itemUrlDomain) == matchLen && itemSource < source) {
+				source, sourceInfo, matchLen = itemSource, itemSourceInfo, len(itemUrlDomain)
+			}
+		}
+	}
+
+	return source, sourceInfo, len(source) > 0
+}
+
+// MatchMediaHost 根据资源域名匹配渠道, host 为渠道 MediaDomains 中的域名或其子域名时返回对应渠道
+// 多个渠道都匹配时, 取匹配域名最长的渠道
+func MatchMediaHost(host string) (string, bool) {
+	if len(host) <= 0 {
+		return "", false
+	}
+
+	sourceMu.RLock()
+	defer sourceMu.RUnlock()
+
+	var (
+		source   string
+		matchLen int
+	)
+	for itemSource, itemSourceInfo := range videoSourceInfoMapping {
+		for _, domain := range itemSourceInfo.MediaDomains {
+			if !hostMatchDomain(host, domain) {
+				continue
+			}
+			if len(domain) > matchLen || (len(domain) == matchLen && itemSource < source) {
+				source, matchLen = itemSource, len(domain)
+			}
+		}
+	}
+
+	return source, len(source) > 0
+}
+
+// MediaHeaders 返回请求渠道资源地址时需要的请求头, 渠道不存在或未配置时返回空
+func MediaHeaders(source string) http.Header {
+	header := make(http.Header)
+	info, ok := getSourceInfo(source)
+	if !ok {
+		return header
+	}
+	for key, value := range info.MediaHeaders {
+		header.Set(key, value)
+	}
+	return header
+}
+
+// hostMatchDomain host 是否为 domain 或其子域名
+func hostMatchDomain(host, domain string) bool {
+	host, domain = strings.TrimSuffix(strings.ToLower(host), "."), strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"context"
+	"testing"
+)
+
+type fakeParser struct{}
+
+func (f fakeParser) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	return &VideoParseInfo{Title: shareUrl}, nil
+}
+
+func (f fakeParser) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
+	return &VideoParseInfo{Title: videoId}, nil
+}
+
+func TestRegister(t *testing.T) {
+	const source = "fake"
+	err := Register(source, SourceInfo{
+		VideoShareUrlDomain: []string{"v.fake.example.com"},
+		VideoShareUrlParser: fakeParser{},
+		VideoIdParser:       fakeParser{},
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	defer Unregister(source)
+
+	shareUrl := "https://v.fake.example.com/abc"
+	res, err := ParseVideoShareUrl(shareUrl)
+	if err != nil || res.Title != shareUrl {
+		t.Errorf("ParseVideoShareUrl() = %v, %v", res, err)
+	}
+	res, err = ParseVideoId(source, "abc")
+	if err != nil || res.Title != "abc" {
+		t.Errorf("ParseVideoId() = %v, %v", res, err)
+	}
+
+	var found *SourceDescriptor
+	for _, item := range Sources() {
+		if item.Source == source {
+			found = &item
+		}
+	}
+	if found == nil || !found.ShareUrl || !found.VideoId || found.Images {
+		t.Errorf("Sources() fake source = %+v", found)
+	}
+
+	Unregister(source)
+	if _, err = ParseVideoShareUrl(shareUrl); err == nil {
+		t.Errorf("ParseVideoShareUrl() after Unregister want error")
+	}
+}
+
+func TestRegister_invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		info   SourceInfo
+	}{
+		{"空渠道", "", SourceInfo{VideoIdParser: fakeParser{}}},
+		{"无解析方法", "fake", SourceInfo{VideoShareUrlDomain: []string{"fake.example.com"}}},
+		{"无分享域名", "fake", SourceInfo{VideoShareUrlParser: fakeParser{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Register(tt.source, tt.info); err == nil {
+				t.Errorf("Register() want error")
+			}
+		})
+	}
+}
+
+func TestMatchMediaHost(t *testing.T) {
+	tests := []struct {
+		host   string
+		source string
+		ok     bool
+	}{
+		{"v26-che.douyinvod.com", SourceDouYin, true},
+		{"upos-sz-mirrorali.bilivideo.com", SourceBiliBili, true},
+		{"V.WEISHI.QQ.COM.", SourceWeiShi, true},
+		{"douyinvod.com.evil.com", "", false},
+		{"evildouyinvod.com", "", false},
+		{"qq.com", "", false},
+		{"127.0.0.1", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		source, ok := MatchMediaHost(tt.host)
+		if source != tt.source || ok != tt.ok {
+			t.Errorf("MatchMediaHost(%q) = %q, %v, want %q, %v", tt.host, source, ok, tt.source, tt.ok)
+		}
+	}
+}
+
+func TestMediaHeaders(t *testing.T) {
+	if got := MediaHeaders(SourceBiliBili).Get(HttpHeaderReferer); got != "https://www.bilibili.com/" {
+		t.Errorf("bilibili Referer = %q", got)
+	}
+	if got := MediaHeaders("not-exist"); len(got) != 0 {
+		t.Errorf("MediaHeaders(not-exist) = %v, want empty", got)
+	}
+
+	const source = "fake"
+	headers := map[string]string{HttpHeaderReferer: "https://fake.example.com/", HttpHeaderCookie: "a=1"}
+	err := Register(source, SourceInfo{
+		VideoIdParser: fakeParser{},
+		MediaHeaders:  headers,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(source)
+
+	// 注册后修改原 map 不影响已注册的配置
+	headers[HttpHeaderReferer] = "https://changed.example.com/"
+	got := MediaHeaders(source)
+	if got.Get(HttpHeaderReferer) != "https://fake.example.com/" || got.Get(HttpHeaderCookie) != "a=1" {
+		t.Errorf("MediaHeaders(fake) = %v", got)
+	}
+}
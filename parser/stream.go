@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// 首选清晰度的特殊取值, 通过 WithPreferredQuality 配置
+// 其他取值按清晰度名称匹配(如: 高清), 或按高度匹配(如: 720p, 720), 高度匹配时取不超过该高度的最高清晰度
+const (
+	QualityBest  = "best"  // 最高清晰度
+	QualityWorst = "worst" // 最低清晰度
+)
+
+// qualityHeightRe 从清晰度名称中提取高度, 如: 高清 1080P, mp4_720p
+var qualityHeightRe = regexp.MustCompile(`(\d{3,4})[pP]`)
+
+// streamHeight 获取视频流高度, 渠道未返回时从清晰度名称中提取
+func streamHeight(stream StreamVariant) int64 {
+	if stream.Height > 0 {
+		return stream.Height
+	}
+	if strings.Contains(strings.ToUpper(stream.Quality), "4K") {
+		return 2160
+	}
+	findRes := qualityHeightRe.FindStringSubmatch(stream.Quality)
+	if len(findRes) < 2 {
+		return 0
+	}
+	height, _ := strconv.ParseInt(findRes[1], 10, 64)
+	return height
+}
+
+// sortStreams 按清晰度从高到低排序, 高度相同时码率高的在前, 都未知时保持渠道返回的顺序
+func sortStreams(streams []StreamVariant) {
+	sort.SliceStable(streams, func(i, j int) bool {
+		hi, hj := streamHeight(streams[i]), streamHeight(streams[j])
+		if hi != hj {
+			return hi > hj
+		}
+		return streams[i].Bitrate > streams[j].Bitrate
+	})
+}
+
+// selectStream 从已排序的视频流中选择与首选清晰度最匹配的一条, 无法匹配时返回 false
+func selectStream(streams []StreamVariant, quality string) (StreamVariant, bool) {
+	quality = strings.TrimSpace(quality)
+	if len(streams) <= 0 || len(quality) <= 0 {
+		return StreamVariant{}, false
+	}
+
+	switch strings.ToLower(quality) {
+	case QualityBest:
+		return streams[0], true
+	case QualityWorst:
+		return streams[len(streams)-1], true
+	}
+
+	for _, stream := range streams {
+		if strings.EqualFold(stream.Quality, quality) {
+			return stream, true
+		}
+	}
+
+	target, err := strconv.ParseInt(strings.TrimSuffix(strings.ToLower(quality), "p"), 10, 64)
+	if err != nil {
+		return StreamVariant{}, false
+	}
+	var (
+		lowest StreamVariant
+		found  bool
+	)
+	for _, stream := range streams {
+		height := streamHeight(stream)
+		if height <= 0 {
+			continue
+		}
+		if height <= target {
+			return stream, true
+		}
+		lowest, found = stream, true
+	}
+
+	// 所有清晰度都高于首选清晰度时, 取最低的一条
+	return lowest, found
+}
+
+// urlContainer 根据播放地址的文件后缀获取封装格式, 如: mp4, m3u8
+func urlContainer(rawUrl string) string {
+	urlRes, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(path.Ext(urlRes.Path), "."))
+}
+
+// clarityStreams 解析百度系(好看视频, 度小视)接口的 clarityUrl 清晰度列表
+func clarityStreams(clarityUrl gjson.Result) []StreamVariant {
+	var streams []StreamVariant
+	items := clarityUrl.Array()
+	// 接口按清晰度从低到高返回, 倒序遍历
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		streamUrl := item.Get("url").String()
+		if len(streamUrl) <= 0 {
+			continue
+		}
+		streams = append(streams, StreamVariant{
+			Quality:   item.Get("title").String(),
+			Container: urlContainer(streamUrl),
+			Url:       streamUrl,
+		})
+	}
+	return streams
+}
+
+// applyPreferredQuality 排序解析结果(包括各分P)中的视频流, 并按首选清晰度设置 VideoUrl
+func (c *Client) applyPreferredQuality(info *VideoParseInfo) {
+	if info == nil {
+		return
+	}
+	sortStreams(info.Streams)
+	if stream, ok := selectStream(info.Streams, c.preferredQuality); ok {
+		info.VideoUrl = stream.Url
+	}
+	for i := range info.Pages {
+		page := &info.Pages[i]
+		sortStreams(page.Streams)
+		if stream, ok := selectStream(page.Streams, c.preferredQuality); ok {
+			page.VideoUrl = stream.Url
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSelectStream(t *testing.T) {
+	streams := []StreamVariant{
+		{Quality: "高清 1080P", Url: "1080"},
+		{Quality: "720P", Height: 720, Url: "720"},
+		{Quality: "流畅", Height: 360, Url: "360"},
+	}
+	tests := []struct {
+		quality string
+		want    string
+		ok      bool
+	}{
+		{"", "", false},
+		{QualityBest, "1080", true},
+		{"WORST", "360", true},
+		{"流畅", "360", true},
+		{"720p", "720", true},
+		{"1080", "1080", true},
+		{"900p", "720", true},
+		{"240p", "360", true},
+		{"超清", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := selectStream(streams, tt.quality)
+		if ok != tt.ok || got.Url != tt.want {
+			t.Errorf("selectStream(%q) = %q, %v, want %q, %v", tt.quality, got.Url, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSortStreams(t *testing.T) {
+	streams := []StreamVariant{
+		{Quality: "标清 480P", Url: "480"},
+		{Height: 1080, Bitrate: 1000, Url: "1080-low"},
+		{Quality: "4K", Url: "2160"},
+		{Height: 1080, Bitrate: 2000, Url: "1080-high"},
+	}
+	sortStreams(streams)
+	want := []string{"2160", "1080-high", "1080-low", "480"}
+	for i, stream := range streams {
+		if stream.Url != want[i] {
+			t.Errorf("streams[%d] = %s, want %s", i, stream.Url, want[i])
+		}
+	}
+}
+
+func TestWithPreferredQuality(t *testing.T) {
+	f := loadFixtures(t)["weibo/video"]
+	if f == nil {
+		t.Fatal("fixture weibo/video not found")
+	}
+	client := newFixtureClient(t, f, WithPreferredQuality("720p"))
+	got, err := f.run(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://f.video.weibocdn.com/o0/720p.mp4?label=mp4_720p"; got.VideoUrl != want {
+		t.Errorf("VideoUrl = %s, want %s", got.VideoUrl, want)
+	}
+	if len(got.Streams) != 3 {
+		t.Errorf("len(Streams) = %d, want 3", len(got.Streams))
+	}
+}
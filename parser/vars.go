@@ -1,5 +1,7 @@
 package parser
 
+import "context"
+
 // 视频渠道来源
 const (
 	SourceDouYin       = "douyin"       // 抖音
@@ -35,16 +37,19 @@ const (
 
 	// DefaultUserAgent 默认UserAgent
 	DefaultUserAgent = "Mozilla/5.0 (iPhone; CPU iPhone OS 11_0 like Mac OS X) AppleWebKit/604.1.38 (KHTML, like Gecko) Version/11.0 Mobile/15A372 Safari/604.1"
+
+	// DefaultBatchConcurrency 批量解析时默认同时解析的条数
+	DefaultBatchConcurrency = 8
 )
 
-// videoShareUrlParser 根据视频分享地址解析
-type videoShareUrlParser interface {
-	parseShareUrl(shareUrl string) (*VideoParseInfo, error)
+// VideoShareUrlParser 根据视频分享地址解析
+type VideoShareUrlParser interface {
+	ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error)
 }
 
-// videoIdParser 根据视频ID解析
-type videoIdParser interface {
-	parseVideoID(videoId string) (*VideoParseInfo, error)
+// VideoIdParser 根据视频ID解析
+type VideoIdParser interface {
+	ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error)
 }
 
 // VideoParseInfo 视频解析信息
@@ -58,7 +63,75 @@ type VideoParseInfo struct {
 	VideoUrl string   `json:"video_url"` // 视频播放地址
 	MusicUrl string   `json:"music_url"` // 音乐播放地址
 	CoverUrl string   `json:"cover_url"` // 视频封面地址
-	Images   []string `json:"images"`    // 图集图片地址列表
+	Images   []string `json:"images"`    // 图集图片地址列表, 有无水印地址时为无水印地址
+
+	// ImageItems 图集图片的详细信息, 与 Images 一一对应, 包括尺寸和实况照片的视频地址
+	ImageItems []ImageItem `json:"image_items,omitempty"`
+
+	// Streams 视频的所有清晰度, 按清晰度从高到低排序, 渠道未提供多清晰度时为空
+	// 配置 WithPreferredQuality 时, VideoUrl 取其中最匹配的一条
+	Streams []StreamVariant `json:"streams,omitempty"`
+
+	// Pages 多P视频的所有分P, 配置 WithAllPages 时返回
+	Pages []VideoPage `json:"pages,omitempty"`
+
+	// 以下为发布信息和互动数据, 渠道未返回时为零值
+	Source      string      `json:"source,omitempty"`       // 渠道, 如: douyin
+	VideoId     string      `json:"video_id,omitempty"`     // 渠道内的视频id, 可用于 ParseVideoId
+	Duration    int64       `json:"duration,omitempty"`     // 时长, 秒
+	PublishedAt int64       `json:"published_at,omitempty"` // 发布时间, unix 时间戳, 秒
+	Tags        []string    `json:"tags,omitempty"`         // 话题标签, 不含 #
+	Music       *MusicInfo  `json:"music,omitempty"`        // 背景音乐, 与 MusicUrl(音频流) 不同, 只有部分渠道提供
+	Stats       *VideoStats `json:"stats,omitempty"`        // 互动数据
+}
+
+// MusicInfo 背景音乐信息
+type MusicInfo struct {
+	Title  string `json:"title"`         // 音乐名称
+	Author string `json:"author"`        // 音乐作者
+	Url    string `json:"url,omitempty"` // 音乐播放地址
+}
+
+// VideoStats 互动数据, 抓取时的数值, 渠道未返回的字段为0
+type VideoStats struct {
+	Plays    int64 `json:"plays"`    // 播放数
+	Likes    int64 `json:"likes"`    // 点赞数
+	Comments int64 `json:"comments"` // 评论数
+	Shares   int64 `json:"shares"`   // 分享(转发)数
+	Collects int64 `json:"collects"` // 收藏数
+}
+
+// VideoPage 多P视频的分P信息
+type VideoPage struct {
+	Page     int64           `json:"page"`              // 分P序号, 从1开始
+	Cid      string          `json:"cid"`               // 分P id
+	Title    string          `json:"title"`             // 分P标题
+	Duration int64           `json:"duration"`          // 时长, 秒
+	VideoUrl string          `json:"video_url"`         // 视频播放地址
+	MusicUrl string          `json:"music_url"`         // 音频播放地址
+	Streams  []StreamVariant `json:"streams,omitempty"` // 视频的所有清晰度
+}
+
+// ImageItem 图集中的一张图片, 未知的字段为零值
+type ImageItem struct {
+	Url            string `json:"url"`                        // 渠道返回的静态图片地址, 可能带水印
+	NoWatermarkUrl string `json:"no_watermark_url,omitempty"` // 无水印的静态图片地址
+	LiveVideoUrl   string `json:"live_video_url,omitempty"`   // 实况照片(live photo)的视频地址, 普通图片为空
+	Width          int64  `json:"width,omitempty"`            // 宽度
+	Height         int64  `json:"height,omitempty"`           // 高度
+}
+
+// StreamVariant 视频流, 同一视频的一种清晰度, 未知的字段为零值
+type StreamVariant struct {
+	Quality    string   `json:"quality"`               // 清晰度名称, 如: 1080P, 高清
+	Width      int64    `json:"width,omitempty"`       // 宽度
+	Height     int64    `json:"height,omitempty"`      // 高度
+	Bitrate    int64    `json:"bitrate,omitempty"`     // 码率, bps
+	Codec      string   `json:"codec,omitempty"`       // 编码, 如: avc1.640032, hevc
+	Container  string   `json:"container,omitempty"`   // 封装格式, 如: mp4, m4s, m3u8
+	Size       int64    `json:"size,omitempty"`        // 文件大小, 字节
+	Url        string   `json:"url"`                   // 播放地址
+	BackupUrls []string `json:"backup_urls,omitempty"` // 备用播放地址
 }
 
 // BatchParseItem 批量解析时, 单条解析格式
@@ -67,106 +140,136 @@ type BatchParseItem struct {
 	Error     error           // 错误, 如果单条解析失败时, 记录error信息
 }
 
-// 视频渠道信息
-type videoSourceInfo struct {
+// SourceInfo 视频渠道信息, 通过 Register 注册
+type SourceInfo struct {
 	VideoShareUrlDomain []string            // 视频分享地址域名
-	VideoShareUrlParser videoShareUrlParser // 视频分享地址解析方法
-	VideoIdParser       videoIdParser       // 视频id解析方法, 有些渠道可能没有id解析方法
+	VideoShareUrlParser VideoShareUrlParser // 视频分享地址解析方法
+	VideoIdParser       VideoIdParser       // 视频id解析方法, 有些渠道可能没有id解析方法
+	SupportImages       bool                // 是否支持解析图集
+	MediaDomains        []string            // 视频、封面、图集等资源的CDN域名, 子域名也匹配, /video/stream 代理只允许这些域名
+	MediaHeaders        map[string]string   // 请求资源地址时需要的请求头, 如防盗链的 Referer, 代理时自动带上
 }
 
-// 视频渠道映射信息
-var videoSourceInfoMapping = map[string]videoSourceInfo{
+// 视频渠道映射信息, 内置渠道, 运行时通过 Register / Unregister 修改
+var videoSourceInfoMapping = map[string]SourceInfo{
 	SourceDouYin: {
 		VideoShareUrlDomain: []string{"v.douyin.com", "www.iesdouyin.com", "www.douyin.com"},
 		VideoShareUrlParser: douYin{},
 		VideoIdParser:       douYin{},
+		SupportImages:       true,
+		MediaDomains:        []string{"douyinvod.com", "douyinpic.com", "douyincdn.com", "zjcdn.com", "amemv.com", "douyinstatic.com"},
 	},
 	SourceKuaiShou: {
 		VideoShareUrlDomain: []string{"v.kuaishou.com"},
 		VideoShareUrlParser: kuaiShou{},
+		SupportImages:       true,
+		MediaDomains:        []string{"kwaicdn.com", "yximgs.com", "kwimgs.com"},
 	},
 	SourceZuiYou: {
 		VideoShareUrlDomain: []string{"share.xiaochuankeji.cn"},
 		VideoShareUrlParser: zuiYou{},
+		MediaDomains:        []string{"ixiaochuan.cn", "izuiyou.com"},
 	},
 	SourceXiGua: {
 		VideoShareUrlDomain: []string{"v.ixigua.com"},
 		VideoShareUrlParser: xiGua{},
 		VideoIdParser:       xiGua{},
+		MediaDomains:        []string{"ixigua.com", "snssdk.com", "douyinpic.com", "douyinvod.com", "douyinstatic.com"},
 	},
 	SourcePiPiXia: {
 		VideoShareUrlDomain: []string{"h5.pipix.com"},
 		VideoShareUrlParser: piPiXia{},
 		VideoIdParser:       piPiXia{},
+		SupportImages:       true,
+		MediaDomains:        []string{"ixigua.com", "byteimg.com", "pstatp.com"},
 	},
 	SourceWeiShi: {
 		VideoShareUrlDomain: []string{"isee.weishi.qq.com"},
 		VideoShareUrlParser: weiShi{},
 		VideoIdParser:       weiShi{},
+		MediaDomains:        []string{"weishi.qq.com"},
 	},
 	SourceHuoShan: {
 		VideoShareUrlDomain: []string{"share.huoshan.com"},
 		VideoShareUrlParser: huoShan{},
 		VideoIdParser:       huoShan{},
+		MediaDomains:        []string{"huoshan.com", "huoshanimg.com", "huoshanvod.com"},
 	},
 	SourceLiShiPin: {
 		VideoShareUrlDomain: []string{"www.pearvideo.com"},
 		VideoShareUrlParser: liShiPin{},
 		VideoIdParser:       liShiPin{},
+		MediaDomains:        []string{"pearvideo.com"},
 	},
 	SourcePiPiGaoXiao: {
 		VideoShareUrlDomain: []string{"h5.pipigx.com"},
 		VideoShareUrlParser: piPiGaoXiao{},
 		VideoIdParser:       piPiGaoXiao{},
+		MediaDomains:        []string{"ippzone.com"},
 	},
 	SourceQuanMin: {
 		VideoShareUrlDomain: []string{"xspshare.baidu.com"},
 		VideoShareUrlParser: quanMin{},
 		VideoIdParser:       quanMin{},
+		MediaDomains:        []string{"bdstatic.com"},
 	},
 	SourceHuYa: {
 		VideoShareUrlDomain: []string{"v.huya.com"},
 		VideoShareUrlParser: huYa{},
 		VideoIdParser:       huYa{},
+		MediaDomains:        []string{"huya.com", "msstatic.com"},
+		MediaHeaders:        map[string]string{HttpHeaderReferer: "https://www.huya.com/"},
 	},
 	SourceAcFun: {
 		VideoShareUrlDomain: []string{"www.acfun.cn"},
 		VideoShareUrlParser: acFun{},
 		VideoIdParser:       acFun{},
+		MediaDomains:        []string{"acfun.cn", "aixifan.com"},
+		MediaHeaders:        map[string]string{HttpHeaderReferer: "https://www.acfun.cn/"},
 	},
 	SourceWeiBo: {
 		VideoShareUrlDomain: []string{"weibo.com"},
 		VideoShareUrlParser: weiBo{},
 		VideoIdParser:       weiBo{},
+		MediaDomains:        []string{"weibocdn.com", "sinaimg.cn"},
+		MediaHeaders:        map[string]string{HttpHeaderReferer: "https://weibo.com/"},
 	},
 	SourceLvZhou: {
 		VideoShareUrlDomain: []string{"weibo.cn"},
 		VideoShareUrlParser: lvZhou{},
 		VideoIdParser:       lvZhou{},
+		MediaDomains:        []string{"weibocdn.com", "sinaimg.cn"},
+		MediaHeaders:        map[string]string{HttpHeaderReferer: "https://weibo.com/"},
 	},
 	SourceMeiPai: {
 		VideoShareUrlDomain: []string{"meipai.com"},
 		VideoShareUrlParser: meiPai{},
 		VideoIdParser:       meiPai{},
+		MediaDomains:        []string{"meitudata.com"},
 	},
 	SourceDouPai: {
 		VideoShareUrlDomain: []string{"doupai.cc"},
 		VideoShareUrlParser: douPai{},
 		VideoIdParser:       douPai{},
+		MediaDomains:        []string{"doupai.cc"},
 	},
 	SourceQuanMinKGe: {
 		VideoShareUrlDomain: []string{"kg.qq.com"},
 		VideoShareUrlParser: quanMinKGe{},
 		VideoIdParser:       quanMinKGe{},
+		MediaDomains:        []string{"music.tc.qq.com", "qlogo.cn", "gtimg.cn"},
 	},
 	SourceSixRoom: {
 		VideoShareUrlDomain: []string{"6.cn"},
 		VideoShareUrlParser: sixRoom{},
 		VideoIdParser:       sixRoom{},
+		MediaDomains:        []string{"6rooms.com"},
 	},
 	SourceXinPianChang: {
 		VideoShareUrlDomain: []string{"xinpianchang.com"},
 		VideoShareUrlParser: xinPianChang{},
+		MediaDomains:        []string{"xpccdn.com"},
+		MediaHeaders:        map[string]string{HttpHeaderReferer: "https://www.xinpianchang.com/"},
 	},
 	SourceHaoKan: {
 		VideoShareUrlDomain: []string{
@@ -175,6 +278,7 @@ var videoSourceInfoMapping = map[string]videoSourceInfo{
 		},
 		VideoShareUrlParser: haoKan{},
 		VideoIdParser:       haoKan{},
+		MediaDomains:        []string{"bdstatic.com", "baidu.com"},
 	},
 	SourceRedBook: {
 		VideoShareUrlDomain: []string{
@@ -182,9 +286,15 @@ var videoSourceInfoMapping = map[string]videoSourceInfo{
 			"xhslink.com",
 		},
 		VideoShareUrlParser: redBook{},
+		SupportImages:       true,
+		MediaDomains:        []string{"xhscdn.com", "xiaohongshu.com"},
+		MediaHeaders:        map[string]string{HttpHeaderReferer: "https://www.xiaohongshu.com/"},
 	},
 	SourceBiliBili: {
 		VideoShareUrlDomain: []string{"b23.tv", "www.bilibili.com"},
 		VideoShareUrlParser: bilibili{},
+		VideoIdParser:       bilibili{},
+		MediaDomains:        []string{"bilivideo.com", "bilivideo.cn", "hdslb.com"},
+		MediaHeaders:        map[string]string{HttpHeaderReferer: "https://www.bilibili.com/"},
 	},
 }
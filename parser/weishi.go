@@ -1,21 +1,21 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"net/url"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type weiShi struct {
 }
 
-func (w weiShi) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (w weiShi) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://h5.weishi.qq.com/webapp/json/weishi/WSH5GetPlayPage?feedid=" + videoId
-	client := resty.New()
+	client := newRestyClient(ctx, SourceWeiShi)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(reqUrl)
 	if err != nil {
 		return nil, err
@@ -23,12 +23,12 @@ func (w weiShi) parseVideoID(videoId string) (*VideoParseInfo, error) {
 
 	// 接口返回错误
 	if gjson.GetBytes(res.Body(), "ret").Int() != 0 {
-		return nil, errors.New(gjson.GetBytes(res.Body(), "msg").String())
+		return nil, newParseError(SourceWeiShi, videoId, ErrVideoNotFound, errors.New(gjson.GetBytes(res.Body(), "msg").String()))
 	}
 	// 视频状态错误
 	errMsg := gjson.GetBytes(res.Body(), "data.errmsg").String()
 	if len(errMsg) > 0 {
-		return nil, errors.New(errMsg)
+		return nil, newParseError(SourceWeiShi, videoId, ErrVideoNotFound, errors.New(errMsg))
 	}
 
 	data := gjson.GetBytes(res.Body(), "data.feeds.0")
@@ -45,20 +45,31 @@ func (w weiShi) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	}
 	parseRes.Author.Name = author
 	parseRes.Author.Avatar = avatar
+	parseRes.VideoId = videoId
+	parseRes.Duration = millisToSeconds(data.Get("video.duration").Int())
+	parseRes.PublishedAt = data.Get("createtime").Int()
+	parseRes.Tags = parseHashtags(title)
+	parseRes.Stats = newVideoStats(
+		data.Get("playNum").Int(),
+		data.Get("ding_count").Int(),
+		data.Get("total_comment_num").Int(),
+		0,
+		0,
+	)
 
 	return parseRes, nil
 }
 
-func (w weiShi) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (w weiShi) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlRes, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(SourceWeiShi, "", ErrInvalidInput, err)
 	}
 
 	videoId := urlRes.Query().Get("id")
 	if len(videoId) <= 0 {
-		return nil, errors.New("parse video_id from share url fail")
+		return nil, newParseError(SourceWeiShi, "", ErrInvalidInput, errors.New("parse video_id from share url fail"))
 	}
 
-	return w.parseVideoID(videoId)
+	return w.ParseVideoID(ctx, videoId)
 }
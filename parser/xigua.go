@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"regexp"
 	"strings"
@@ -10,18 +11,21 @@ import (
 	"github.com/tidwall/gjson"
 )
 
+// xiGuaDefaultCookie 西瓜视频内置cookie, 可通过 WithSourceCookie 替换
+const xiGuaDefaultCookie = "MONITOR_WEB_ID=7892c49b-296e-4499-8704-e47c1b150c18; ixigua-a-s=1; ttcid=af99669b6304453480454f150701d5c226; BD_REF=1; __ac_nonce=060d88ff000a75e8d17eb; __ac_signature=_02B4Z6wo00f01kX9ZpgAAIDAKIBBQUIPYT5F2WIAAPG2ad; ttwid=1%7CcIsVF_3vqSIk4XErhPB0H2VaTxT0tdsTMRbMjrJOPN8%7C1624806049%7C08ce7dd6f7d20506a41ba0a331ef96a6505d96731e6ad9f6c8c709f53f227ab1"
+
 type xiGua struct {
 }
 
-func (x xiGua) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (x xiGua) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourceXiGua)
 	// disable redirects in the HTTP client, get params before redirects
 	client.SetRedirectPolicy(resty.NoRedirectPolicy())
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		Get(shareUrl)
-	// 非 resty.ErrAutoRedirectDisabled 错误时，返回错误
-	if !errors.Is(err, resty.ErrAutoRedirectDisabled) {
+	// 未获取到跳转地址时，返回错误
+	if err = redirectError(SourceXiGua, err); err != nil {
 		return nil, err
 	}
 
@@ -32,21 +36,22 @@ func (x xiGua) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 
 	videoId := strings.ReplaceAll(strings.Trim(locationRes.Path, "/"), "video/", "")
 	if len(videoId) <= 0 {
-		return nil, errors.New("parse video id from share url fail")
+		return nil, newParseError(SourceXiGua, "", ErrInvalidInput, errors.New("parse video id from share url fail"))
 	}
 
-	return x.parseVideoID(videoId)
+	return x.ParseVideoID(ctx, videoId)
 }
 
-func (x xiGua) parseVideoID(videoId string) (*VideoParseInfo, error) {
+func (x xiGua) ParseVideoID(ctx context.Context, videoId string) (*VideoParseInfo, error) {
 	reqUrl := "https://m.ixigua.com/douyin/share/video/" + videoId + "?aweme_type=107&schema_type=1&utm_source=copy&utm_campaign=client_share&utm_medium=android&app=aweme"
 	headers := map[string]string{
-		HttpHeaderUserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.88 Safari/537.36",
-		HttpHeaderCookie:    "MONITOR_WEB_ID=7892c49b-296e-4499-8704-e47c1b150c18; ixigua-a-s=1; ttcid=af99669b6304453480454f150701d5c226; BD_REF=1; __ac_nonce=060d88ff000a75e8d17eb; __ac_signature=_02B4Z6wo00f01kX9ZpgAAIDAKIBBQUIPYT5F2WIAAPG2ad; ttwid=1%7CcIsVF_3vqSIk4XErhPB0H2VaTxT0tdsTMRbMjrJOPN8%7C1624806049%7C08ce7dd6f7d20506a41ba0a331ef96a6505d96731e6ad9f6c8c709f53f227ab1",
+		HttpHeaderUserAgent: sourceUserAgent(ctx, SourceXiGua, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.88 Safari/537.36"),
+		HttpHeaderCookie:    sourceCookie(ctx, SourceXiGua, xiGuaDefaultCookie),
 	}
 
-	client := resty.New()
+	client := newRestyClient(ctx, SourceXiGua)
 	res, err := client.R().
+		SetContext(ctx).
 		SetHeaders(headers).
 		Get(reqUrl)
 	if err != nil {
@@ -56,7 +61,7 @@ func (x xiGua) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	re := regexp.MustCompile(`window._ROUTER_DATA\s*=\s*(.*?)</script>`)
 	findRes := re.FindSubmatch(res.Body())
 	if len(findRes) < 2 {
-		return nil, errors.New("parse video json info from html fail")
+		return nil, newParseError(SourceXiGua, videoId, ErrLayoutChanged, errors.New("parse video json info from html fail"))
 	}
 
 	jsonBytes := bytes.TrimSpace(findRes[1])
@@ -77,6 +82,8 @@ func (x xiGua) parseVideoID(videoId string) (*VideoParseInfo, error) {
 	parseRes.Author.Uid = userId
 	parseRes.Author.Name = userName
 	parseRes.Author.Avatar = userAvatar
+	parseRes.VideoId = videoId
+	douYinItemMeta(parseRes, videoData)
 
 	return parseRes, nil
 }
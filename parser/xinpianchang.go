@@ -2,19 +2,20 @@ package parser
 
 import (
 	"bytes"
+	"context"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type xinPianChang struct {
 }
 
-func (x xinPianChang) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
-	client := resty.New()
+func (x xinPianChang) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
+	client := newRestyClient(ctx, SourceXinPianChang)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/84.0.4147.125 Safari/537.3").
+		SetContext(ctx).
+		SetHeader(HttpHeaderUserAgent, sourceUserAgent(ctx, SourceXinPianChang, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/84.0.4147.125 Safari/537.3")).
 		//SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
 		SetHeader("Upgrade-Insecure-Requests", "1").
 		SetHeader(HttpHeaderReferer, "https://www.xinpianchang.com/").
@@ -37,10 +38,23 @@ func (x xinPianChang) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	videoUrl := data.Get("video.content.progressive.0.url").String()
 	cover := data.Get("cover").String()
 
+	var streams []StreamVariant
+	for _, item := range data.Get("video.content.progressive").Array() {
+		streams = append(streams, StreamVariant{
+			Quality:   item.Get("profile").String(),
+			Width:     item.Get("width").Int(),
+			Height:    item.Get("height").Int(),
+			Container: urlContainer(item.Get("url").String()),
+			Size:      item.Get("filesize").Int(),
+			Url:       item.Get("url").String(),
+		})
+	}
+
 	parseRes := &VideoParseInfo{
 		Title:    title,
 		VideoUrl: videoUrl,
 		CoverUrl: cover,
+		Streams:  streams,
 	}
 	parseRes.Author.Name = author
 	parseRes.Author.Avatar = avatar
@@ -1,37 +1,37 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"net/url"
 	"strconv"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 )
 
 type zuiYou struct{}
 
-func (z zuiYou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
+func (z zuiYou) ParseShareUrl(ctx context.Context, shareUrl string) (*VideoParseInfo, error) {
 	urlInfo, err := url.Parse(shareUrl)
 	if err != nil {
-		return nil, errors.New("parse share url fail")
+		return nil, newParseError(SourceZuiYou, "", ErrInvalidInput, errors.New("parse share url fail"))
 	}
 	if len(urlInfo.Query()["pid"]) <= 0 {
-		return nil, errors.New("can not parse video id from share url")
+		return nil, newParseError(SourceZuiYou, "", ErrInvalidInput, errors.New("can not parse video id from share url"))
 	}
 	pid := urlInfo.Query()["pid"][0]
 	intPid, err := strconv.Atoi(pid)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(SourceZuiYou, pid, ErrInvalidInput, err)
 	}
 	postData := map[string]interface{}{
 		"h_av": "5.2.13.011",
 		"pid":  intPid,
 	}
 
-	client := resty.New()
+	client := newRestyClient(ctx, SourceZuiYou)
 	res, err := client.R().
-		SetHeader(HttpHeaderUserAgent, DefaultUserAgent).
+		SetContext(ctx).
 		SetBody(postData).
 		Post("https://share.xiaochuankeji.cn/planck/share/post/detail_h5")
 	if err != nil {
@@ -53,6 +53,16 @@ func (z zuiYou) parseShareUrl(shareUrl string) (*VideoParseInfo, error) {
 	}
 	parseRes.Author.Name = userName
 	parseRes.Author.Avatar = userAvatar
+	parseRes.VideoId = pid
+	parseRes.Duration = data.Get("videos." + videoKey + ".dur").Int()
+	parseRes.PublishedAt = data.Get("ct").Int()
+	parseRes.Stats = newVideoStats(
+		data.Get("videos."+videoKey+".playcnt").Int(),
+		data.Get("likes").Int(),
+		data.Get("reviews").Int(),
+		data.Get("share").Int(),
+		0,
+	)
 
 	return parseRes, nil
 }
@@ -0,0 +1,143 @@
+// Package safehttp 提供用于代理外部资源的 http.Client, 防止服务被用作访问内网的代理(SSRF)
+// 只允许访问白名单中的域名, DNS 解析后拒绝连接内网、回环、链路本地等地址, 每次重定向都重新校验
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrForbiddenUrl 地址协议或域名不在白名单中
+	ErrForbiddenUrl = errors.New("forbidden url")
+	// ErrForbiddenAddress 域名解析到了内网、回环等不允许访问的地址
+	ErrForbiddenAddress = errors.New("forbidden address")
+)
+
+// maxRedirects 最大重定向次数
+const maxRedirects = 10
+
+// blockedNets IsPrivate 等方法之外, 不允许访问的地址段
+var blockedNets = func() []*net.IPNet {
+	var list []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // 本网络
+		"100.64.0.0/10",   // 运营商级 NAT
+		"192.0.0.0/24",    // IETF 协议分配
+		"192.0.2.0/24",    // 文档示例
+		"198.18.0.0/15",   // 基准测试
+		"198.51.100.0/24", // 文档示例
+		"203.0.113.0/24",  // 文档示例
+		"240.0.0.0/4",     // 保留地址及广播
+		"64:ff9b::/96",    // NAT64, 可映射到内网 IPv4
+		"64:ff9b:1::/48",  // 本地 NAT64
+		"2001:db8::/32",   // 文档示例
+	} {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		list = append(list, ipNet)
+	}
+	return list
+}()
+
+// IsPublicIP 是否为公网地址
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, ipNet := range blockedNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckUrl 校验地址: 只允许 http/https 协议, 域名需通过 allowHost 校验
+// 直接使用 IP 的地址也需通过 allowHost 校验, 通常会被拒绝
+func CheckUrl(u *url.URL, allowHost func(host string) bool) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrForbiddenUrl, u.Scheme)
+	}
+	host := u.Hostname()
+	if len(host) <= 0 || !allowHost(host) {
+		return fmt.Errorf("%w: host %q is not allowed", ErrForbiddenUrl, host)
+	}
+	return nil
+}
+
+// NewClient 返回只能访问 allowHost 允许的域名和公网地址的 http.Client
+// 校验证书, 不使用环境变量中的代理, 重定向的每一跳都重新校验
+func NewClient(allowHost func(host string) bool) *http.Client {
+	return newClient(allowHost, IsPublicIP)
+}
+
+// newClient allowIP 校验 DNS 解析后实际连接的地址, 测试时可放开回环地址
+func newClient(allowHost func(host string) bool, allowIP func(ip net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		// Control 在 DNS 解析之后、建立连接之前调用, 校验实际连接的地址, 可防止 DNS 重绑定
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !allowIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Transport: &checkTransport{
+			allowHost: allowHost,
+			next: &http.Transport{
+				DialContext:           dialer.DialContext,
+				ForceAttemptHTTP2:     true,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+				ExpectContinueTimeout: time.Second,
+				MaxIdleConns:          100,
+				MaxIdleConnsPerHost:   10,
+				IdleConnTimeout:       30 * time.Second,
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// checkTransport 发送请求前校验地址, 包括重定向后的每一个请求
+type checkTransport struct {
+	allowHost func(host string) bool
+	next      http.RoundTripper
+}
+
+func (t *checkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := CheckUrl(req.URL, t.allowHost); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,113 @@
+package safehttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"1.1.1.1", true},
+		{"110.242.68.66", true},
+		{"2400:3200::1", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckUrl(t *testing.T) {
+	allowHost := func(host string) bool {
+		return host == "video.example.com"
+	}
+	tests := []struct {
+		rawUrl string
+		ok     bool
+	}{
+		{"https://video.example.com/a.mp4", true},
+		{"http://video.example.com:8080/a.mp4", true},
+		{"ftp://video.example.com/a.mp4", false},
+		{"file:///etc/passwd", false},
+		{"https://evil.example.com/a.mp4", false},
+		{"https://video.example.com.evil.com/a.mp4", false},
+		{"http://127.0.0.1/", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.rawUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = CheckUrl(u, allowHost)
+		if (err == nil) != tt.ok || (err != nil && !errors.Is(err, ErrForbiddenUrl)) {
+			t.Errorf("CheckUrl(%s) error = %v, want ok %v", tt.rawUrl, err, tt.ok)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	localUrl := "http://localhost:" + strconv.Itoa(port)
+
+	allowLocalhost := func(host string) bool {
+		return host == "localhost"
+	}
+
+	// 域名在白名单中, 但解析到回环地址
+	_, err := NewClient(allowLocalhost).Get(localUrl + "/")
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("get loopback error = %v, want %v", err, ErrForbiddenAddress)
+	}
+
+	// 放开地址校验后, 白名单域名可以访问
+	client := newClient(allowLocalhost, func(ip net.IP) bool { return true })
+	res, err := client.Get(localUrl + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+
+	// 重定向到白名单之外的地址
+	_, err = client.Get(localUrl + "/redirect?to=" + url.QueryEscape(server.URL+"/"))
+	if !errors.Is(err, ErrForbiddenUrl) {
+		t.Errorf("redirect to ip error = %v, want %v", err, ErrForbiddenUrl)
+	}
+
+	// 重定向到白名单中的地址
+	res, err = client.Get(localUrl + "/redirect?to=" + url.QueryEscape(localUrl+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+}
@@ -0,0 +1,100 @@
+// Package streamtoken 生成和校验 /video/stream 代理使用的签名令牌
+// 令牌中包含上游地址和请求上游需要的请求头, 使用 HMAC-SHA256 签名, 过期后失效, 客户端无法伪造或修改
+package streamtoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken 令牌格式错误或签名不匹配
+	ErrInvalidToken = errors.New("invalid stream token")
+	// ErrTokenExpired 令牌已过期
+	ErrTokenExpired = errors.New("stream token expired")
+)
+
+// Claims 令牌内容
+type Claims struct {
+	Url       string `json:"u"`           // 上游地址
+	Source    string `json:"s,omitempty"` // 所属渠道
+	Referer   string `json:"r,omitempty"` // 请求上游时使用的 Referer
+	UserAgent string `json:"a,omitempty"` // 请求上游时使用的 UserAgent
+	ExpiresAt int64  `json:"e"`           // 过期时间, unix 秒
+}
+
+// Signer 令牌签名和校验
+type Signer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSigner key 为签名密钥, 多实例部署时需使用相同的密钥; ttl 为令牌有效期
+func NewSigner(key []byte, ttl time.Duration) (*Signer, error) {
+	if len(key) < 16 {
+		return nil, errors.New("stream token key must be at least 16 bytes")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("stream token ttl must be positive")
+	}
+	return &Signer{
+		key: append([]byte(nil), key...),
+		ttl: ttl,
+		now: time.Now,
+	}, nil
+}
+
+// Sign 生成令牌, claims.ExpiresAt 为0时使用 ttl 计算过期时间
+func (s *Signer) Sign(claims Claims) (string, error) {
+	if len(claims.Url) <= 0 {
+		return "", errors.New("stream token url is empty")
+	}
+	if claims.ExpiresAt <= 0 {
+		claims.ExpiresAt = s.now().Add(s.ttl).Unix()
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), nil
+}
+
+// Verify 校验令牌签名和有效期, 返回令牌内容
+func (s *Signer) Verify(token string) (Claims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalidToken
+	}
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(sigBytes, s.sign(encoded)) {
+		return Claims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err = json.Unmarshal(payload, &claims); err != nil || len(claims.Url) <= 0 {
+		return Claims{}, ErrInvalidToken
+	}
+	if s.now().Unix() >= claims.ExpiresAt {
+		return Claims{}, fmt.Errorf("%w: at %s", ErrTokenExpired, time.Unix(claims.ExpiresAt, 0).Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+func (s *Signer) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
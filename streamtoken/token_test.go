@@ -0,0 +1,79 @@
+package streamtoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T, key string, now time.Time) *Signer {
+	t.Helper()
+	s, err := NewSigner([]byte(key), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestSigner(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := newTestSigner(t, "0123456789abcdef0123456789abcdef", now)
+
+	claims := Claims{
+		Url:     "https://upos-sz-mirrorali.bilivideo.com/video.m4s?e=abc&deadline=1",
+		Source:  "bilibili",
+		Referer: "https://www.bilibili.com/",
+	}
+	token, err := s.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(token, "+/=?&") {
+		t.Errorf("token %q is not url safe", token)
+	}
+
+	got, err := s.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims.ExpiresAt = now.Add(time.Hour).Unix()
+	if got != claims {
+		t.Errorf("Verify() = %+v, want %+v", got, claims)
+	}
+
+	// 过期
+	s.now = func() time.Time { return now.Add(time.Hour) }
+	if _, err = s.Verify(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expired Verify() error = %v, want %v", err, ErrTokenExpired)
+	}
+	s.now = func() time.Time { return now }
+
+	// 不同密钥, 篡改内容, 格式错误
+	other := newTestSigner(t, "fedcba9876543210fedcba9876543210", now)
+	otherToken, _ := other.Sign(Claims{Url: "http://127.0.0.1/"})
+	payload, sig, _ := strings.Cut(token, ".")
+	otherPayload, _, _ := strings.Cut(otherToken, ".")
+	for _, bad := range []string{
+		otherToken,
+		otherPayload + "." + sig,
+		payload,
+		payload + "." + sig + "x",
+		"",
+		".",
+	} {
+		if _, err = s.Verify(bad); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify(%q) error = %v, want %v", bad, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestNewSigner_invalid(t *testing.T) {
+	if _, err := NewSigner([]byte("short"), time.Hour); err == nil {
+		t.Errorf("NewSigner with short key should fail")
+	}
+	if _, err := NewSigner([]byte("0123456789abcdef"), 0); err == nil {
+		t.Errorf("NewSigner with zero ttl should fail")
+	}
+}
@@ -0,0 +1,60 @@
+package tlscert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// AcmeOptions ACME 自动申请证书配置
+type AcmeOptions struct {
+	DirectoryUrl string   // ACME 服务目录地址, 为空时使用 Let's Encrypt 正式环境
+	Domains      []string // 允许申请证书的域名
+	Email        string   // 联系邮箱, 可为空
+	CacheDir     string   // 证书和账号密钥的缓存目录
+	CaFile       string   // 访问 ACME 服务时额外信任的根证书, 用于 Pebble 等使用自签名证书的测试服务
+}
+
+// NewAcmeManager 创建 ACME 证书管理器, 首次收到对应域名的 https 请求时自动申请证书, 到期前自动续期
+// 使用 tls-alpn-01 验证时 https 需监听 443 端口, 使用 http-01 验证时 http 服务需使用 Manager.HTTPHandler 且监听 80 端口
+func NewAcmeManager(opts AcmeOptions) (*autocert.Manager, error) {
+	if len(opts.Domains) <= 0 {
+		return nil, errors.New("acme domains is empty")
+	}
+	if len(opts.CacheDir) <= 0 {
+		return nil, errors.New("acme cache dir is empty")
+	}
+
+	client := &acme.Client{DirectoryURL: opts.DirectoryUrl}
+	if len(opts.CaFile) > 0 {
+		pem, err := os.ReadFile(opts.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("read acme ca file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in acme ca file %s", opts.CaFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		client.HTTPClient = &http.Client{Transport: transport, Timeout: time.Minute}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(opts.CacheDir),
+		HostPolicy: autocert.HostWhitelist(opts.Domains...),
+		Email:      opts.Email,
+		Client:     client,
+	}, nil
+}
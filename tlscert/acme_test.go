@@ -0,0 +1,57 @@
+package tlscert
+
+import (
+	"crypto/tls"
+	"os"
+	"testing"
+)
+
+func TestNewAcmeManager_invalid(t *testing.T) {
+	if _, err := NewAcmeManager(AcmeOptions{CacheDir: t.TempDir()}); err == nil {
+		t.Errorf("NewAcmeManager without domains should fail")
+	}
+	if _, err := NewAcmeManager(AcmeOptions{Domains: []string{"example.com"}}); err == nil {
+		t.Errorf("NewAcmeManager without cache dir should fail")
+	}
+	if _, err := NewAcmeManager(AcmeOptions{Domains: []string{"example.com"}, CacheDir: t.TempDir(), CaFile: "acme.go"}); err == nil {
+		t.Errorf("NewAcmeManager with invalid ca file should fail")
+	}
+}
+
+// TestNewAcmeManager_pebble 使用本地 Pebble 申请证书, 需要设置环境变量:
+// PEBBLE_DIRECTORY_URL Pebble 目录地址, 如: https://localhost:14000/dir
+// PEBBLE_CA_FILE Pebble 的 https 证书, 如: test/certs/pebble.minica.pem
+// Pebble 需以 PEBBLE_VA_ALWAYS_VALID=1 启动, 跳过域名验证
+func TestNewAcmeManager_pebble(t *testing.T) {
+	directoryUrl := os.Getenv("PEBBLE_DIRECTORY_URL")
+	if len(directoryUrl) <= 0 {
+		t.Skip("PEBBLE_DIRECTORY_URL is not set")
+	}
+
+	m, err := NewAcmeManager(AcmeOptions{
+		DirectoryUrl: directoryUrl,
+		Domains:      []string{"parse-video.test"},
+		CacheDir:     t.TempDir(),
+		CaFile:       os.Getenv("PEBBLE_CA_FILE"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:        "parse-video.test",
+		SupportedProtos:   []string{"http/1.1"},
+		CipherSuites:      []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		SupportedVersions: []uint16{tls.VersionTLS12, tls.VersionTLS13},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil || cert.Leaf.DNSNames[0] != "parse-video.test" {
+		t.Errorf("certificate = %+v, want for parse-video.test", cert.Leaf)
+	}
+
+	// 不在白名单中的域名
+	if _, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.test"}); err == nil {
+		t.Errorf("GetCertificate for other.test should fail")
+	}
+}
@@ -0,0 +1,128 @@
+// Package tlscert 为 https 服务提供证书: 从文件加载并在文件变化时自动重新加载, 或通过 ACME 自动申请
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader 从文件加载证书, 文件变化或调用 Reload 时重新加载, 不需要重启服务
+// 重新加载失败时继续使用原证书
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	state fileState // 最近一次成功加载时的文件状态
+}
+
+// fileState 证书和私钥文件的修改时间和大小, 用于判断文件是否变化
+type fileState struct {
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+// NewReloader 加载证书和私钥文件, 文件不存在或不匹配时返回错误
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新加载证书和私钥文件, 失败时继续使用原证书
+func (r *Reloader) Reload() error {
+	state, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate %s: %w", r.certFile, err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("parse certificate %s: %w", r.certFile, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.state = state
+	return nil
+}
+
+// Certificate 返回当前使用的证书
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate 用于 tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// Watch 每隔 interval 检查证书和私钥文件, 修改时间或大小变化时重新加载; 从 trigger 收到信号(如 SIGHUP)时立即重新加载
+// interval 为0时不检查文件, 只响应 trigger; ctx 取消时退出
+// 证书和私钥分开写入时, 可能读到不匹配的一对, 加载失败后下次检查会重试
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, trigger <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-trigger:
+		case <-tick:
+			state, err := r.stat()
+			if err != nil {
+				log.Printf("检查证书文件失败: %v", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := state != r.state
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+		}
+
+		if err := r.Reload(); err != nil {
+			log.Printf("重新加载证书失败, 继续使用原证书: %v", err)
+			continue
+		}
+		log.Printf("证书已重新加载, 有效期至 %s", r.Certificate().Leaf.NotAfter.Format(time.RFC3339))
+	}
+}
+
+func (r *Reloader) stat() (fileState, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fileState{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{
+		certMod:  certInfo.ModTime(),
+		keyMod:   keyInfo.ModTime(),
+		certSize: certInfo.Size(),
+		keySize:  keyInfo.Size(),
+	}, nil
+}
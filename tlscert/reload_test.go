@@ -0,0 +1,121 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成序列号为 serial 的自签名证书, 写入 certFile 和 keyFile
+func writeTestCert(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// 保证修改时间变化
+	mod := time.Now().Add(time.Duration(serial) * time.Second)
+	_ = os.Chtimes(certFile, mod, mod)
+	_ = os.Chtimes(keyFile, mod, mod)
+}
+
+func serialOf(t *testing.T, r *Reloader) int64 {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	if _, err := NewReloader(certFile, keyFile); err == nil {
+		t.Fatal("NewReloader with missing files should fail")
+	}
+
+	writeTestCert(t, certFile, keyFile, 1)
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := serialOf(t, r); serial != 1 {
+		t.Fatalf("serial = %d, want 1", serial)
+	}
+
+	// 手动重新加载, 如收到 SIGHUP
+	writeTestCert(t, certFile, keyFile, 2)
+	if err = r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if serial := serialOf(t, r); serial != 2 {
+		t.Fatalf("serial after Reload = %d, want 2", serial)
+	}
+
+	// 文件损坏时继续使用原证书
+	if err = os.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Reload(); err == nil {
+		t.Errorf("Reload with broken key should fail")
+	}
+	if serial := serialOf(t, r); serial != 2 {
+		t.Errorf("serial after failed Reload = %d, want 2", serial)
+	}
+
+	// 轮询发现文件变化后自动重新加载
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond, nil)
+	writeTestCert(t, certFile, keyFile, 3)
+	deadline := time.Now().Add(2 * time.Second)
+	for serialOf(t, r) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("certificate not reloaded by Watch, serial = %d", serialOf(t, r))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 不轮询时只在收到信号后重新加载
+	trigger := make(chan os.Signal)
+	go r.Watch(ctx, 0, trigger)
+	writeTestCert(t, certFile, keyFile, 4)
+	trigger <- syscall.SIGHUP
+	trigger <- syscall.SIGHUP // 第二次发送成功时, 第一次的重新加载已完成
+	if serial := serialOf(t, r); serial != 4 {
+		t.Errorf("serial after trigger = %d, want 4", serial)
+	}
+}